@@ -0,0 +1,436 @@
+package chatbot
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/logic"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// Twitch drops anything longer than this.
+const maxMessageLength int = 500
+
+// How long to wait before reconnecting or re-checking the enabled setting.
+var retryDelay = time.Minute
+
+// Backend is the subset of logic.Logic used by the bot.
+type Backend interface {
+	GetTwitchBotEnabled() (bool, error)
+	GetTwitchBotServer() (string, error)
+	GetTwitchBotUsername() (string, error)
+	GetTwitchBotOauthToken() (string, error)
+	GetTwitchBotChannel() (string, error)
+	GetHostAddress() (string, error)
+
+	GetActiveMovies() ([]*models.Movie, error)
+	GetMovie(id int) *models.Movie
+	UserTwitchLogin(extId string) (*models.User, error)
+	GetUserVotes(user *models.User) ([]*models.Movie, []*models.Movie, error)
+	GetAvailableVotes(user *models.User) (int, error)
+	GetUnlimitedVotes() (bool, error)
+	UserVotedForMovie(userid int, movieid int) (bool, error)
+	AddVote(userid int, movieid int) error
+	DeleteVote(userid int, movieid int) error
+
+	AddCycleEndHandler(handler logic.CycleEndHandler)
+}
+
+type Bot struct {
+	backend Backend
+	l       *logger.Logger
+
+	// Opens the connection to the IRC server.  Defaults to TLS, tests swap
+	// this out for a plain TCP connection.
+	dial func(addr string) (net.Conn, error)
+
+	lock    *sync.Mutex
+	conn    net.Conn
+	channel string
+
+	quit chan struct{}
+}
+
+func New(backend Backend, log *logger.Logger) *Bot {
+	bot := &Bot{
+		backend: backend,
+		l:       log,
+		lock:    &sync.Mutex{},
+		quit:    make(chan struct{}),
+
+		dial: func(addr string) (net.Conn, error) {
+			return tls.Dial("tcp", addr, nil)
+		},
+	}
+
+	backend.AddCycleEndHandler(bot.announceCycleEnd)
+	return bot
+}
+
+// Run connects to chat and handles commands until Close() is called.  When
+// the bot is disabled in the config it idles and checks again periodically,
+// so it can be turned on and off from the admin page without a restart.
+func (b *Bot) Run() {
+	for {
+		enabled, err := b.backend.GetTwitchBotEnabled()
+		if err != nil {
+			b.l.Error("[chatbot] Unable to get %s: %v", logic.ConfigTwitchBotEnabled, err)
+		}
+
+		if enabled {
+			err = b.connect()
+			if err != nil {
+				b.l.Error("[chatbot] %v", err)
+			}
+		}
+
+		select {
+		case <-b.quit:
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+func (b *Bot) Close() {
+	close(b.quit)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.conn != nil {
+		b.conn.Close()
+	}
+}
+
+func (b *Bot) connect() error {
+	server, err := b.backend.GetTwitchBotServer()
+	if err != nil {
+		return err
+	}
+
+	username, err := b.backend.GetTwitchBotUsername()
+	if err != nil {
+		return err
+	}
+
+	token, err := b.backend.GetTwitchBotOauthToken()
+	if err != nil {
+		return err
+	}
+
+	channel, err := b.backend.GetTwitchBotChannel()
+	if err != nil {
+		return err
+	}
+
+	if server == "" || username == "" || token == "" || channel == "" {
+		return fmt.Errorf("The Twitch chat bot is enabled but not configured")
+	}
+
+	if !strings.HasPrefix(token, "oauth:") {
+		token = "oauth:" + token
+	}
+
+	channel = "#" + strings.ToLower(strings.TrimLeft(channel, "#"))
+
+	conn, err := b.dial(server)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s: %v", server, err)
+	}
+	defer conn.Close()
+
+	b.lock.Lock()
+	b.conn = conn
+	b.channel = channel
+	b.lock.Unlock()
+
+	defer func() {
+		b.lock.Lock()
+		b.conn = nil
+		b.lock.Unlock()
+	}()
+
+	for _, line := range []string{
+		"CAP REQ :twitch.tv/tags",
+		"PASS " + token,
+		"NICK " + strings.ToLower(username),
+		"JOIN " + channel,
+	} {
+		if err = b.send(line); err != nil {
+			return err
+		}
+	}
+
+	b.l.Info("[chatbot] Connected to %s as %s", server, username)
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			select {
+			case <-b.quit:
+				return nil
+			default:
+			}
+			return fmt.Errorf("Connection to %s lost: %v", server, err)
+		}
+
+		msg, err := parseMessage(line)
+		if err != nil {
+			b.l.Debug("[chatbot] %v", err)
+			continue
+		}
+
+		switch msg.Command {
+		case "PING":
+			err = b.send("PONG :" + msg.Trailing())
+			if err != nil {
+				return err
+			}
+
+		case "NOTICE":
+			// Twitch sends a NOTICE and drops the connection on bad logins.
+			b.l.Info("[chatbot] NOTICE: %s", msg.Trailing())
+
+		case "PRIVMSG":
+			b.handleMessage(msg)
+		}
+	}
+}
+
+func (b *Bot) send(line string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.conn == nil {
+		return fmt.Errorf("Not connected to chat")
+	}
+
+	_, err := fmt.Fprintf(b.conn, "%s\r\n", line)
+	return err
+}
+
+// say sends a message to the channel, cutting it down to the size Twitch
+// accepts.
+func (b *Bot) say(text string) error {
+	text = strings.ReplaceAll(text, "\n", " ")
+	if len(text) > maxMessageLength {
+		text = text[:maxMessageLength-3] + "..."
+	}
+
+	b.lock.Lock()
+	channel := b.channel
+	b.lock.Unlock()
+
+	return b.send(fmt.Sprintf("PRIVMSG %s :%s", channel, text))
+}
+
+func (b *Bot) reply(msg *ircMessage, format string, v ...interface{}) {
+	name := msg.Tags["display-name"]
+	if name == "" {
+		name = msg.Nick()
+	}
+
+	err := b.say(fmt.Sprintf("@%s %s", name, fmt.Sprintf(format, v...)))
+	if err != nil {
+		b.l.Error("[chatbot] Unable to send reply: %v", err)
+	}
+}
+
+func (b *Bot) handleMessage(msg *ircMessage) {
+	fields := strings.Fields(msg.Trailing())
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "!") {
+		return
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "!movies":
+		b.cmdMovies(msg)
+	case "!vote":
+		b.cmdVote(msg, fields[1:], true)
+	case "!unvote":
+		b.cmdVote(msg, fields[1:], false)
+	case "!votes":
+		b.cmdVotes(msg)
+	}
+}
+
+// chatUser maps the sender of a message to their MoviePolls account through
+// the Twitch user ID of a linked Twitch AuthMethod.
+func (b *Bot) chatUser(msg *ircMessage) *models.User {
+	extId := msg.Tags["user-id"]
+	if extId == "" {
+		b.l.Debug("[chatbot] No user-id tag on message from %s", msg.Nick())
+		return nil
+	}
+
+	user, err := b.backend.UserTwitchLogin(extId)
+	if err != nil || user == nil {
+		host, _ := b.backend.GetHostAddress()
+		b.reply(msg, "your Twitch account is not linked to MoviePolls. Link it at %s/user", host)
+		return nil
+	}
+
+	return user
+}
+
+func (b *Bot) cmdMovies(msg *ircMessage) {
+	movies, err := b.backend.GetActiveMovies()
+	if err != nil {
+		b.l.Error("[chatbot] Unable to get active movies: %v", err)
+		b.reply(msg, "something went wrong :C")
+		return
+	}
+
+	list := []string{}
+	for _, movie := range models.SortMoviesByVotes(movies) {
+		if movie.Removed {
+			continue
+		}
+		list = append(list, fmt.Sprintf("%d: %s (%d)", movie.Id, movie.Name, len(movie.Votes)))
+	}
+
+	if len(list) == 0 {
+		b.reply(msg, "there are no movies in the current cycle.")
+		return
+	}
+
+	b.reply(msg, "%s", strings.Join(list, " | "))
+}
+
+func (b *Bot) cmdVote(msg *ircMessage, args []string, add bool) {
+	cmd := "!unvote"
+	if add {
+		cmd = "!vote"
+	}
+
+	if len(args) == 0 {
+		b.reply(msg, "usage: %s <movie id>", cmd)
+		return
+	}
+
+	movieId, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	if err != nil {
+		b.reply(msg, "usage: %s <movie id>", cmd)
+		return
+	}
+
+	user := b.chatUser(msg)
+	if user == nil {
+		return
+	}
+
+	movie := b.backend.GetMovie(movieId)
+	if movie == nil || movie.Removed || movie.Pending || movie.CycleWatched != nil {
+		b.reply(msg, "no active movie with ID %d.", movieId)
+		return
+	}
+
+	if add {
+		err = b.backend.AddVote(user.Id, movie.Id)
+		if err == nil {
+			b.reply(msg, "voted for %s.", movie.Name)
+			return
+		}
+	} else {
+		var voted bool
+		voted, err = b.backend.UserVotedForMovie(user.Id, movie.Id)
+		if err != nil {
+			b.l.Error("[chatbot] Unable to get vote: %v", err)
+			b.reply(msg, "something went wrong :C")
+			return
+		}
+
+		if !voted {
+			b.reply(msg, "you have not voted for %s.", movie.Name)
+			return
+		}
+
+		err = b.backend.DeleteVote(user.Id, movie.Id)
+		if err == nil {
+			b.reply(msg, "removed your vote for %s.", movie.Name)
+			return
+		}
+	}
+
+	switch {
+	case errors.Is(err, logic.ErrVotingDisabled):
+		b.reply(msg, "voting is not enabled right now.")
+	case errors.Is(err, logic.ErrAlreadyVoted):
+		b.reply(msg, "you already voted for %s.", movie.Name)
+	case errors.Is(err, logic.ErrNoVotesLeft):
+		b.reply(msg, "you don't have any more available votes.")
+	default:
+		b.l.Error("[chatbot] %s %d by user %d failed: %v", cmd, movie.Id, user.Id, err)
+		b.reply(msg, "something went wrong :C")
+	}
+}
+
+func (b *Bot) cmdVotes(msg *ircMessage) {
+	user := b.chatUser(msg)
+	if user == nil {
+		return
+	}
+
+	active, _, err := b.backend.GetUserVotes(user)
+	if err != nil {
+		b.l.Error("[chatbot] Unable to get votes for user %d: %v", user.Id, err)
+		b.reply(msg, "something went wrong :C")
+		return
+	}
+
+	unlimited, err := b.backend.GetUnlimitedVotes()
+	if err != nil {
+		b.l.Error("[chatbot] Unable to get UnlimitedVotes: %v", err)
+	}
+
+	remaining := ""
+	if !unlimited {
+		available, err := b.backend.GetAvailableVotes(user)
+		if err != nil {
+			b.l.Error("[chatbot] Unable to get available votes for user %d: %v", user.Id, err)
+		} else {
+			remaining = fmt.Sprintf(" (%d votes left)", available)
+		}
+	}
+
+	if len(active) == 0 {
+		b.reply(msg, "you have not voted for anything yet%s.", remaining)
+		return
+	}
+
+	list := []string{}
+	for _, movie := range active {
+		list = append(list, fmt.Sprintf("%d: %s", movie.Id, movie.Name))
+	}
+
+	b.reply(msg, "your votes: %s%s", strings.Join(list, " | "), remaining)
+}
+
+// announceCycleEnd posts the watched movies to chat.  This is called from the
+// backend, so don't block it if chat is slow or not connected.
+func (b *Bot) announceCycleEnd(cycle *models.Cycle, watched []*models.Movie) {
+	names := []string{}
+	for _, movie := range watched {
+		names = append(names, movie.Name)
+	}
+
+	text := fmt.Sprintf("Cycle %d has ended!", cycle.Id)
+	if len(names) > 0 {
+		text = fmt.Sprintf("%s Watching: %s", text, strings.Join(names, ", "))
+	}
+
+	go func() {
+		if err := b.say(text); err != nil {
+			b.l.Info("[chatbot] Unable to announce end of cycle %d: %v", cycle.Id, err)
+		}
+	}()
+}
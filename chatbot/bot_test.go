@@ -0,0 +1,264 @@
+package chatbot
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/logic"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// fakeBackend implements just enough of the backend for the bot.  Votes are
+// limited to maxVotes per user, similar to logic.AddVote.
+type fakeBackend struct {
+	server   string
+	users    map[string]*models.User
+	movies   map[int]*models.Movie
+	votes    map[int][]int
+	maxVotes int
+	handler  logic.CycleEndHandler
+}
+
+func newFakeBackend(server string) *fakeBackend {
+	return &fakeBackend{
+		server: server,
+		users: map[string]*models.User{
+			"1001": &models.User{Id: 1, Name: "viewer"},
+		},
+		movies: map[int]*models.Movie{
+			3: &models.Movie{Id: 3, Name: "Alien (1979)"},
+			4: &models.Movie{Id: 4, Name: "Aliens (1986)"},
+		},
+		votes:    map[int][]int{},
+		maxVotes: 1,
+	}
+}
+
+func (f *fakeBackend) GetTwitchBotEnabled() (bool, error)         { return true, nil }
+func (f *fakeBackend) GetTwitchBotServer() (string, error)        { return f.server, nil }
+func (f *fakeBackend) GetTwitchBotUsername() (string, error)      { return "MoviePollsBot", nil }
+func (f *fakeBackend) GetTwitchBotOauthToken() (string, error)    { return "secret", nil }
+func (f *fakeBackend) GetTwitchBotChannel() (string, error)       { return "SomeStreamer", nil }
+func (f *fakeBackend) GetHostAddress() (string, error)            { return "http://localhost:8090", nil }
+func (f *fakeBackend) GetUnlimitedVotes() (bool, error)           { return false, nil }
+func (f *fakeBackend) AddCycleEndHandler(h logic.CycleEndHandler) { f.handler = h }
+
+func (f *fakeBackend) GetActiveMovies() ([]*models.Movie, error) {
+	movies := []*models.Movie{}
+	for _, m := range f.movies {
+		movies = append(movies, m)
+	}
+	return movies, nil
+}
+
+func (f *fakeBackend) GetMovie(id int) *models.Movie {
+	return f.movies[id]
+}
+
+func (f *fakeBackend) UserTwitchLogin(extId string) (*models.User, error) {
+	user, ok := f.users[extId]
+	if !ok {
+		return nil, fmt.Errorf("No user found with corresponding extid")
+	}
+	return user, nil
+}
+
+func (f *fakeBackend) GetUserVotes(user *models.User) ([]*models.Movie, []*models.Movie, error) {
+	active := []*models.Movie{}
+	for _, id := range f.votes[user.Id] {
+		active = append(active, f.movies[id])
+	}
+	return active, []*models.Movie{}, nil
+}
+
+func (f *fakeBackend) GetAvailableVotes(user *models.User) (int, error) {
+	return f.maxVotes - len(f.votes[user.Id]), nil
+}
+
+func (f *fakeBackend) UserVotedForMovie(userid int, movieid int) (bool, error) {
+	for _, id := range f.votes[userid] {
+		if id == movieid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeBackend) AddVote(userid int, movieid int) error {
+	if voted, _ := f.UserVotedForMovie(userid, movieid); voted {
+		return logic.ErrAlreadyVoted
+	}
+	if len(f.votes[userid]) >= f.maxVotes {
+		return logic.ErrNoVotesLeft
+	}
+	f.votes[userid] = append(f.votes[userid], movieid)
+	return nil
+}
+
+func (f *fakeBackend) DeleteVote(userid int, movieid int) error {
+	votes := []int{}
+	for _, id := range f.votes[userid] {
+		if id != movieid {
+			votes = append(votes, id)
+		}
+	}
+	f.votes[userid] = votes
+	return nil
+}
+
+// fakeServer is a plain TCP IRC server that records everything the bot sends.
+type fakeServer struct {
+	listener net.Listener
+	conn     net.Conn
+	lines    chan string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start fake IRC server: %v", err)
+	}
+
+	return &fakeServer{
+		listener: listener,
+		lines:    make(chan string, 100),
+	}
+}
+
+func (s *fakeServer) accept(t *testing.T) {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		t.Fatalf("Unable to accept connection: %v", err)
+	}
+	s.conn = conn
+
+	go func() {
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(s.lines)
+				return
+			}
+			s.lines <- strings.TrimRight(line, "\r\n")
+		}
+	}()
+}
+
+func (s *fakeServer) send(t *testing.T, line string) {
+	if _, err := fmt.Fprintf(s.conn, "%s\r\n", line); err != nil {
+		t.Fatalf("Unable to send line: %v", err)
+	}
+}
+
+func (s *fakeServer) expect(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case line := <-s.lines:
+		if line != want {
+			t.Fatalf("Expected %q, got %q", want, line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for %q", want)
+	}
+}
+
+func chatLine(userId, nick, text string) string {
+	return fmt.Sprintf("@display-name=%s;user-id=%s :%s!%s@%s.tmi.twitch.tv PRIVMSG #somestreamer :%s",
+		nick, userId, strings.ToLower(nick), strings.ToLower(nick), strings.ToLower(nick), text)
+}
+
+func Test_ChatBot(t *testing.T) {
+	log := logger.NewSilent()
+
+	server := newFakeServer(t)
+	defer server.listener.Close()
+
+	backend := newFakeBackend(server.listener.Addr().String())
+	bot := New(backend, log)
+	bot.dial = func(addr string) (net.Conn, error) {
+		return net.Dial("tcp", addr)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- bot.connect()
+	}()
+
+	server.accept(t)
+	server.expect(t, "CAP REQ :twitch.tv/tags")
+	server.expect(t, "PASS oauth:secret")
+	server.expect(t, "NICK moviepollsbot")
+	server.expect(t, "JOIN #somestreamer")
+
+	server.send(t, "PING :tmi.twitch.tv")
+	server.expect(t, "PONG :tmi.twitch.tv")
+
+	server.send(t, chatLine("1001", "Viewer", "!movies"))
+	server.expect(t, "PRIVMSG #somestreamer :@Viewer 3: Alien (1979) (0) | 4: Aliens (1986) (0)")
+
+	server.send(t, chatLine("1001", "Viewer", "!vote 3"))
+	server.expect(t, "PRIVMSG #somestreamer :@Viewer voted for Alien (1979).")
+
+	server.send(t, chatLine("1001", "Viewer", "!vote 3"))
+	server.expect(t, "PRIVMSG #somestreamer :@Viewer you already voted for Alien (1979).")
+
+	server.send(t, chatLine("1001", "Viewer", "!vote 4"))
+	server.expect(t, "PRIVMSG #somestreamer :@Viewer you don't have any more available votes.")
+
+	server.send(t, chatLine("1001", "Viewer", "!votes"))
+	server.expect(t, "PRIVMSG #somestreamer :@Viewer your votes: 3: Alien (1979) (0 votes left)")
+
+	server.send(t, chatLine("1001", "Viewer", "!unvote 3"))
+	server.expect(t, "PRIVMSG #somestreamer :@Viewer removed your vote for Alien (1979).")
+
+	server.send(t, chatLine("1001", "Viewer", "!vote 99"))
+	server.expect(t, "PRIVMSG #somestreamer :@Viewer no active movie with ID 99.")
+
+	server.send(t, chatLine("2002", "Lurker", "!vote 3"))
+	server.expect(t, "PRIVMSG #somestreamer :@Lurker your Twitch account is not linked to MoviePolls. Link it at http://localhost:8090/user")
+
+	// Regular chatter is ignored
+	server.send(t, chatLine("1001", "Viewer", "hello chat"))
+
+	backend.handler(&models.Cycle{Id: 7}, []*models.Movie{backend.movies[4]})
+	server.expect(t, "PRIVMSG #somestreamer :Cycle 7 has ended! Watching: Aliens (1986)")
+
+	bot.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Unexpected error on close: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Bot did not shut down")
+	}
+}
+
+func Test_ParseMessage(t *testing.T) {
+	msg, err := parseMessage(`@badge-info=;display-name=Some\sOne;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #chan :!vote 12` + "\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Command != "PRIVMSG" {
+		t.Errorf("Expected PRIVMSG, got %q", msg.Command)
+	}
+
+	if msg.Tags["user-id"] != "42" || msg.Tags["display-name"] != "Some One" {
+		t.Errorf("Unexpected tags: %v", msg.Tags)
+	}
+
+	if msg.Nick() != "someone" {
+		t.Errorf("Expected nick someone, got %q", msg.Nick())
+	}
+
+	if len(msg.Params) != 2 || msg.Params[0] != "#chan" || msg.Trailing() != "!vote 12" {
+		t.Errorf("Unexpected params: %q", msg.Params)
+	}
+}
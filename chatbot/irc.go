@@ -0,0 +1,105 @@
+package chatbot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ircMessage is a single parsed IRC line.  Twitch sends IRCv3 message tags
+// (eg, user-id and display-name) when the twitch.tv/tags capability has been
+// requested.
+type ircMessage struct {
+	Tags    map[string]string
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// Nick returns the nickname portion of the message prefix.
+func (m ircMessage) Nick() string {
+	idx := strings.Index(m.Prefix, "!")
+	if idx == -1 {
+		return m.Prefix
+	}
+	return m.Prefix[:idx]
+}
+
+// Trailing returns the last parameter of the message, which holds the text
+// for PRIVMSG lines.
+func (m ircMessage) Trailing() string {
+	if len(m.Params) == 0 {
+		return ""
+	}
+	return m.Params[len(m.Params)-1]
+}
+
+func (m ircMessage) String() string {
+	return fmt.Sprintf("ircMessage{Prefix:%q Command:%q Params:%q}", m.Prefix, m.Command, m.Params)
+}
+
+var tagEscapes = strings.NewReplacer(
+	`\:`, ";",
+	`\s`, " ",
+	`\\`, `\`,
+	`\r`, "\r",
+	`\n`, "\n",
+)
+
+func parseMessage(line string) (*ircMessage, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("Empty IRC line")
+	}
+
+	msg := &ircMessage{
+		Tags:   map[string]string{},
+		Params: []string{},
+	}
+
+	if strings.HasPrefix(line, "@") {
+		idx := strings.Index(line, " ")
+		if idx == -1 {
+			return nil, fmt.Errorf("Malformed IRC tags: %q", line)
+		}
+
+		for _, tag := range strings.Split(line[1:idx], ";") {
+			kv := strings.SplitN(tag, "=", 2)
+			if len(kv) == 2 {
+				msg.Tags[kv[0]] = tagEscapes.Replace(kv[1])
+			} else {
+				msg.Tags[kv[0]] = ""
+			}
+		}
+		line = strings.TrimLeft(line[idx+1:], " ")
+	}
+
+	if strings.HasPrefix(line, ":") {
+		idx := strings.Index(line, " ")
+		if idx == -1 {
+			return nil, fmt.Errorf("Malformed IRC prefix: %q", line)
+		}
+		msg.Prefix = line[1:idx]
+		line = strings.TrimLeft(line[idx+1:], " ")
+	}
+
+	trailing := ""
+	hasTrailing := false
+	if idx := strings.Index(line, " :"); idx != -1 {
+		trailing = line[idx+2:]
+		hasTrailing = true
+		line = line[:idx]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("IRC line is missing a command")
+	}
+
+	msg.Command = strings.ToUpper(fields[0])
+	msg.Params = append(msg.Params, fields[1:]...)
+	if hasTrailing {
+		msg.Params = append(msg.Params, trailing)
+	}
+
+	return msg, nil
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/zorchenhimer/MoviePolls/logger"
@@ -46,6 +47,11 @@ type Database interface {
 	AddAuthMethod(authMethod *models.AuthMethod) (int, error)
 	AddLink(link *models.Link) (int, error)
 	AddVote(userId, movieId int) error
+	// Audit entries are append-only; there is no way to update or delete
+	// them.
+	AddAuditEntry(entry *models.AuditEntry) (int, error)
+	// Revisions are append-only as well.
+	AddMovieRevision(rev *models.MovieRevision) (int, error)
 
 	// ######################
 	// ##### READ (get) #####
@@ -54,7 +60,9 @@ type Database interface {
 	GetCycle(id int) (*models.Cycle, error)
 	GetCurrentCycle() (*models.Cycle, error) // Return nil when no cycle is active.
 	GetMovie(id int) (*models.Movie, error)
-	GetActiveMovies() ([]*models.Movie, error)
+	GetActiveMovies() ([]*models.Movie, error) // Excludes movies awaiting approval
+	GetPendingMovies() ([]*models.Movie, error)
+	GetAllMovies() ([]*models.Movie, error) // Includes removed, pending and watched movies
 	GetUser(id int) (*models.User, error)
 	GetUsers(start, count int) ([]*models.User, error)
 	GetUserVotes(userId int) ([]*models.Movie, error)
@@ -62,6 +70,7 @@ type Database interface {
 	GetUsersWithAuth(auth models.AuthType, exclusive bool) ([]*models.User, error)
 	//GetMovieVotes(userId int) []*Movie
 	GetTag(id int) *models.Tag
+	GetTags() ([]*models.Tag, error)
 	GetAuthMethod(id int) *models.AuthMethod
 	GetLink(id int) *models.Link
 	// Return a list of past cycles.  Start and end are an offset from
@@ -73,6 +82,16 @@ type Database interface {
 	// Get all the movies that belong to the given Cycle
 	GetMoviesFromCycle(id int) ([]*models.Movie, error)
 
+	// Returns ErrNoValue if the capabilities of the role have not been
+	// changed from the defaults.
+	GetRoleCapabilities(role models.PrivilegeLevel) ([]models.Capability, error)
+
+	// Newest entries first.
+	GetAuditEntries(filter models.AuditFilter) ([]*models.AuditEntry, error)
+
+	// Newest revisions first.
+	GetMovieRevisions(movieId int) ([]*models.MovieRevision, error)
+
 	// #######################
 	// ##### READ (find) #####
 	// #######################
@@ -88,6 +107,13 @@ type Database interface {
 	UpdateMovie(movie *models.Movie) error
 	UpdateCycle(cycle *models.Cycle) error
 	UpdateAuthMethod(authMethod *models.AuthMethod) error
+	// Returns an error if the new name or an alias is already used by
+	// another tag.
+	UpdateTag(tag *models.Tag) error
+	// Moves every movie from one tag to the other and deletes the first.  Its
+	// name and aliases become aliases of the tag it was merged into.
+	MergeTags(fromId, intoId int) error
+	SetRoleCapabilities(role models.PrivilegeLevel, caps []models.Capability) error
 
 	// ##################
 	// ##### DELETE #####
@@ -115,7 +141,8 @@ type Database interface {
 
 	CheckOauthUsage(id string, authtype models.AuthType) bool
 
-	SearchMovieTitles(query string) ([]*models.Movie, error)
+	// Ranked search over the title, description, tags and link types.
+	SearchMovies(query models.SearchQuery) ([]*models.SearchResult, error)
 
 	CheckMovieExists(title string) (bool, error)
 	CheckUserExists(name string) (bool, error)
@@ -134,6 +161,33 @@ type Database interface {
 	SetCfgBool(key string, value bool) error
 
 	DeleteCfgKey(key string) error
+
+	// Store the auth tokens and the string values of secretKeys encrypted
+	// with box from now on.  Values still stored in plain text are encrypted
+	// right away.  Returns how many values were encrypted.
+	SetSecretBox(box SecretBox, secretKeys []string) (int, error)
+	// Decrypt every secret with the current box and encrypt it again with a
+	// new one.  Nothing is changed if a secret can't be decrypted.  Returns
+	// how many values were encrypted.
+	RotateSecretBox(box SecretBox) (int, error)
+
+	// Check that the database can be used, for the readiness check.
+	Ping() error
+}
+
+// SecretBox encrypts secrets before they are written to the database.
+// Encrypted values start with SealedPrefix.
+type SecretBox interface {
+	Seal(plain string) (string, error)
+	Open(sealed string) (string, error)
+}
+
+const SealedPrefix string = "enc:"
+
+var ErrNoSecretKey = errors.New("The value is encrypted, but no secret key was given")
+
+func IsSealed(val string) bool {
+	return strings.HasPrefix(val, SealedPrefix)
 }
 
 type TestableDatabase interface {
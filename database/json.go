@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/metrics"
 	mpm "github.com/zorchenhimer/MoviePolls/models"
 )
 
@@ -28,9 +29,12 @@ type jsonMovie struct {
 	CycleWatchedId int
 	Removed        bool
 	Approved       bool
+	Pending        bool
+	RejectReason   string
 	Poster         string
 	AddedBy        int
 	Tags           []int
+	EditedFields   []string
 }
 
 func (j *jsonConnector) newJsonMovie(movie *mpm.Movie) jsonMovie {
@@ -73,8 +77,11 @@ func (j *jsonConnector) newJsonMovie(movie *mpm.Movie) jsonMovie {
 		CycleWatchedId: cycleWatched,
 		Removed:        movie.Removed,
 		Approved:       movie.Approved,
+		Pending:        movie.Pending,
+		RejectReason:   movie.RejectReason,
 		Poster:         movie.Poster,
 		Tags:           tags,
+		EditedFields:   movie.EditedFields,
 	}
 
 	if movie.AddedBy != nil {
@@ -183,10 +190,26 @@ type jsonConnector struct {
 	Links       map[int]*mpm.Link
 	AuthMethods map[int]*mpm.AuthMethod
 
+	// Capabilities for each role, keyed by privilege level.  Roles that are
+	// missing use the defaults.
+	Roles map[int][]mpm.Capability
+
+	Audit     []*mpm.AuditEntry
+	Revisions []*mpm.MovieRevision
+
 	//Settings Configurator
 	Settings map[string]configValue
 
 	l *logger.Logger
+
+	// Encrypts the auth tokens and the settings in secretKeys.  Nil if no
+	// secret key was given.
+	box        SecretBox
+	secretKeys map[string]bool
+
+	// Built on the first search after a change
+	indexLock   sync.Mutex
+	searchIndex *searchIndex
 }
 
 func init() {
@@ -221,6 +244,9 @@ func newJsonConnector(filename string, l *logger.Logger) (*jsonConnector, error)
 		Tags:        map[int]*mpm.Tag{},
 		Links:       map[int]*mpm.Link{},
 		AuthMethods: map[int]*mpm.AuthMethod{},
+		Roles:       map[int][]mpm.Capability{},
+		Audit:       []*mpm.AuditEntry{},
+		Revisions:   []*mpm.MovieRevision{},
 		l:           l,
 	}
 
@@ -233,6 +259,12 @@ func loadJson(filename string, l *logger.Logger) (*jsonConnector, error) {
 		return nil, err
 	}
 
+	// Older versions created the file readable by everyone
+	err = os.Chmod(filename, dataFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to change the permissions of %s: %v", filename, err)
+	}
+
 	data := &jsonConnector{}
 	err = json.Unmarshal(raw, data)
 	if err != nil {
@@ -275,23 +307,90 @@ func loadJson(filename string, l *logger.Logger) (*jsonConnector, error) {
 		data.AuthMethods = make(map[int]*mpm.AuthMethod)
 	}
 
+	if data.Roles == nil {
+		data.Roles = make(map[int][]mpm.Capability)
+	}
+
+	if data.Audit == nil {
+		data.Audit = []*mpm.AuditEntry{}
+	}
+
+	if data.Revisions == nil {
+		data.Revisions = []*mpm.MovieRevision{}
+	}
+
 	return data, nil
 }
 
 func (j *jsonConnector) save() error {
+	// Everything is written through here, so this is where the search index
+	// goes stale.
+	j.searchIndex = nil
+
+	start := time.Now()
+	defer metricSaveDuration.ObserveSince(start)
+
 	raw, err := json.MarshalIndent(j, "", " ")
 	if err != nil {
 		return fmt.Errorf("Unable to marshal JSON data: %v", err)
 	}
 
-	err = ioutil.WriteFile(j.filename, raw, 0777)
+	err = writeFileAtomic(j.filename, raw)
 	if err != nil {
+		metricSaveErrors.Inc()
 		return fmt.Errorf("Unable to write JSON data: %v", err)
 	}
 
 	return nil
 }
 
+// The data file has secrets and password hashes in it.
+const dataFileMode os.FileMode = 0600
+
+// writeFileAtomic writes data to a new file next to filename and moves it in
+// place, so a failed write doesn't leave half a file behind, and the file
+// always ends up with dataFileMode.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Chmod(dataFileMode); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+var metricSaveDuration = metrics.NewHistogram("moviepolls_database_save_duration_seconds",
+	"Time taken to write the JSON data file.", metrics.DurationBuckets)
+var metricSaveErrors = metrics.NewCounter("moviepolls_database_save_errors_total",
+	"Number of times the JSON data file couldn't be written.")
+
+// Ping checks that the data file is still there and can be read.  Writes
+// are not checked, a failed write is reported when it happens.
+func (j *jsonConnector) Ping() error {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	f, err := os.Open(j.filename)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
 /*
    On determining the current cycle.
 
@@ -499,6 +598,10 @@ func (j *jsonConnector) GetActiveMovies() ([]*mpm.Movie, error) {
 	movies := []*mpm.Movie{}
 
 	for _, m := range j.Movies {
+		if m.Pending {
+			continue
+		}
+
 		mov, _ := j.GetMovie(m.Id)
 		if mov != nil && m.CycleWatchedId == 0 {
 			movies = append(movies, mov)
@@ -508,6 +611,42 @@ func (j *jsonConnector) GetActiveMovies() ([]*mpm.Movie, error) {
 	return movies, nil
 }
 
+func (j *jsonConnector) GetAllMovies() ([]*mpm.Movie, error) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	movies := []*mpm.Movie{}
+
+	for _, m := range j.Movies {
+		mov, _ := j.GetMovie(m.Id)
+		if mov != nil {
+			movies = append(movies, mov)
+		}
+	}
+
+	return movies, nil
+}
+
+func (j *jsonConnector) GetPendingMovies() ([]*mpm.Movie, error) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	movies := []*mpm.Movie{}
+
+	for _, m := range j.Movies {
+		if !m.Pending {
+			continue
+		}
+
+		mov := j.findMovie(m.Id)
+		if mov != nil {
+			movies = append(movies, mov)
+		}
+	}
+
+	return movies, nil
+}
+
 type sortableCycle []jsonCycle
 
 func (s sortableCycle) Len() int { return len(s) }
@@ -571,14 +710,17 @@ func (j *jsonConnector) movieFromJson(jMovie jsonMovie) *mpm.Movie {
 	}
 
 	movie := &mpm.Movie{
-		Id:          jMovie.Id,
-		Name:        jMovie.Name,
-		Description: jMovie.Description,
-		Duration:    jMovie.Duration,
-		Rating:      jMovie.Rating,
-		Remarks:     jMovie.Remarks,
-		Removed:     jMovie.Removed,
-		Approved:    jMovie.Approved,
+		Id:           jMovie.Id,
+		Name:         jMovie.Name,
+		Description:  jMovie.Description,
+		Duration:     jMovie.Duration,
+		Rating:       jMovie.Rating,
+		Remarks:      jMovie.Remarks,
+		Removed:      jMovie.Removed,
+		Approved:     jMovie.Approved,
+		Pending:      jMovie.Pending,
+		RejectReason: jMovie.RejectReason,
+		EditedFields: jMovie.EditedFields,
 		//CycleAdded:   j.findCycle(jMovie.CycleAddedId),
 		//CycleWatched: j.findCycle(jMovie.CycleWatchedId),
 		Links:   links,
@@ -597,7 +739,7 @@ func (j *jsonConnector) userFromJson(jUser jsonUser) *mpm.User {
 	for _, id := range jUser.AuthMethods {
 		a, ok := j.AuthMethods[id]
 		if ok {
-			authMethods = append(authMethods, a)
+			authMethods = append(authMethods, j.openAuthMethod(a))
 		}
 	}
 
@@ -929,6 +1071,10 @@ func (j *jsonConnector) AddVote(userId, movieId int) error {
 		return fmt.Errorf("Movie has been removed by a mod or admin")
 	}
 
+	if movie.Pending {
+		return fmt.Errorf("Movie is awaiting approval")
+	}
+
 	cc := j.currentCycle()
 	if cc == nil {
 		return fmt.Errorf("No cycle currently active")
@@ -948,7 +1094,7 @@ func (j *jsonConnector) AddTag(tag *mpm.Tag) (int, error) {
 
 	//duplicate check
 	for id, jtag := range j.Tags {
-		if strings.ToLower(tag.Name) == strings.ToLower(jtag.Name) {
+		if jtag.Matches(tag.Name) {
 			j.l.Debug("Tag '%v' is already in the database with id: %v", tag.Name, id)
 			return id, nil
 		}
@@ -970,7 +1116,12 @@ func (j *jsonConnector) AddAuthMethod(authMethod *mpm.AuthMethod) (int, error) {
 
 	authMethod.Id = id
 
-	j.AuthMethods[id] = authMethod
+	sealed, err := j.sealAuthMethod(authMethod)
+	if err != nil {
+		return 0, err
+	}
+
+	j.AuthMethods[id] = sealed
 	return id, j.save()
 }
 
@@ -978,10 +1129,8 @@ func (j *jsonConnector) FindTag(name string) (int, error) {
 	j.lock.RLock()
 	defer j.lock.RUnlock()
 
-	name = strings.ToLower(name)
-
 	for id, tag := range j.Tags {
-		if strings.ToLower(tag.Name) == name {
+		if tag.Matches(name) {
 			return id, nil
 		}
 	}
@@ -994,10 +1143,111 @@ func (j *jsonConnector) GetTag(id int) *mpm.Tag {
 	return j.Tags[id]
 }
 
+func (j *jsonConnector) GetTags() ([]*mpm.Tag, error) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	tags := []*mpm.Tag{}
+	for _, tag := range j.Tags {
+		t := *tag
+		t.Aliases = append([]string{}, tag.Aliases...)
+		tags = append(tags, &t)
+	}
+	return tags, nil
+}
+
+func (j *jsonConnector) UpdateTag(tag *mpm.Tag) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if _, ok := j.Tags[tag.Id]; !ok {
+		return fmt.Errorf("No tag with Id %d found.", tag.Id)
+	}
+
+	if tag.Name == "" {
+		return fmt.Errorf("Name cannot be empty")
+	}
+
+	for id, other := range j.Tags {
+		if id == tag.Id {
+			continue
+		}
+
+		for _, name := range append([]string{tag.Name}, tag.Aliases...) {
+			if other.Matches(name) {
+				return fmt.Errorf("%q is already used by the tag %q", name, other.Name)
+			}
+		}
+	}
+
+	t := *tag
+	t.Aliases = append([]string{}, tag.Aliases...)
+	j.Tags[tag.Id] = &t
+	return j.save()
+}
+
+func (j *jsonConnector) MergeTags(fromId, intoId int) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	from, ok := j.Tags[fromId]
+	if !ok {
+		return fmt.Errorf("No tag with Id %d found.", fromId)
+	}
+
+	into, ok := j.Tags[intoId]
+	if !ok {
+		return fmt.Errorf("No tag with Id %d found.", intoId)
+	}
+
+	if fromId == intoId {
+		return fmt.Errorf("Cannot merge a tag into itself")
+	}
+
+	for mid, movie := range j.Movies {
+		tags := []int{}
+		hasInto := false
+		changed := false
+		for _, id := range movie.Tags {
+			if id == fromId {
+				id = intoId
+				changed = true
+			}
+
+			if id == intoId {
+				if hasInto {
+					continue
+				}
+				hasInto = true
+			}
+			tags = append(tags, id)
+		}
+
+		if changed {
+			movie.Tags = tags
+			j.Movies[mid] = movie
+		}
+	}
+
+	for _, name := range append([]string{from.Name}, from.Aliases...) {
+		if !into.Matches(name) {
+			into.Aliases = append(into.Aliases, name)
+		}
+	}
+
+	delete(j.Tags, fromId)
+	return j.save()
+}
+
 func (j *jsonConnector) GetAuthMethod(id int) *mpm.AuthMethod {
 	j.lock.RLock()
 	defer j.lock.RUnlock()
-	return j.AuthMethods[id]
+
+	auth, ok := j.AuthMethods[id]
+	if !ok {
+		return nil
+	}
+	return j.openAuthMethod(auth)
 }
 
 func (j *jsonConnector) UpdateAuthMethod(authMethod *mpm.AuthMethod) error {
@@ -1010,9 +1260,14 @@ func (j *jsonConnector) UpdateAuthMethod(authMethod *mpm.AuthMethod) error {
 		return fmt.Errorf("No AuthMethod with Id %d found.", authMethod.Id)
 	}
 
-	j.l.Debug("Setting AuthMethod with ID %d to %v", authMethod.Id, authMethod)
+	j.l.Debug("Setting AuthMethod with ID %d", authMethod.Id)
+
+	sealed, err := j.sealAuthMethod(authMethod)
+	if err != nil {
+		return err
+	}
 
-	j.AuthMethods[authMethod.Id] = authMethod
+	j.AuthMethods[authMethod.Id] = sealed
 	return j.save()
 }
 func (j *jsonConnector) DeleteTag(id int) {
@@ -1325,6 +1580,87 @@ func (v configValue) String() string {
 	return fmt.Sprintf("configValue{Type:%s Value:%v}", t, v.Value)
 }
 
+func (j *jsonConnector) GetRoleCapabilities(role mpm.PrivilegeLevel) ([]mpm.Capability, error) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	caps, ok := j.Roles[int(role)]
+	if !ok {
+		return nil, ErrNoValue
+	}
+
+	return append([]mpm.Capability{}, caps...), nil
+}
+
+func (j *jsonConnector) SetRoleCapabilities(role mpm.PrivilegeLevel, caps []mpm.Capability) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.Roles[int(role)] = append([]mpm.Capability{}, caps...)
+	return j.save()
+}
+
+func (j *jsonConnector) AddAuditEntry(entry *mpm.AuditEntry) (int, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	e := *entry
+	e.Id = len(j.Audit) + 1
+	e.Changes = append([]mpm.AuditChange{}, entry.Changes...)
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	j.Audit = append(j.Audit, &e)
+	return e.Id, j.save()
+}
+
+func (j *jsonConnector) GetAuditEntries(filter mpm.AuditFilter) ([]*mpm.AuditEntry, error) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	entries := []*mpm.AuditEntry{}
+	for i := len(j.Audit) - 1; i >= 0; i-- {
+		if filter.Match(j.Audit[i]) {
+			e := *j.Audit[i]
+			entries = append(entries, &e)
+		}
+	}
+
+	return entries, nil
+}
+
+func (j *jsonConnector) AddMovieRevision(rev *mpm.MovieRevision) (int, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	r := *rev
+	r.Id = len(j.Revisions) + 1
+	r.Links = append([]string{}, rev.Links...)
+	if r.Timestamp.IsZero() {
+		r.Timestamp = time.Now()
+	}
+
+	j.Revisions = append(j.Revisions, &r)
+	return r.Id, j.save()
+}
+
+func (j *jsonConnector) GetMovieRevisions(movieId int) ([]*mpm.MovieRevision, error) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	revisions := []*mpm.MovieRevision{}
+	for i := len(j.Revisions) - 1; i >= 0; i-- {
+		if j.Revisions[i].MovieId == movieId {
+			r := *j.Revisions[i]
+			r.Links = append([]string{}, j.Revisions[i].Links...)
+			revisions = append(revisions, &r)
+		}
+	}
+
+	return revisions, nil
+}
+
 func (j *jsonConnector) GetCfgString(key, value string) (string, error) {
 	j.lock.RLock()
 	defer j.lock.RUnlock()
@@ -1336,7 +1672,7 @@ func (j *jsonConnector) GetCfgString(key, value string) (string, error) {
 
 	switch val.Type {
 	case CVT_STRING:
-		return val.Value.(string), nil
+		return j.openValue(val.Value.(string))
 	case CVT_INT:
 		return "", fmt.Errorf("%q is an INT key, not a STRING key", key)
 	case CVT_BOOL:
@@ -1403,6 +1739,14 @@ func (j *jsonConnector) SetCfgString(key, value string) error {
 	j.lock.Lock()
 	defer j.lock.Unlock()
 
+	if j.secretKeys[key] {
+		sealed, err := j.sealValue(value)
+		if err != nil {
+			return err
+		}
+		value = sealed
+	}
+
 	j.Settings[key] = configValue{CVT_STRING, value}
 
 	return j.save()
@@ -1426,6 +1770,157 @@ func (j *jsonConnector) SetCfgBool(key string, value bool) error {
 	return j.save()
 }
 
+// sealValue encrypts a secret for storing.  Without a box, or if it's empty,
+// it's stored as is.
+func (j *jsonConnector) sealValue(val string) (string, error) {
+	if j.box == nil || val == "" || IsSealed(val) {
+		return val, nil
+	}
+	return j.box.Seal(val)
+}
+
+func (j *jsonConnector) openValue(val string) (string, error) {
+	if !IsSealed(val) {
+		return val, nil
+	}
+	if j.box == nil {
+		return "", ErrNoSecretKey
+	}
+	return j.box.Open(val)
+}
+
+// sealAuthMethod returns a copy of auth with the tokens encrypted.  A copy is
+// stored so the caller can't change the stored one by accident.
+func (j *jsonConnector) sealAuthMethod(auth *mpm.AuthMethod) (*mpm.AuthMethod, error) {
+	sealed := *auth
+
+	var err error
+	if sealed.AuthToken, err = j.sealValue(auth.AuthToken); err != nil {
+		return nil, err
+	}
+	if sealed.RefreshToken, err = j.sealValue(auth.RefreshToken); err != nil {
+		return nil, err
+	}
+	return &sealed, nil
+}
+
+// openAuthMethod returns a copy of auth with the tokens decrypted.  Tokens
+// that can't be decrypted are logged and left empty.
+func (j *jsonConnector) openAuthMethod(auth *mpm.AuthMethod) *mpm.AuthMethod {
+	opened := *auth
+
+	var err error
+	if opened.AuthToken, err = j.openValue(auth.AuthToken); err != nil {
+		j.l.Error("Unable to decrypt the auth token of AuthMethod %d: %v", auth.Id, err)
+	}
+	if opened.RefreshToken, err = j.openValue(auth.RefreshToken); err != nil {
+		j.l.Error("Unable to decrypt the refresh token of AuthMethod %d: %v", auth.Id, err)
+	}
+	return &opened
+}
+
+func (j *jsonConnector) SetSecretBox(box SecretBox, secretKeys []string) (int, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.box = box
+	j.secretKeys = map[string]bool{}
+	for _, key := range secretKeys {
+		j.secretKeys[key] = true
+	}
+
+	if box == nil {
+		return 0, nil
+	}
+
+	return j.resealSecrets(func(val string) (string, error) {
+		return val, nil
+	})
+}
+
+func (j *jsonConnector) RotateSecretBox(box SecretBox) (int, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	// Decrypt with the old box, encrypt with the new one
+	old := j.box
+	j.box = box
+
+	count, err := j.resealSecrets(func(val string) (string, error) {
+		if !IsSealed(val) {
+			return val, nil
+		}
+		if old == nil {
+			return "", ErrNoSecretKey
+		}
+		return old.Open(val)
+	})
+
+	if err != nil {
+		j.box = old
+	}
+	return count, err
+}
+
+// resealSecrets passes every secret through open and encrypts the result
+// with the current box.  Values that are encrypted already are not touched,
+// unless open decrypts them.  Nothing is changed if there is an error.
+func (j *jsonConnector) resealSecrets(open func(string) (string, error)) (int, error) {
+	count := 0
+	reseal := func(val string) (string, error) {
+		plain, err := open(val)
+		if err != nil {
+			return "", err
+		}
+		if IsSealed(plain) || plain == "" {
+			return plain, nil
+		}
+		count++
+		return j.sealValue(plain)
+	}
+
+	settings := map[string]configValue{}
+	for key := range j.secretKeys {
+		val, ok := j.Settings[key]
+		if !ok || val.Type != CVT_STRING {
+			continue
+		}
+
+		sealed, err := reseal(val.Value.(string))
+		if err != nil {
+			return 0, fmt.Errorf("Unable to encrypt %s: %v", key, err)
+		}
+		settings[key] = configValue{CVT_STRING, sealed}
+	}
+
+	auths := map[int]*mpm.AuthMethod{}
+	for id, auth := range j.AuthMethods {
+		sealed := *auth
+
+		var err error
+		if sealed.AuthToken, err = reseal(auth.AuthToken); err != nil {
+			return 0, fmt.Errorf("Unable to encrypt the auth token of AuthMethod %d: %v", id, err)
+		}
+		if sealed.RefreshToken, err = reseal(auth.RefreshToken); err != nil {
+			return 0, fmt.Errorf("Unable to encrypt the refresh token of AuthMethod %d: %v", id, err)
+		}
+		auths[id] = &sealed
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	for key, val := range settings {
+		j.Settings[key] = val
+	}
+	for id, auth := range auths {
+		j.AuthMethods[id] = auth
+	}
+
+	return count, j.save()
+}
+
 func (j *jsonConnector) DeleteCfgKey(key string) error {
 	j.lock.Lock()
 	defer j.lock.Unlock()
@@ -1472,31 +1967,52 @@ func (j *jsonConnector) PurgeUser(userId int) error {
 	return j.save()
 }
 
-func (j *jsonConnector) SearchMovieTitles(query string) ([]*mpm.Movie, error) {
+func (j *jsonConnector) SearchMovies(query mpm.SearchQuery) ([]*mpm.SearchResult, error) {
 	j.lock.RLock()
 	defer j.lock.RUnlock()
 
-	found := []*mpm.Movie{}
-	query = strings.ToLower(query)
-	words := strings.Split(query, " ")
+	scores := j.getSearchIndex().search(query.Text)
+	if scores == nil && len(mpm.Tokenize(query.Text)) > 0 {
+		scores = map[int]float64{}
+	}
 
-	for _, movie := range j.Movies {
-		ok := true
-		for _, word := range words {
-			if !strings.Contains(strings.ToLower(movie.Name), word) {
-				ok = false
-				break
-			}
+	results := []*mpm.SearchResult{}
+	for _, m := range j.Movies {
+		score, ok := scores[m.Id]
+		if scores != nil && !ok {
+			continue
 		}
 
-		if ok {
-			m := j.findMovie(movie.Id)
-			m.Votes = j.findVotes(m)
-			found = append(found, m)
+		movie := j.findMovie(m.Id)
+		if movie == nil || !query.Match(movie) {
+			continue
 		}
+		movie.Votes = j.findVotes(movie)
+
+		results = append(results, &mpm.SearchResult{Movie: movie, Score: score})
 	}
 
-	return found, nil
+	sortSearchResults(results)
+	return results, nil
+}
+
+// getSearchIndex returns the search index, building it again if anything
+// has been saved since it was last built.  The caller must hold at least the
+// read lock.
+func (j *jsonConnector) getSearchIndex() *searchIndex {
+	j.indexLock.Lock()
+	defer j.indexLock.Unlock()
+
+	if j.searchIndex == nil {
+		movies := []*mpm.Movie{}
+		for _, m := range j.Movies {
+			if movie := j.findMovie(m.Id); movie != nil {
+				movies = append(movies, movie)
+			}
+		}
+		j.searchIndex = newSearchIndex(movies)
+	}
+	return j.searchIndex
 }
 
 func (j *jsonConnector) DeleteCycle(cycleId int) error {
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+)
+
+// Data files made by older versions were readable by everyone.
+func Test_JsonFileMode(t *testing.T) {
+	log := logger.NewSilent()
+
+	filename := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(filename, []byte(`{}`), 0777); err != nil {
+		t.Fatal(err)
+	}
+	// Not affected by the umask
+	if err := os.Chmod(filename, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	checkMode := func(when string) {
+		info, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected mode 0600 %s, got %o", when, info.Mode().Perm())
+		}
+	}
+
+	j, err := newJsonConnector(filename, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMode("after loading")
+
+	if err = os.Chmod(filename, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.SetCfgString("NoticeBanner", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	checkMode("after saving")
+
+	// Nothing left over from the save
+	files, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expected only the data file, got %d files", len(files))
+	}
+
+	j, err = newJsonConnector(filename, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, err := j.GetCfgString("NoticeBanner", ""); err != nil || val != "Hello" {
+		t.Errorf("Expected the saved value to be read back, got %q %v", val, err)
+	}
+}
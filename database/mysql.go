@@ -655,14 +655,27 @@ func (m *mysqlConnector) GetMoviesFromCycle(id int) ([]*common.Movie, error) {
 	return nil, fmt.Errorf("GetMoviesFromCycle() not implemented for MySQL")
 }
 
-func (m *mysqlConnector) SearchMovieTitles(query string) ([]*common.Movie, error) {
-	return nil, fmt.Errorf("SearchMovieTitles() not implemented for MySQL")
+// TODO: use a FULLTEXT index with MATCH() AGAINST() for the ranking.
+func (m *mysqlConnector) SearchMovies(query common.SearchQuery) ([]*common.SearchResult, error) {
+	return nil, fmt.Errorf("SearchMovies() not implemented for MySQL")
 }
 
 func (m *mysqlConnector) DecayVotes(age int) error {
 	return fmt.Errorf("DecayVotes() not implemented for MySQL")
 }
 
+func (m *mysqlConnector) SetSecretBox(box SecretBox, secretKeys []string) (int, error) {
+	return 0, fmt.Errorf("SetSecretBox() not implemented for MySQL")
+}
+
+func (m *mysqlConnector) RotateSecretBox(box SecretBox) (int, error) {
+	return 0, fmt.Errorf("RotateSecretBox() not implemented for MySQL")
+}
+
+func (m *mysqlConnector) Ping() error {
+	return m.db.Ping()
+}
+
 func (m *mysqlConnector) Test_GetUserVotes(userId int) ([]*common.Vote, error) {
 	return nil, fmt.Errorf("Test_GetUserVotes() not implemented for MySQL")
 }
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// How much a word counts towards the score depending on where it was found.
+var searchFieldWeights = struct {
+	Name        float64
+	Tags        float64
+	Links       float64
+	Description float64
+}{
+	Name:        10,
+	Tags:        5,
+	Links:       3,
+	Description: 1,
+}
+
+// Query words shorter than this only match whole words, longer ones match
+// the start of words too.
+const minPrefixLength int = 3
+
+// searchIndex is an inverted index over the movies for databases without
+// their own full-text search.
+type searchIndex struct {
+	// word -> movie ID -> weighted number of times the word appears
+	postings map[string]map[int]float64
+
+	// All the words in the index, sorted for prefix lookups
+	words []string
+
+	// Lower case movie names for phrase matches
+	names map[int]string
+}
+
+func newSearchIndex(movies []*models.Movie) *searchIndex {
+	idx := &searchIndex{
+		postings: map[string]map[int]float64{},
+		words:    []string{},
+		names:    map[int]string{},
+	}
+
+	for _, movie := range movies {
+		idx.names[movie.Id] = strings.ToLower(strings.TrimSpace(movie.Name))
+
+		idx.add(movie.Id, movie.Name, searchFieldWeights.Name)
+		idx.add(movie.Id, movie.Description, searchFieldWeights.Description)
+
+		for _, tag := range movie.Tags {
+			idx.add(movie.Id, tag.Name, searchFieldWeights.Tags)
+			for _, alias := range tag.Aliases {
+				idx.add(movie.Id, alias, searchFieldWeights.Tags)
+			}
+		}
+
+		for _, link := range movie.Links {
+			idx.add(movie.Id, link.Type, searchFieldWeights.Links)
+		}
+	}
+
+	for word := range idx.postings {
+		idx.words = append(idx.words, word)
+	}
+	sort.Strings(idx.words)
+
+	return idx
+}
+
+func (idx *searchIndex) add(id int, text string, weight float64) {
+	for _, word := range models.Tokenize(text) {
+		if idx.postings[word] == nil {
+			idx.postings[word] = map[int]float64{}
+		}
+		idx.postings[word][id] += weight
+	}
+}
+
+// search returns the score of every movie that matches all the words in
+// text.  Rare words count for more than common ones, and a movie named like
+// the whole query gets a boost.
+func (idx *searchIndex) search(text string) map[int]float64 {
+	words := models.Tokenize(text)
+	if len(words) == 0 {
+		return nil
+	}
+
+	total := float64(len(idx.names))
+	var scores map[int]float64
+
+	for _, word := range words {
+		matches := map[string]float64{word: 1}
+		if len(word) >= minPrefixLength {
+			start := sort.SearchStrings(idx.words, word)
+			for i := start; i < len(idx.words) && strings.HasPrefix(idx.words[i], word); i++ {
+				if idx.words[i] != word {
+					matches[idx.words[i]] = 0.5
+				}
+			}
+		}
+
+		wordScores := map[int]float64{}
+		for match, factor := range matches {
+			postings := idx.postings[match]
+			idf := math.Log(1 + total/float64(len(postings)+1))
+			for id, tf := range postings {
+				wordScores[id] += factor * idf * tf
+			}
+		}
+
+		// Every word has to match somewhere
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+
+		for id := range scores {
+			if s, ok := wordScores[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	phrase := strings.Join(words, " ")
+	for id := range scores {
+		name := strings.Join(models.Tokenize(idx.names[id]), " ")
+		if name == phrase {
+			scores[id] *= 2
+		} else if strings.Contains(name, phrase) {
+			scores[id] *= 1.5
+		}
+	}
+
+	return scores
+}
+
+// sortSearchResults orders results by score, then by name.
+func sortSearchResults(results []*models.SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return strings.ToLower(results[i].Movie.Name) < strings.ToLower(results[j].Movie.Name)
+	})
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+func newTestSearchIndex() *searchIndex {
+	return newSearchIndex([]*models.Movie{
+		{Id: 1, Name: "Akira", Description: "Neo-Tokyo is about to explode.",
+			Tags: []*models.Tag{{Name: "Anime", Aliases: []string{"Animation"}}}},
+		{Id: 2, Name: "Ghost in the Shell", Description: "A cyborg hunts a hacker in Neo-Tokyo.",
+			Links: []*models.Link{{Type: "MyAnimeList"}}},
+		{Id: 3, Name: "Tokyo Story", Description: "An old couple visits their children in Tokyo."},
+		{Id: 4, Name: "Tokyo", Description: "Three short films."},
+	})
+}
+
+func Test_SearchIndexMatches(t *testing.T) {
+	idx := newTestSearchIndex()
+
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"tokyo", []int{1, 2, 3, 4}},
+		{"TOKYO cyborg", []int{2}},
+		{"tok", []int{1, 2, 3, 4}},
+		{"sh", []int{}},
+		{"animation", []int{1}},
+		{"myanimelist", []int{2}},
+		{"akira zzz", []int{}},
+	}
+
+	for _, tt := range tests {
+		got := []int{}
+		for id := range idx.search(tt.text) {
+			got = append(got, id)
+		}
+		sort.Ints(got)
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.text, tt.want, got)
+		}
+	}
+
+	if scores := idx.search(" !? "); scores != nil {
+		t.Errorf("Expected nil for a query without words, got %v", scores)
+	}
+}
+
+func Test_SearchIndexScores(t *testing.T) {
+	idx := newTestSearchIndex()
+	scores := idx.search("tokyo")
+
+	// A movie named exactly like the query, then one with it in the name,
+	// then the descriptions.
+	if !(scores[4] > scores[3] && scores[3] > scores[1]) {
+		t.Errorf("Unexpected order of scores %v", scores)
+	}
+
+	// A whole word counts for more than a prefix
+	if whole, prefix := idx.search("akira")[1], idx.search("aki")[1]; whole <= prefix {
+		t.Errorf("Expected the whole word to score higher: %f <= %f", whole, prefix)
+	}
+}
+
+func Test_SortSearchResults(t *testing.T) {
+	results := []*models.SearchResult{
+		{Movie: &models.Movie{Name: "tokyo story"}, Score: 1},
+		{Movie: &models.Movie{Name: "Akira"}, Score: 1},
+		{Movie: &models.Movie{Name: "Ghost in the Shell"}, Score: 2},
+	}
+	sortSearchResults(results)
+
+	got := []string{}
+	for _, r := range results {
+		got = append(got, r.Movie.Name)
+	}
+
+	want := []string{"Ghost in the Shell", "Akira", "tokyo story"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
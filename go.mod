@@ -3,10 +3,13 @@ module github.com/zorchenhimer/MoviePolls
 go 1.23.4
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/gorilla/sessions v1.2.0
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/rivo/uniseg v0.1.0
+	golang.org/x/image v0.18.0
 	golang.org/x/oauth2 v0.0.0-20200902213428-5d25da1a8d43
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
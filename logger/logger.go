@@ -1,12 +1,15 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 type LogLevel string
@@ -18,6 +21,37 @@ const (
 	LLDebug  LogLevel = "debug"  // log everything
 )
 
+// All log levels, from the least to the most verbose.
+var LogLevels = []LogLevel{LLSilent, LLError, LLInfo, LLDebug}
+
+// The packages that get their own logger, see Package().  Their log level
+// can be changed separately at runtime.
+var Packages = []string{"web", "logic", "database", "chatbot"}
+
+func ParseLogLevel(str string) (LogLevel, error) {
+	level := LogLevel(strings.ToLower(str))
+	if level.rank() < 0 {
+		return "", fmt.Errorf("Invalid log level: %q", str)
+	}
+	return level, nil
+}
+
+func (l LogLevel) rank() int {
+	for i, level := range LogLevels {
+		if level == l {
+			return i
+		}
+	}
+	return -1
+}
+
+type LogFormat string
+
+const (
+	LFText LogFormat = "text" // a line per message with a prefix and the time
+	LFJson LogFormat = "json" // a JSON object per line
+)
+
 const (
 	logPrefixError string = "[ERROR] "
 	logPrefixInfo  string = "[INFO] "
@@ -25,100 +59,259 @@ const (
 )
 
 type Logger struct {
+	out *outputs
+
+	// Name of the package this logger is for, if any.  Used to look up the
+	// log level.
+	pkg string
+
+	// Key/value pairs added to every message, see With()
+	fields []interface{}
+}
+
+// outputs are shared by a logger and all the loggers derived from it.
+type outputs struct {
 	lInfo  *log.Logger
 	lError *log.Logger
 	lDebug *log.Logger
+
+	format LogFormat
+	file   *rotatingFile
+
+	lock   sync.RWMutex
+	level  LogLevel
+	levels map[string]LogLevel // per package, overrides level
 }
 
 func (l *Logger) Info(s string, v ...interface{}) {
-	if l.lInfo == nil {
-		return
+	l.print(l.out.lInfo, LLInfo, s, v)
+}
+
+func (l *Logger) Error(s string, v ...interface{}) {
+	l.print(l.out.lError, LLError, s, v)
+}
+
+func (l *Logger) Debug(s string, v ...interface{}) {
+	l.print(l.out.lDebug, LLDebug, s, v)
+}
+
+// With returns a logger that adds the given key/value pairs to every
+// message, eg l.With("request_id", id).  The new logger writes to the same
+// outputs as l.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "(missing)")
 	}
 
-	l.lInfo.Printf(s+"\n", v...)
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+
+	return &Logger{out: l.out, pkg: l.pkg, fields: fields}
 }
 
-func (l *Logger) Error(s string, v ...interface{}) {
-	if l.lError == nil {
-		return
+// Package returns a logger for the given package.  Its log level can be set
+// separately with SetLevel().
+func (l *Logger) Package(name string) *Logger {
+	return &Logger{out: l.out, pkg: name, fields: l.fields}
+}
+
+// SetLevel changes the log level of a package at runtime.  An empty package
+// name changes the default level, an empty level makes the package use the
+// default level again.
+func (l *Logger) SetLevel(pkg string, level LogLevel) error {
+	if level != "" && level.rank() < 0 {
+		return fmt.Errorf("Invalid log level: %q", level)
 	}
 
-	l.lError.Printf(s+"\n", v...)
+	l.out.lock.Lock()
+	defer l.out.lock.Unlock()
+
+	if pkg == "" {
+		if level == "" {
+			return fmt.Errorf("The default log level can't be empty")
+		}
+		l.out.level = level
+	} else if level == "" {
+		delete(l.out.levels, pkg)
+	} else {
+		l.out.levels[pkg] = level
+	}
+	return nil
 }
 
-func (l *Logger) Debug(s string, v ...interface{}) {
-	if l.lDebug == nil {
+// Level returns the log level of a package, and whether it's set for the
+// package or is the default.  An empty package name returns the default.
+func (l *Logger) Level(pkg string) (LogLevel, bool) {
+	l.out.lock.RLock()
+	defer l.out.lock.RUnlock()
+
+	if level, ok := l.out.levels[pkg]; ok {
+		return level, true
+	}
+	return l.out.level, false
+}
+
+// LogFile returns the path of the log file, or an empty string if only the
+// console is logged to.
+func (l *Logger) LogFile() string {
+	if l.out.file == nil {
+		return ""
+	}
+	return l.out.file.path
+}
+
+func (l *Logger) enabled(level LogLevel) bool {
+	current, _ := l.Level(l.pkg)
+	return level.rank() <= current.rank()
+}
+
+func (l *Logger) print(out *log.Logger, level LogLevel, s string, v []interface{}) {
+	if out == nil || !l.enabled(level) {
+		return
+	}
+
+	msg := fmt.Sprintf(s, v...)
+
+	if l.out.format == LFJson {
+		fields := l.fields
+		if l.pkg != "" {
+			fields = append([]interface{}{"package", l.pkg}, fields...)
+		}
+		out.Print(jsonLine(time.Now(), level, msg, fields))
 		return
 	}
 
-	l.lDebug.Printf(s+"\n", v...)
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for i := 0; i+1 < len(l.fields); i += 2 {
+		fmt.Fprintf(&sb, " %v=%v", l.fields[i], l.fields[i+1])
+	}
+	out.Print(sb.String() + "\n")
+}
+
+// jsonLine encodes a message as a single line of JSON.  The time, level and
+// message come first, followed by the fields in the order they were added.
+func jsonLine(t time.Time, level LogLevel, msg string, fields []interface{}) string {
+	var sb strings.Builder
+	sb.WriteString(`{"time":`)
+	sb.Write(jsonValue(t.Format(time.RFC3339Nano)))
+	sb.WriteString(`,"level":`)
+	sb.Write(jsonValue(string(level)))
+	sb.WriteString(`,"msg":`)
+	sb.Write(jsonValue(msg))
+
+	for i := 0; i+1 < len(fields); i += 2 {
+		sb.WriteString(",")
+		sb.Write(jsonValue(fmt.Sprint(fields[i])))
+		sb.WriteString(":")
+
+		val := fields[i+1]
+		if err, ok := val.(error); ok {
+			val = err.Error()
+		}
+		sb.Write(jsonValue(val))
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
 }
 
-func NewLogger(level LogLevel, file string) (*Logger, error) {
-	l := &Logger{}
-	baseDir := filepath.Dir(file)
-	err := os.MkdirAll(baseDir, 0755)
+func jsonValue(val interface{}) []byte {
+	raw, err := json.Marshal(val)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to create log directory %q: %w", baseDir, err)
+		raw, _ = json.Marshal(fmt.Sprint(val))
 	}
+	return raw
+}
+
+type Options struct {
+	Level    LogLevel
+	Format   LogFormat
+	File     string   // empty to only log to the console
+	Rotation Rotation // when to rotate File, never by default
+}
+
+func NewLogger(level LogLevel, format LogFormat, file string) (*Logger, error) {
+	return New(Options{Level: level, Format: format, File: file})
+}
 
-	switch LogLevel(strings.ToLower(string(level))) {
-	case LLSilent:
-		fmt.Println("[SILENT] Nothing to see here, please leave the area!")
-		return l, nil
+// NewSilent returns a logger that doesn't log anything, eg for tests.
+func NewSilent() *Logger {
+	l, err := New(Options{Level: LLSilent})
+	if err != nil {
+		// Neither the level nor the format can be invalid
+		panic(err)
+	}
+	return l
+}
 
-	case LLError:
-		fmt.Println(logPrefixError + "Logging enabled")
-		if file != "" {
-			f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
-				return nil, fmt.Errorf("Unable to open log file for writing: %s", err)
-			}
+func New(opts Options) (*Logger, error) {
+	level, err := ParseLogLevel(string(opts.Level))
+	if err != nil {
+		return nil, err
+	}
 
-			l.lError = log.New(io.MultiWriter(os.Stderr, f), logPrefixError, log.LstdFlags)
-		} else {
-			l.lError = log.New(os.Stderr, logPrefixError, log.LstdFlags)
+	out := &outputs{
+		format: LogFormat(strings.ToLower(string(opts.Format))),
+		level:  level,
+		levels: map[string]LogLevel{},
+	}
+	l := &Logger{out: out}
+
+	// The JSON lines have their own timestamp and level
+	prefixError, prefixInfo, prefixDebug := logPrefixError, logPrefixInfo, logPrefixDebug
+	flags := log.LstdFlags
+
+	switch out.format {
+	case "", LFText:
+		out.format = LFText
+	case LFJson:
+		prefixError, prefixInfo, prefixDebug = "", "", ""
+		flags = 0
+	default:
+		return nil, fmt.Errorf("Invalid log format: %q", opts.Format)
+	}
+
+	// Plain text messages would break the JSON output
+	if out.format == LFText {
+		switch level {
+		case LLSilent:
+			fmt.Println("[SILENT] Nothing to see here, please leave the area!")
+		case LLError:
+			fmt.Println(logPrefixError + "Logging enabled")
+		case LLInfo:
+			fmt.Println(logPrefixInfo + "Logging enabled")
+		case LLDebug:
+			fmt.Println(logPrefixDebug + "Logging enabled")
 		}
+	}
 
-	case LLInfo:
-		fmt.Println(logPrefixInfo + "Logging enabled")
-		if file != "" {
-			f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
-				return nil, fmt.Errorf("Unable to open log file for writing: %s", err)
-			}
-
-			l.lError = log.New(io.MultiWriter(os.Stderr, f), logPrefixError, log.LstdFlags)
-			l.lInfo = log.New(io.MultiWriter(os.Stdout, f), logPrefixInfo, log.LstdFlags)
-		} else {
-			l.lError = log.New(os.Stderr, logPrefixError, log.LstdFlags)
-			l.lInfo = log.New(os.Stdout, logPrefixInfo, log.LstdFlags)
+	// All outputs are set up even if the level doesn't need them, so the
+	// level can be raised at runtime.
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if opts.File != "" {
+		baseDir := filepath.Dir(opts.File)
+		err := os.MkdirAll(baseDir, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to create log directory %q: %w", baseDir, err)
 		}
 
-	case LLDebug:
-		fmt.Println(logPrefixDebug + "Logging enabled")
-
-		if file != "" {
-			f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
-				return nil, fmt.Errorf("Unable to open log file for writing: %s", err)
-			}
-
-			l.lError = log.New(io.MultiWriter(os.Stderr, f), logPrefixError, log.LstdFlags)
-			l.lInfo = log.New(io.MultiWriter(os.Stdout, f), logPrefixInfo, log.LstdFlags)
-			l.lDebug = log.New(io.MultiWriter(os.Stdout, f), logPrefixDebug, log.LstdFlags)
-		} else {
-			l.lError = log.New(os.Stderr, logPrefixError, log.LstdFlags)
-			l.lInfo = log.New(os.Stdout, logPrefixInfo, log.LstdFlags)
-			l.lDebug = log.New(os.Stdout, logPrefixDebug, log.LstdFlags)
+		out.file, err = newRotatingFile(opts.File, opts.Rotation)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to open log file for writing: %s", err)
 		}
 
-	default:
-		return nil, fmt.Errorf("Invalid log level: %q", level)
+		stdout = io.MultiWriter(os.Stdout, out.file)
+		stderr = io.MultiWriter(os.Stderr, out.file)
 	}
 
-	if file != "" {
-		l.Info("Logging to file " + file)
+	out.lError = log.New(stderr, prefixError, flags)
+	out.lInfo = log.New(stdout, prefixInfo, flags)
+	out.lDebug = log.New(stdout, prefixDebug, flags)
+
+	if opts.File != "" {
+		l.Info("Logging to file " + opts.File)
 	} else {
 		l.Info("Logging to console only")
 	}
@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_JsonLine(t *testing.T) {
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	line := jsonLine(ts, LLInfo, `Voted for "Akira"`, []interface{}{
+		"request_id", "abc123",
+		"movie", 47,
+		"error", errors.New("no votes left"),
+	})
+
+	if !strings.HasSuffix(line, "}\n") || strings.Count(line, "\n") != 1 {
+		t.Errorf("Expected a single line, got %q", line)
+	}
+
+	expected := `{"time":"2021-03-04T05:06:07Z","level":"info","msg":"Voted for \"Akira\"","request_id":"abc123","movie":47,"error":"no votes left"}`
+	if strings.TrimSpace(line) != expected {
+		t.Errorf("Expected %s, got %s", expected, line)
+	}
+
+	if !json.Valid([]byte(line)) {
+		t.Errorf("Invalid JSON: %s", line)
+	}
+}
+
+func Test_With(t *testing.T) {
+	l := &Logger{out: &outputs{format: LFJson}}
+	req := l.With("request_id", "abc123")
+	user := req.With("user")
+
+	if len(l.fields) != 0 {
+		t.Errorf("Expected the parent logger to be left alone, got %v", l.fields)
+	}
+
+	if len(user.fields) != 4 || user.fields[0] != "request_id" || user.fields[3] != "(missing)" {
+		t.Errorf("Unexpected fields %v", user.fields)
+	}
+}
+
+func Test_PackageLevels(t *testing.T) {
+	l := &Logger{out: &outputs{level: LLInfo, levels: map[string]LogLevel{}}}
+	web := l.Package("web").With("request_id", "abc123")
+	logic := l.Package("logic")
+
+	if web.enabled(LLDebug) || !web.enabled(LLInfo) {
+		t.Errorf("Expected packages to use the default level")
+	}
+
+	if err := l.SetLevel("web", LLDebug); err != nil {
+		t.Fatal(err)
+	}
+	if !web.enabled(LLDebug) || logic.enabled(LLDebug) {
+		t.Errorf("Expected only web to log debug messages")
+	}
+
+	if level, set := l.Level("web"); level != LLDebug || !set {
+		t.Errorf("Expected debug to be set for web, got %s %v", level, set)
+	}
+
+	l.SetLevel("", LLSilent)
+	l.SetLevel("web", "")
+	if web.enabled(LLError) || logic.enabled(LLError) {
+		t.Errorf("Expected everything to be silent")
+	}
+
+	if err := l.SetLevel("web", "loud"); err == nil {
+		t.Errorf("Expected an error for an invalid level")
+	}
+	if err := l.SetLevel("", ""); err == nil {
+		t.Errorf("Expected an error for an empty default level")
+	}
+}
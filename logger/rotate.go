@@ -0,0 +1,228 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rotation decides when the log file is rotated and how many old files are
+// kept.  The zero value never rotates.
+type Rotation struct {
+	MaxSize    int64         // in bytes, 0 for no limit
+	MaxAge     time.Duration // 0 for no limit
+	MaxBackups int           // rotated files to keep, 0 to keep all of them
+	Compress   bool          // gzip rotated files
+}
+
+// Rotated files are named after the log file with the time they were
+// rotated, eg server-2021-03-04T05-06-07.000.log.gz
+const backupTimeFormat string = "2006-01-02T15-04-05.000"
+
+// rotatingFile is an io.Writer that moves the log file out of the way when
+// it gets too big or too old and starts a new one.  Compressing and deleting
+// old files happens in the background.
+type rotatingFile struct {
+	path     string
+	rotation Rotation
+	now      func() time.Time
+
+	lock   sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	// Held while compressing and deleting rotated files
+	mill sync.Mutex
+}
+
+func newRotatingFile(path string, rotation Rotation) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, rotation: rotation, now: time.Now}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.file = f
+	rf.size = info.Size()
+
+	// There's no portable creation time, so the age of a file that's
+	// appended to after a restart is counted from its last change.
+	rf.opened = rf.now()
+	if rf.size > 0 {
+		rf.opened = info.ModTime()
+	}
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.shouldRotate(len(p)) {
+		if err := rf.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] Unable to rotate log file: %v\n", err)
+		}
+	}
+
+	if rf.file == nil {
+		return 0, fmt.Errorf("Log file %s is not open", rf.path)
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) shouldRotate(next int) bool {
+	if rf.size == 0 {
+		return false
+	}
+
+	if rf.rotation.MaxSize > 0 && rf.size+int64(next) > rf.rotation.MaxSize {
+		return true
+	}
+
+	return rf.rotation.MaxAge > 0 && rf.now().Sub(rf.opened) >= rf.rotation.MaxAge
+}
+
+// rotate renames the current file and opens a new one.  If the file can't
+// be renamed it's kept and appended to.
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	backup := rf.backupName(rf.now())
+	renameErr := os.Rename(rf.path, backup)
+
+	if err := rf.open(); err != nil {
+		rf.file = nil
+		return err
+	}
+
+	if renameErr != nil {
+		return renameErr
+	}
+
+	go rf.cleanup(backup)
+	return nil
+}
+
+func (rf *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(rf.path)
+	base := strings.TrimSuffix(rf.path, ext)
+	return fmt.Sprintf("%s-%s%s", base, t.Format(backupTimeFormat), ext)
+}
+
+// backups returns the rotated files, newest first.
+func (rf *rotatingFile) backups() ([]string, error) {
+	ext := filepath.Ext(rf.path)
+	prefix := filepath.Base(strings.TrimSuffix(rf.path, ext)) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(rf.path))
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]time.Time{}
+	names := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		if !strings.HasPrefix(stamp, prefix) || entry.IsDir() {
+			continue
+		}
+
+		t, err := time.Parse(backupTimeFormat, strings.TrimPrefix(stamp, prefix))
+		if err != nil {
+			// Some other file
+			continue
+		}
+
+		path := filepath.Join(filepath.Dir(rf.path), name)
+		found[path] = t
+		names = append(names, path)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return found[names[i]].After(found[names[j]])
+	})
+	return names, nil
+}
+
+// cleanup compresses a rotated file and deletes the ones that aren't kept.
+func (rf *rotatingFile) cleanup(backup string) {
+	rf.mill.Lock()
+	defer rf.mill.Unlock()
+
+	if rf.rotation.Compress {
+		if err := compressFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] Unable to compress %s: %v\n", backup, err)
+		}
+	}
+
+	if rf.rotation.MaxBackups <= 0 {
+		return
+	}
+
+	backups, err := rf.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] Unable to list rotated log files: %v\n", err)
+		return
+	}
+
+	for i := rf.rotation.MaxBackups; i < len(backups); i++ {
+		if err = os.Remove(backups[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] Unable to delete %s: %v\n", backups[i], err)
+		}
+	}
+}
+
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	in.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,109 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRotatingFile(t *testing.T, rotation Rotation) (*rotatingFile, *time.Time) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	rf := &rotatingFile{
+		path:     filepath.Join(t.TempDir(), "server.log"),
+		rotation: rotation,
+		now:      func() time.Time { return now },
+	}
+	if err := rf.open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rf.file.Close() })
+
+	return rf, &now
+}
+
+// waitForCleanup waits for the background compression and cleanup
+func waitForCleanup(rf *rotatingFile) {
+	time.Sleep(50 * time.Millisecond)
+	rf.mill.Lock()
+	rf.mill.Unlock()
+}
+
+func Test_RotateSize(t *testing.T) {
+	rf, now := testRotatingFile(t, Rotation{MaxSize: 20, MaxBackups: 2, Compress: true})
+
+	for _, line := range []string{"first line\n", "second line\n", "third line\n", "fourth line\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		*now = now.Add(time.Second)
+		waitForCleanup(rf)
+	}
+
+	backups, err := rf.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 rotated files, got %v", backups)
+	}
+
+	if !strings.HasSuffix(backups[0], "server-2021-03-04T05-06-10.000.log.gz") {
+		t.Errorf("Unexpected name for the newest file: %s", backups[0])
+	}
+
+	f, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "third line\n" {
+		t.Errorf("Expected the third line in the newest rotated file, got %q", raw)
+	}
+
+	current, _ := os.ReadFile(rf.path)
+	if string(current) != "fourth line\n" {
+		t.Errorf("Expected the fourth line in the log file, got %q", current)
+	}
+}
+
+func Test_RotateAge(t *testing.T) {
+	rf, now := testRotatingFile(t, Rotation{MaxAge: time.Hour})
+
+	rf.Write([]byte("old\n"))
+	*now = now.Add(30 * time.Minute)
+	rf.Write([]byte("still fine\n"))
+
+	if backups, _ := rf.backups(); len(backups) != 0 {
+		t.Fatalf("Expected no rotation yet, got %v", backups)
+	}
+
+	*now = now.Add(31 * time.Minute)
+	rf.Write([]byte("new\n"))
+	waitForCleanup(rf)
+
+	backups, _ := rf.backups()
+	if len(backups) != 1 || strings.HasSuffix(backups[0], ".gz") {
+		t.Fatalf("Expected one uncompressed rotated file, got %v", backups)
+	}
+
+	current, _ := os.ReadFile(rf.path)
+	if string(current) != "new\n" {
+		t.Errorf("Expected only the new line in the log file, got %q", current)
+	}
+}
@@ -3,17 +3,38 @@ package logic
 import (
 	"fmt"
 
+	"github.com/zorchenhimer/MoviePolls/database"
 	"github.com/zorchenhimer/MoviePolls/models"
 )
 
+// checkCanManageUser returns an error if admin isn't allowed to act on user.
+// Only admins can act on moderators and other admins, apart from their own
+// account.
+func checkCanManageUser(admin *models.User, user *models.User) error {
+	if admin != nil && admin.Id == user.Id {
+		return nil
+	}
+
+	if user.IsMod() && (admin == nil || !admin.IsAdmin()) {
+		return fmt.Errorf("Only admins can manage a %s", user.Privilege)
+	}
+	return nil
+}
+
 // Purge removes the account entirely, including all of the account's votes.
 // Should this add the user to the banlist?  Maybe add an option?
-func (b *backend) AdminPurgeUser(user *models.User) error {
+func (b *backend) AdminPurgeUser(admin *models.User, user *models.User) error {
+	if err := checkCanManageUser(admin, user); err != nil {
+		return err
+	}
+
 	b.l.Info("Purging user %s", user)
 	err := b.data.PurgeUser(user.Id)
 	if err != nil {
 		return err
 	}
+
+	b.Audit(admin, models.AUDIT_USER_PURGE, userTarget(user), userAuditFields(user), nil)
 	return nil
 }
 
@@ -23,18 +44,127 @@ func (b *backend) AdminBanUser(user *models.User) error {
 	return fmt.Errorf("not implemented")
 }
 
+// CheckAdminRights returns true if the user has access to at least one of the
+// admin pages.  Use HasCapability() to check access to a specific page.
 func (s *backend) CheckAdminRights(user *models.User) bool {
-	ok := true
-	if user == nil || user.Privilege < models.PRIV_MOD {
-		ok = false
+	return len(s.GetUserCapabilities(user)) > 0
+}
+
+// HasCapability checks the capabilities of the user's role.
+func (s *backend) HasCapability(user *models.User, capability models.Capability) bool {
+	for _, c := range s.GetUserCapabilities(user) {
+		if c == capability {
+			return true
+		}
 	}
-	return ok
+	return false
+}
+
+func (s *backend) GetUserCapabilities(user *models.User) []models.Capability {
+	if user == nil {
+		return []models.Capability{}
+	}
+
+	caps, err := s.GetRoleCapabilities(user.Privilege)
+	if err != nil {
+		s.l.Error("Unable to get capabilities for role %s: %v", user.Privilege, err)
+		return []models.Capability{}
+	}
+	return caps
+}
+
+// GetRoleCapabilities returns the capabilities of a role, falling back to the
+// defaults if they haven't been changed.  Admins always have everything.
+func (s *backend) GetRoleCapabilities(role models.PrivilegeLevel) ([]models.Capability, error) {
+	if role >= models.PRIV_ADMIN {
+		return models.DefaultCapabilities(models.PRIV_ADMIN), nil
+	}
+
+	caps, err := s.data.GetRoleCapabilities(role)
+	if err == database.ErrNoValue {
+		return models.DefaultCapabilities(role), nil
+	}
+	return caps, err
+}
+
+func (s *backend) SetRoleCapabilities(admin *models.User, role models.PrivilegeLevel, caps []models.Capability) error {
+	if role >= models.PRIV_ADMIN {
+		return fmt.Errorf("The capabilities of the %s role cannot be changed", role)
+	}
+
+	for _, c := range caps {
+		if !c.Valid() {
+			return fmt.Errorf("Unknown capability %q", c)
+		}
+	}
+
+	old, err := s.GetRoleCapabilities(role)
+	if err != nil {
+		return err
+	}
+
+	err = s.data.SetRoleCapabilities(role, caps)
+	if err != nil {
+		return err
+	}
+
+	before, after := capabilityAuditFields(old), capabilityAuditFields(caps)
+	if len(auditDiff(before, after)) > 0 {
+		s.Audit(admin, models.AUDIT_ROLE_UPDATE, fmt.Sprintf("role %s", role), before, after)
+	}
+	return nil
+}
+
+func capabilityAuditFields(caps []models.Capability) map[string]string {
+	fields := map[string]string{}
+	for _, c := range models.Capabilities {
+		fields[string(c)] = "false"
+	}
+	for _, c := range caps {
+		fields[string(c)] = "true"
+	}
+	return fields
+}
+
+// AdminSetUserRole changes the role of a user.  Only admins can do this, and
+// they cannot change their own role so there is always at least one admin.
+func (s *backend) AdminSetUserRole(admin *models.User, user *models.User, role models.PrivilegeLevel) error {
+	if admin == nil || !admin.IsAdmin() {
+		return fmt.Errorf("Only admins can change roles")
+	}
+
+	if admin.Id == user.Id {
+		return fmt.Errorf("You cannot change your own role")
+	}
+
+	if role < models.PRIV_USER || role > models.PRIV_ADMIN {
+		return fmt.Errorf("Unknown role %d", role)
+	}
+
+	s.l.Info("Changing role of user %s from %s to %s", user, user.Privilege, role)
+	before := userAuditFields(user)
+	user.Privilege = role
+
+	err := s.data.UpdateUser(user)
+	if err != nil {
+		return err
+	}
+
+	s.Audit(admin, models.AUDIT_USER_ROLE, userTarget(user), before, userAuditFields(user))
+	return nil
 }
 
 // "deletes" a user.  The account will still exist along with the votes, but
 // the name, password, email, and notification settings will all be removed.
-func (s *backend) AdminDeleteUser(user *models.User) error {
+func (s *backend) AdminDeleteUser(admin *models.User, user *models.User) error {
+	if err := checkCanManageUser(admin, user); err != nil {
+		return err
+	}
+
 	s.l.Info("Deleting user %s", user)
+	target := userTarget(user)
+	before := userAuditFields(user)
+
 	user.Name = "[deleted]"
 	for _, auth := range user.AuthMethods {
 		s.data.DeleteAuthMethod(auth.Id)
@@ -45,6 +175,11 @@ func (s *backend) AdminDeleteUser(user *models.User) error {
 	user.NotifyVoteSelection = false
 	user.Privilege = 0
 
-	return s.data.UpdateUser(user)
+	err := s.data.UpdateUser(user)
+	if err != nil {
+		return err
+	}
 
+	s.Audit(admin, models.AUDIT_USER_DELETE, target, before, userAuditFields(user))
+	return nil
 }
@@ -0,0 +1,61 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+func Test_ManageModerators(t *testing.T) {
+	b := newConfigBackend(t)
+
+	users := map[string]*models.User{}
+	for name, role := range map[string]models.PrivilegeLevel{
+		"admin": models.PRIV_ADMIN,
+		"mod":   models.PRIV_MOD,
+		"bob":   models.PRIV_USER,
+	} {
+		id, err := b.data.AddUser(&models.User{Name: name, Privilege: role})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if users[name], err = b.data.GetUser(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin, mod, bob := users["admin"], users["mod"], users["bob"]
+
+	if _, err := b.NewPasswordResetKey(mod, admin); err == nil {
+		t.Errorf("Expected a mod to be refused resetting the password of an admin")
+	}
+	if _, err := b.NewPasswordResetKey(bob, mod); err == nil {
+		t.Errorf("Expected a user to be refused resetting the password of a mod")
+	}
+
+	key, err := b.NewPasswordResetKey(mod, bob)
+	if err != nil {
+		t.Errorf("Unable to reset the password of a user as a mod: %v", err)
+	} else if key.UserId != bob.Id || key.Type != models.UKT_PasswordReset {
+		t.Errorf("Unexpected key %+v", key)
+	}
+
+	if _, err = b.NewPasswordResetKey(admin, mod); err != nil {
+		t.Errorf("Unable to reset the password of a mod as an admin: %v", err)
+	}
+
+	if err = b.AdminDeleteUser(mod, admin); err == nil {
+		t.Errorf("Expected a mod to be refused deleting an admin")
+	}
+	if stored, _ := b.data.GetUser(admin.Id); stored == nil || stored.Name != "admin" {
+		t.Errorf("Expected the admin to be left alone, got %v", stored)
+	}
+
+	if err = b.AdminPurgeUser(mod, admin); err == nil {
+		t.Errorf("Expected a mod to be refused purging an admin")
+	}
+
+	// Their own account is fine
+	if err = b.DeleteOwnAccount(mod, false); err != nil {
+		t.Errorf("Unable to delete own account as a mod: %v", err)
+	}
+}
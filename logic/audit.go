@@ -0,0 +1,164 @@
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// Audit adds an entry to the audit log.  The changes are the fields that
+// differ between before and after; either can be nil.  A failure to write the
+// entry is logged, but does not undo the action being audited.
+func (b *backend) Audit(actor *models.User, action models.AuditAction, target string, before, after map[string]string) {
+	entry := &models.AuditEntry{
+		Timestamp: time.Now(),
+		Action:    action,
+		Target:    target,
+		Changes:   auditDiff(before, after),
+	}
+
+	if actor != nil {
+		entry.ActorId = actor.Id
+		entry.ActorName = actor.Name
+	}
+
+	b.l.Info("[audit] %s %s %s", entry.ActorName, action, target)
+	if _, err := b.data.AddAuditEntry(entry); err != nil {
+		b.l.Error("Unable to add audit entry %s: %v", entry, err)
+	}
+}
+
+func (b *backend) GetAuditEntries(filter models.AuditFilter) ([]*models.AuditEntry, error) {
+	return b.data.GetAuditEntries(filter)
+}
+
+// GetConfigSnapshot returns the current value of every config key as a
+// string.  Pass it to AuditConfigChange() after saving the config.
+func (b *backend) GetConfigSnapshot() map[string]string {
+	values := map[string]string{}
+	for _, setting := range b.config.ordered {
+		v, err := b.configValue(setting)
+		if err != nil {
+			b.l.Error("Unable to get config value for %s: %v", setting.Key, err)
+			continue
+		}
+		values[setting.Key] = fmt.Sprintf("%v", v)
+	}
+	return values
+}
+
+// AuditConfigChange records the difference between a snapshot taken before
+// the config was changed and the current config.  Private values are not
+// written to the log, only the fact that they were changed.
+func (b *backend) AuditConfigChange(actor *models.User, before map[string]string) {
+	after := b.GetConfigSnapshot()
+	for _, setting := range b.config.ordered {
+		key := setting.Key
+		if setting.Type != ConfigStringPriv || before[key] == after[key] {
+			continue
+		}
+		before[key] = "[hidden]"
+		after[key] = "[hidden, changed]"
+	}
+
+	if len(auditDiff(before, after)) == 0 {
+		return
+	}
+	b.Audit(actor, models.AUDIT_CONFIG_UPDATE, "config", before, after)
+}
+
+func auditDiff(before, after map[string]string) []models.AuditChange {
+	fields := []string{}
+	for key := range before {
+		fields = append(fields, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []models.AuditChange{}
+	for _, field := range fields {
+		if before[field] != after[field] {
+			changes = append(changes, models.AuditChange{
+				Field:  field,
+				Before: before[field],
+				After:  after[field],
+			})
+		}
+	}
+	return changes
+}
+
+func movieTarget(movie *models.Movie) string {
+	return fmt.Sprintf("movie %d (%s)", movie.Id, movie.Name)
+}
+
+func tagTarget(tag *models.Tag) string {
+	return fmt.Sprintf("tag %d (%s)", tag.Id, tag.Name)
+}
+
+func userTarget(user *models.User) string {
+	return fmt.Sprintf("user %d (%s)", user.Id, user.Name)
+}
+
+func movieAuditFields(movie *models.Movie) map[string]string {
+	links := []string{}
+	for _, link := range movie.Links {
+		links = append(links, link.Url)
+	}
+
+	tags := []string{}
+	for _, tag := range movie.Tags {
+		tags = append(tags, tag.Name)
+	}
+
+	watched := ""
+	if movie.CycleWatched != nil {
+		watched = fmt.Sprintf("%d", movie.CycleWatched.Id)
+	}
+
+	return map[string]string{
+		"Name":         movie.Name,
+		"Description":  movie.Description,
+		"Remarks":      movie.Remarks,
+		"Duration":     movie.Duration,
+		"Rating":       fmt.Sprintf("%.1f", movie.Rating),
+		"Poster":       movie.Poster,
+		"Links":        strings.Join(links, " "),
+		"Tags":         strings.Join(tags, ", "),
+		"Removed":      fmt.Sprintf("%t", movie.Removed),
+		"Approved":     fmt.Sprintf("%t", movie.Approved),
+		"Pending":      fmt.Sprintf("%t", movie.Pending),
+		"RejectReason": movie.RejectReason,
+		"CycleWatched": watched,
+	}
+}
+
+func tagAuditFields(tag *models.Tag) map[string]string {
+	return map[string]string{
+		"Name":    tag.Name,
+		"Aliases": strings.Join(tag.Aliases, ", "),
+	}
+}
+
+func userAuditFields(user *models.User) map[string]string {
+	auths := []string{}
+	for _, auth := range user.AuthMethods {
+		auths = append(auths, string(auth.Type))
+	}
+
+	return map[string]string{
+		"Name":                user.Name,
+		"Email":               user.Email,
+		"Role":                user.Privilege.String(),
+		"NotifyCycleEnd":      fmt.Sprintf("%t", user.NotifyCycleEnd),
+		"NotifyVoteSelection": fmt.Sprintf("%t", user.NotifyVoteSelection),
+		"AuthMethods":         strings.Join(auths, ", "),
+	}
+}
@@ -3,33 +3,14 @@ package logic
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/zorchenhimer/MoviePolls/database"
 	"github.com/zorchenhimer/MoviePolls/models"
 )
 
-type ConfigValue struct {
-	Default interface{}
-	Value   interface{}
-	Type    ConfigValueType
-	Error   bool
-	Section string
-}
-
-type ConfigValueType int
-
-const (
-	ConfigInt ConfigValueType = iota
-	ConfigString
-	ConfigStringPriv
-	ConfigBool
-	ConfigKey
-)
-
-var ConfigValues = map[string]ConfigValue{}
-var ConfigSections = []string{}
-
 const GeneralSettings string = "General Settings"
 const ConfigHostAddress string = "HostAddress"
 const ConfigNoticeBanner string = "NoticeBanner"
@@ -49,8 +30,17 @@ const ConfigJikanBannedTypes string = "JikanBannedTypes"
 const ConfigJikanMaxEpisodes string = "JikanMaxEpisodes"
 const ConfigTmdbEnabled string = "TmdbEnabled"
 const ConfigTmdbToken string = "TmdbToken"
+const ConfigTmdbMaxEpisodes string = "TmdbMaxEpisodes"
+const ConfigAnilistEnabled string = "AnilistEnabled"
+const ConfigAnilistBannedFormats string = "AnilistBannedFormats"
+const ConfigAnilistMaxEpisodes string = "AnilistMaxEpisodes"
+const ConfigMetadataProviders string = "MetadataProviders"
+const ConfigMetadataRefreshInterval string = "MetadataRefreshInterval"
 const ConfigMaxMultEpLength string = "MaxMultEpLength"
 const ConfigMaxPosterSize string = "MaxPosterSize"
+const ConfigPosterSweepInterval string = "PosterSweepInterval"
+const ConfigDuplicateTitleDistance string = "DuplicateTitleDistance"
+const ConfigPosterSweepAutoDelete string = "PosterSweepAutoDelete"
 
 const Authentication string = "Authentication Settings"
 const ConfigLocalSignupEnabled string = "LocalSignupEnabled"
@@ -67,96 +57,311 @@ const ConfigPatreonOauthSignupEnabled string = "PatreonOauthSignupEnabled"
 const ConfigPatreonOauthClientID string = "PatreonOauthClientID"
 const ConfigPatreonOauthClientSecret string = "PatreonOauthClientSecret"
 
+const TwitchBot string = "Twitch Chat Bot Settings"
+const ConfigTwitchBotEnabled string = "TwitchBotEnabled"
+const ConfigTwitchBotServer string = "TwitchBotServer"
+const ConfigTwitchBotUsername string = "TwitchBotUsername"
+const ConfigTwitchBotOauthToken string = "TwitchBotOauthToken"
+const ConfigTwitchBotChannel string = "TwitchBotChannel"
+
 const Administration string = "Administration Settings"
 const ConfigMaxUserVotes string = "MaxUserVotes"
 const ConfigVotingEnabled string = "VotingEnabled"
 const ConfigEntriesRequireApproval string = "EntriesRequireApproval"
 const ConfigUnlimitedVotes string = "UnlimitedVotes"
 
-func (b *backend) setupConfig() {
-	// General Settings
-	ConfigSections = append(ConfigSections, GeneralSettings)
-	ConfigValues[ConfigHostAddress] = ConfigValue{Section: GeneralSettings, Default: "localhost", Type: ConfigString}
-	ConfigValues[ConfigNoticeBanner] = ConfigValue{Section: GeneralSettings, Default: "", Type: ConfigString}
-
-	// Field Limits
-	ConfigSections = append(ConfigSections, FieldLimits)
-	ConfigValues[ConfigMinNameLength] = ConfigValue{Section: FieldLimits, Default: 4, Type: ConfigInt}
-	ConfigValues[ConfigMaxNameLength] = ConfigValue{Section: FieldLimits, Default: 100, Type: ConfigInt}
-	ConfigValues[ConfigMaxTitleLength] = ConfigValue{Section: FieldLimits, Default: 100, Type: ConfigInt}
-	ConfigValues[ConfigMaxDescriptionLength] = ConfigValue{Section: FieldLimits, Default: 1000, Type: ConfigInt}
-	ConfigValues[ConfigMaxLinkLength] = ConfigValue{Section: FieldLimits, Default: 500, Type: ConfigInt}
-	ConfigValues[ConfigMaxRemarksLength] = ConfigValue{Section: FieldLimits, Default: 200, Type: ConfigInt}
-
-	// Movie Input
-	ConfigSections = append(ConfigSections, MovieInput)
-	ConfigValues[ConfigFormfillEnabled] = ConfigValue{Section: MovieInput, Default: true, Type: ConfigBool}
-	ConfigValues[ConfigJikanEnabled] = ConfigValue{Section: MovieInput, Default: false, Type: ConfigBool}
-	ConfigValues[ConfigJikanBannedTypes] = ConfigValue{Section: MovieInput, Default: "TV,music", Type: ConfigString}
-	ConfigValues[ConfigJikanMaxEpisodes] = ConfigValue{Section: MovieInput, Default: 1, Type: ConfigInt}
-	ConfigValues[ConfigTmdbEnabled] = ConfigValue{Section: MovieInput, Default: false, Type: ConfigBool}
-	ConfigValues[ConfigTmdbToken] = ConfigValue{Section: MovieInput, Default: "", Type: ConfigStringPriv}
-	ConfigValues[ConfigMaxMultEpLength] = ConfigValue{Section: MovieInput, Default: 120, Type: ConfigInt}
-	ConfigValues[ConfigMaxPosterSize] = ConfigValue{Section: MovieInput, Default: 50000, Type: ConfigInt}
-
-	// Authentication
-	ConfigSections = append(ConfigSections, Authentication)
-	ConfigValues[ConfigLocalSignupEnabled] = ConfigValue{Section: Authentication, Default: true, Type: ConfigBool}
-	ConfigValues[ConfigTwitchOauthEnabled] = ConfigValue{Section: Authentication, Default: false, Type: ConfigBool}
-	ConfigValues[ConfigTwitchOauthSignupEnabled] = ConfigValue{Section: Authentication, Default: false, Type: ConfigBool}
-	ConfigValues[ConfigTwitchOauthClientID] = ConfigValue{Section: Authentication, Default: "", Type: ConfigStringPriv}
-	ConfigValues[ConfigTwitchOauthClientSecret] = ConfigValue{Section: Authentication, Default: "", Type: ConfigStringPriv}
-	ConfigValues[ConfigDiscordOauthEnabled] = ConfigValue{Section: Authentication, Default: false, Type: ConfigBool}
-	ConfigValues[ConfigDiscordOauthSignupEnabled] = ConfigValue{Section: Authentication, Default: false, Type: ConfigBool}
-	ConfigValues[ConfigDiscordOauthClientID] = ConfigValue{Section: Authentication, Default: "", Type: ConfigStringPriv}
-	ConfigValues[ConfigDiscordOauthClientSecret] = ConfigValue{Section: Authentication, Default: "", Type: ConfigStringPriv}
-	ConfigValues[ConfigPatreonOauthEnabled] = ConfigValue{Section: Authentication, Default: false, Type: ConfigBool}
-	ConfigValues[ConfigPatreonOauthSignupEnabled] = ConfigValue{Section: Authentication, Default: false, Type: ConfigBool}
-	ConfigValues[ConfigPatreonOauthClientID] = ConfigValue{Section: Authentication, Default: "", Type: ConfigStringPriv}
-	ConfigValues[ConfigPatreonOauthClientSecret] = ConfigValue{Section: Authentication, Default: "", Type: ConfigStringPriv}
-
-	// Administration
-	ConfigSections = append(ConfigSections, Administration)
-	ConfigValues[ConfigMaxUserVotes] = ConfigValue{Section: Administration, Default: 5, Type: ConfigInt}
-	ConfigValues[ConfigVotingEnabled] = ConfigValue{Section: Administration, Default: false, Type: ConfigBool}
-	ConfigValues[ConfigEntriesRequireApproval] = ConfigValue{Section: Administration, Default: false, Type: ConfigBool}
-	ConfigValues[ConfigUnlimitedVotes] = ConfigValue{Section: Administration, Default: false, Type: ConfigBool}
-}
-
+const Monitoring string = "Monitoring Settings"
+const ConfigMetricsToken string = "MetricsToken"
+const ConfigMetricsAllowedIPs string = "MetricsAllowedIPs"
+
+const RateLimiting string = "Rate Limit Settings"
+const ConfigRateLimitLogin string = "RateLimitLogin"
+const ConfigRateLimitSignup string = "RateLimitSignup"
+const ConfigRateLimitVote string = "RateLimitVote"
+const ConfigRateLimitAdd string = "RateLimitAdd"
+const ConfigRateLimitSearch string = "RateLimitSearch"
+const ConfigLoginLockoutAttempts string = "LoginLockoutAttempts"
+const ConfigLoginLockoutMinutes string = "LoginLockoutMinutes"
+const ConfigTrustForwardedFor string = "TrustForwardedFor"
+
+// defaultConfig builds the registry of every setting the backend knows about.
+func defaultConfig() *configRegistry {
+	r := newConfigRegistry()
+
+	r.section(GeneralSettings,
+		&ConfigSetting{Key: ConfigHostAddress, Type: ConfigString, Default: "localhost",
+			Label:       "Host address",
+			Description: "The address the site is reached at.  Used for links in the OAuth callbacks.",
+		},
+		&ConfigSetting{Key: ConfigNoticeBanner, Type: ConfigString, Default: "",
+			Label:       "Notice banner",
+			Description: "Shown at the top of every page.  Leave empty to hide the banner.",
+		},
+	)
+
+	r.section(FieldLimits,
+		&ConfigSetting{Key: ConfigMinNameLength, Type: ConfigInt, Default: 4, Min: 1,
+			Label:       "Minimum name length",
+			Description: "Shortest allowed user name.",
+		},
+		&ConfigSetting{Key: ConfigMaxNameLength, Type: ConfigInt, Default: 100, Min: 1,
+			Label:       "Maximum name length",
+			Description: "Longest allowed user name.",
+		},
+		&ConfigSetting{Key: ConfigMaxTitleLength, Type: ConfigInt, Default: 100, Min: 1,
+			Label:       "Maximum title length",
+			Description: "Longest allowed movie title.",
+		},
+		&ConfigSetting{Key: ConfigMaxDescriptionLength, Type: ConfigInt, Default: 1000, Min: 1,
+			Label:       "Maximum description length",
+			Description: "Longest allowed movie description.",
+		},
+		&ConfigSetting{Key: ConfigMaxLinkLength, Type: ConfigInt, Default: 500, Min: 1,
+			Label:       "Maximum link length",
+			Description: "Longest allowed link on a movie.",
+		},
+		&ConfigSetting{Key: ConfigMaxRemarksLength, Type: ConfigInt, Default: 200, Min: 1,
+			Label:       "Maximum remarks length",
+			Description: "Longest allowed remarks on a movie.",
+		},
+	)
+
+	r.section(MovieInput,
+		&ConfigSetting{Key: ConfigFormfillEnabled, Type: ConfigBool, Default: true,
+			Label:       "Manual entry",
+			Description: "Allow users to fill in the movie details themselves instead of using a metadata provider.",
+		},
+		&ConfigSetting{Key: ConfigJikanEnabled, Type: ConfigBool, Default: false,
+			Label:       "MyAnimeList lookups",
+			Description: "Fill in the details of MyAnimeList links using the Jikan API.",
+		},
+		&ConfigSetting{Key: ConfigJikanBannedTypes, Type: ConfigString, Default: "TV,music",
+			Label:       "Banned MyAnimeList types",
+			Description: "Comma separated list of anime types that can't be added from MyAnimeList.",
+			Options:     []string{"TV", "OVA", "Movie", "Special", "ONA", "Music", "CM", "PV", "TV Special"},
+			List:        true,
+		},
+		&ConfigSetting{Key: ConfigJikanMaxEpisodes, Type: ConfigInt, Default: 1,
+			Label:       "Maximum MyAnimeList episodes",
+			Description: "Entries with more episodes than this can't be added from MyAnimeList.",
+		},
+		&ConfigSetting{Key: ConfigTmdbEnabled, Type: ConfigBool, Default: false,
+			Label:       "IMDb lookups",
+			Description: "Fill in the details of IMDb links using the TMDB API.  Needs a TMDB token.",
+		},
+		&ConfigSetting{Key: ConfigTmdbToken, Type: ConfigStringPriv, Default: "",
+			Label:       "TMDB token",
+			Description: "API read access token for TMDB.",
+		},
+		&ConfigSetting{Key: ConfigTmdbMaxEpisodes, Type: ConfigInt, Default: 1,
+			Label:       "Maximum TMDB episodes",
+			Description: "Shows with more episodes than this can't be added from IMDb links.",
+		},
+		&ConfigSetting{Key: ConfigAnilistEnabled, Type: ConfigBool, Default: false,
+			Label:       "AniList lookups",
+			Description: "Fill in the details of AniList links using the AniList API.",
+		},
+		&ConfigSetting{Key: ConfigAnilistBannedFormats, Type: ConfigString, Default: "TV,TV_SHORT,MUSIC",
+			Label:       "Banned AniList formats",
+			Description: "Comma separated list of formats that can't be added from AniList.",
+			Options:     []string{"TV", "TV_SHORT", "MOVIE", "SPECIAL", "OVA", "ONA", "MUSIC"},
+			List:        true,
+		},
+		&ConfigSetting{Key: ConfigAnilistMaxEpisodes, Type: ConfigInt, Default: 1,
+			Label:       "Maximum AniList episodes",
+			Description: "Entries with more episodes than this can't be added from AniList.",
+		},
+		&ConfigSetting{Key: ConfigMetadataProviders, Type: ConfigString, Default: "IMDb:tmdb,TMDB:tmdb,MyAnimeList:jikan,AniList:anilist",
+			Label:       "Metadata providers",
+			Description: "Comma separated list of <link type>:<provider> pairs, eg \"IMDb:tmdb\".",
+			Pattern:     regexp.MustCompile(`^([^:,]+:[^:,]+(,[^:,]+:[^:,]+)*)?$`),
+		},
+		&ConfigSetting{Key: ConfigMetadataRefreshInterval, Type: ConfigInt, Default: 24,
+			Label:       "Metadata refresh interval",
+			Description: "Hours between metadata refreshes of the active movies.  Zero disables the refresh.",
+		},
+		&ConfigSetting{Key: ConfigMaxMultEpLength, Type: ConfigInt, Default: 120,
+			Label:       "Maximum total runtime",
+			Description: "Longest allowed runtime in minutes of an entry with multiple episodes.",
+		},
+		&ConfigSetting{Key: ConfigMaxPosterSize, Type: ConfigInt, Default: 50000, Min: 1,
+			Label:       "Maximum poster size",
+			Description: "Largest allowed poster upload in bytes.",
+		},
+		&ConfigSetting{Key: ConfigPosterSweepInterval, Type: ConfigInt, Default: 24,
+			Label:       "Poster sweep interval",
+			Description: "Hours between sweeps for orphaned posters.  Zero disables the scheduled sweep.",
+		},
+		&ConfigSetting{Key: ConfigDuplicateTitleDistance, Type: ConfigInt, Default: 2, Max: 10,
+			Label:       "Duplicate title distance",
+			Description: "How many letters two titles can differ by and still be reported as possible duplicates.",
+		},
+		&ConfigSetting{Key: ConfigPosterSweepAutoDelete, Type: ConfigBool, Default: false,
+			Label:       "Delete orphaned posters",
+			Description: "Delete the posters found by the scheduled sweep instead of only reporting them.",
+		},
+	)
+
+	r.section(Authentication,
+		&ConfigSetting{Key: ConfigLocalSignupEnabled, Type: ConfigBool, Default: true,
+			Label:       "Local signup",
+			Description: "Allow signing up with a user name and password.",
+		},
+		&ConfigSetting{Key: ConfigTwitchOauthEnabled, Type: ConfigBool, Default: false,
+			Label:       "Twitch login",
+			Description: "Allow logging in with Twitch.  Needs the client ID and secret.",
+		},
+		&ConfigSetting{Key: ConfigTwitchOauthSignupEnabled, Type: ConfigBool, Default: false,
+			Label:       "Twitch signup",
+			Description: "Allow signing up with Twitch.",
+		},
+		&ConfigSetting{Key: ConfigTwitchOauthClientID, Type: ConfigStringPriv, Default: "",
+			Label: "Twitch client ID",
+		},
+		&ConfigSetting{Key: ConfigTwitchOauthClientSecret, Type: ConfigStringPriv, Default: "",
+			Label: "Twitch client secret",
+		},
+		&ConfigSetting{Key: ConfigDiscordOauthEnabled, Type: ConfigBool, Default: false,
+			Label:       "Discord login",
+			Description: "Allow logging in with Discord.  Needs the client ID and secret.",
+		},
+		&ConfigSetting{Key: ConfigDiscordOauthSignupEnabled, Type: ConfigBool, Default: false,
+			Label:       "Discord signup",
+			Description: "Allow signing up with Discord.",
+		},
+		&ConfigSetting{Key: ConfigDiscordOauthClientID, Type: ConfigStringPriv, Default: "",
+			Label: "Discord client ID",
+		},
+		&ConfigSetting{Key: ConfigDiscordOauthClientSecret, Type: ConfigStringPriv, Default: "",
+			Label: "Discord client secret",
+		},
+		&ConfigSetting{Key: ConfigPatreonOauthEnabled, Type: ConfigBool, Default: false,
+			Label:       "Patreon login",
+			Description: "Allow logging in with Patreon.  Needs the client ID and secret.",
+		},
+		&ConfigSetting{Key: ConfigPatreonOauthSignupEnabled, Type: ConfigBool, Default: false,
+			Label:       "Patreon signup",
+			Description: "Allow signing up with Patreon.",
+		},
+		&ConfigSetting{Key: ConfigPatreonOauthClientID, Type: ConfigStringPriv, Default: "",
+			Label: "Patreon client ID",
+		},
+		&ConfigSetting{Key: ConfigPatreonOauthClientSecret, Type: ConfigStringPriv, Default: "",
+			Label: "Patreon client secret",
+		},
+	)
+
+	r.section(TwitchBot,
+		&ConfigSetting{Key: ConfigTwitchBotEnabled, Type: ConfigBool, Default: false,
+			Label:       "Chat bot",
+			Description: "Connect a bot to Twitch chat that lets chatters vote with chat commands.",
+		},
+		&ConfigSetting{Key: ConfigTwitchBotServer, Type: ConfigString, Default: "irc.chat.twitch.tv:6697",
+			Label:       "IRC server",
+			Description: "Host and port of the Twitch chat server.",
+			Pattern:     regexp.MustCompile(`^[^\s:]+:[0-9]+$`),
+		},
+		&ConfigSetting{Key: ConfigTwitchBotUsername, Type: ConfigString, Default: "",
+			Label:       "Bot user name",
+			Description: "Twitch account the bot logs in as.",
+			Pattern:     regexp.MustCompile(`^\w*$`),
+		},
+		&ConfigSetting{Key: ConfigTwitchBotOauthToken, Type: ConfigStringPriv, Default: "",
+			Label:       "Bot OAuth token",
+			Description: "Chat token of the bot account.",
+		},
+		&ConfigSetting{Key: ConfigTwitchBotChannel, Type: ConfigString, Default: "",
+			Label:       "Channel",
+			Description: "Channel the bot joins, with or without the leading #.",
+			Pattern:     regexp.MustCompile(`^#?\w*$`),
+		},
+	)
+
+	r.section(Administration,
+		&ConfigSetting{Key: ConfigMaxUserVotes, Type: ConfigInt, Default: 5, Min: 1,
+			Label:       "Votes per user",
+			Description: "How many active votes each user has.",
+		},
+		&ConfigSetting{Key: ConfigVotingEnabled, Type: ConfigBool, Default: false,
+			Label:       "Voting",
+			Description: "Allow users to vote on movies.",
+		},
+		&ConfigSetting{Key: ConfigEntriesRequireApproval, Type: ConfigBool, Default: false,
+			Label:       "Require approval",
+			Description: "New movies have to be approved by a mod before they show up.",
+		},
+		&ConfigSetting{Key: ConfigUnlimitedVotes, Type: ConfigBool, Default: false,
+			Label:       "Unlimited votes",
+			Description: "Ignore the votes per user limit.",
+		},
+	)
+
+	r.section(Monitoring,
+		&ConfigSetting{Key: ConfigMetricsToken, Type: ConfigStringPriv, Default: "",
+			Label:       "Metrics token",
+			Description: "Bearer token that gives access to /metrics.",
+		},
+		&ConfigSetting{Key: ConfigMetricsAllowedIPs, Type: ConfigString, Default: "127.0.0.1,::1",
+			Label:       "Metrics allowed IPs",
+			Description: "Comma separated addresses or CIDR ranges that can get /metrics without the token.  Leave empty to require the token.",
+			Pattern:     regexp.MustCompile(`^[0-9a-fA-F.:/, ]*$`),
+		},
+	)
+
+	r.section(RateLimiting,
+		&ConfigSetting{Key: ConfigRateLimitLogin, Type: ConfigString, Default: "10/1m",
+			Label:       "Login limit",
+			Description: "Login attempts allowed per address, as <count>/<duration>, eg \"10/1m\".  Leave empty for no limit.",
+			Pattern:     rateLimitPattern,
+		},
+		&ConfigSetting{Key: ConfigRateLimitSignup, Type: ConfigString, Default: "5/1h",
+			Label:       "Signup limit",
+			Description: "Signup attempts allowed per address, as <count>/<duration>.  Leave empty for no limit.",
+			Pattern:     rateLimitPattern,
+		},
+		&ConfigSetting{Key: ConfigRateLimitVote, Type: ConfigString, Default: "30/1m",
+			Label:       "Vote limit",
+			Description: "Votes allowed per address and per user, as <count>/<duration>.  Leave empty for no limit.",
+			Pattern:     rateLimitPattern,
+		},
+		&ConfigSetting{Key: ConfigRateLimitAdd, Type: ConfigString, Default: "10/1h",
+			Label:       "Submission limit",
+			Description: "Movie submissions allowed per address and per user, as <count>/<duration>.  Leave empty for no limit.",
+			Pattern:     rateLimitPattern,
+		},
+		&ConfigSetting{Key: ConfigRateLimitSearch, Type: ConfigString, Default: "30/1m",
+			Label:       "Search limit",
+			Description: "Metadata searches and lookups on the add movie page allowed per address and per user, as <count>/<duration>.  Leave empty for no limit.",
+			Pattern:     rateLimitPattern,
+		},
+		&ConfigSetting{Key: ConfigLoginLockoutAttempts, Type: ConfigInt, Default: 5,
+			Label:       "Lockout attempts",
+			Description: "Failed logins in a row that lock a user name.  Zero disables the lockout.",
+		},
+		&ConfigSetting{Key: ConfigLoginLockoutMinutes, Type: ConfigInt, Default: 15, Min: 1,
+			Label:       "Lockout duration",
+			Description: "Minutes a user name stays locked after too many failed logins.",
+		},
+		&ConfigSetting{Key: ConfigTrustForwardedFor, Type: ConfigBool, Default: false,
+			Label:       "Trust X-Forwarded-For",
+			Description: "Limit clients by the last address in X-Forwarded-For instead of the connection.  Only turn this on behind a proxy that sets it.",
+		},
+	)
+
+	return r
+}
+
+// A rate limit, eg "10/1m"
+var rateLimitPattern = regexp.MustCompile(`^([0-9]+/[0-9]+(ms|s|m|h))?$`)
+
+// LoadDefaultsIfNotSet stores the default of every setting that hasn't been
+// set yet.
 func (b *backend) LoadDefaultsIfNotSet() error {
-	for key, configValue := range ConfigValues {
-		switch configValue.Type {
-		case ConfigInt:
-			_, err := b.data.GetCfgInt(key, configValue.Default.(int))
-			if errors.Is(err, database.ErrNoValue) {
-				err := b.data.SetCfgInt(key, configValue.Default.(int))
-				if err != nil {
-					return err
-				}
-			}
-		case ConfigString:
-			_, err := b.data.GetCfgString(key, configValue.Default.(string))
-			if errors.Is(err, database.ErrNoValue) {
-				err := b.data.SetCfgString(key, configValue.Default.(string))
-				if err != nil {
-					return err
-				}
-			}
-		case ConfigStringPriv:
-			_, err := b.data.GetCfgString(key, configValue.Default.(string))
-			if errors.Is(err, database.ErrNoValue) {
-				err := b.data.SetCfgString(key, configValue.Default.(string))
-				if err != nil {
-					return err
-				}
-			}
-		case ConfigBool:
-			_, err := b.data.GetCfgBool(key, configValue.Default.(bool))
-			if errors.Is(err, database.ErrNoValue) {
-				err := b.data.SetCfgBool(key, configValue.Default.(bool))
-				if err != nil {
-					return err
-				}
+	for _, setting := range b.config.ordered {
+		_, err := b.storedConfig(setting)
+		if errors.Is(err, database.ErrNoValue) {
+			if err = b.storeConfig(setting, setting.Default); err != nil {
+				return err
 			}
 		}
 	}
@@ -168,513 +373,264 @@ func (b *backend) CheckMovieExists(title string) (bool, error) {
 }
 
 func (b *backend) GetJikanEnabled() (bool, error) {
-	key := ConfigJikanEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[bool](b, ConfigJikanEnabled)
 }
 
 func (b *backend) GetTmdbEnabled() (bool, error) {
-	key := ConfigTmdbEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
+	return getConfig[bool](b, ConfigTmdbEnabled)
+}
 
-	return val, err
+func (b *backend) GetAnilistEnabled() (bool, error) {
+	return getConfig[bool](b, ConfigAnilistEnabled)
 }
 
-func (b *backend) GetTmdbToken() (string, error) {
-	key := ConfigTmdbToken
-	config, ok := ConfigValues[key]
-	if !ok {
-		return "", fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgString(key, config.Default.(string))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgString(key, config.Default.(string))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
+func (b *backend) GetAnilistBannedFormats() ([]string, error) {
+	val, err := getConfig[string](b, ConfigAnilistBannedFormats)
+	if err != nil {
+		return nil, err
 	}
+	return strings.Split(val, ","), nil
+}
 
-	return val, err
+func (b *backend) GetAnilistMaxEpisodes() (int, error) {
+	return getConfig[int](b, ConfigAnilistMaxEpisodes)
 }
 
-func (b *backend) GetFormFillEnabled() (bool, error) {
-	key := ConfigFormfillEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
+func (b *backend) GetTmdbToken() (string, error) {
+	return getConfig[string](b, ConfigTmdbToken)
+}
 
-	return val, err
+func (b *backend) GetFormFillEnabled() (bool, error) {
+	return getConfig[bool](b, ConfigFormfillEnabled)
 }
 
 func (b *backend) GetJikanBannedTypes() ([]string, error) {
-	key := ConfigJikanBannedTypes
-	config, ok := ConfigValues[key]
-	if !ok {
-		return nil, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgString(key, config.Default.(string))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgString(key, config.Default.(string))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return strings.Split(val, ","), nil
+	val, err := getConfig[string](b, ConfigJikanBannedTypes)
+	if err != nil {
+		return nil, err
 	}
-
-	return strings.Split(val, ","), err
+	return strings.Split(val, ","), nil
 }
 
 func (b *backend) GetMaxRemarksLength() (int, error) {
-	key := ConfigMaxRemarksLength
-	config, ok := ConfigValues[key]
-	if !ok {
-		return 0, fmt.Errorf("Could not find ConfigValue named %s", key)
+	return getConfig[int](b, ConfigMaxRemarksLength)
+}
+
+// GetMetadataProviders returns the metadata provider used for each link type.
+// The setting is a comma separated list of <link type>:<provider> pairs.
+func (b *backend) GetMetadataProviders() (map[string]string, error) {
+	key := ConfigMetadataProviders
+	val, err := getConfig[string](b, key)
+	if err != nil {
+		return nil, err
 	}
-	val, err := b.data.GetCfgInt(key, config.Default.(int))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgInt(key, config.Default.(int))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
+
+	providers := map[string]string{}
+	for _, pair := range strings.Split(val, ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			if strings.TrimSpace(pair) != "" {
+				b.l.Error("Invalid entry in %s: %q", key, pair)
+			}
+			continue
 		}
-		return val, nil
+		providers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
 	}
 
-	return val, err
+	return providers, nil
 }
 
-func (b *backend) GetJikanMaxEpisodes() (int, error) {
-	key := ConfigJikanMaxEpisodes
-	config, ok := ConfigValues[key]
-	if !ok {
-		return 0, fmt.Errorf("Could not find ConfigValue named %s", key)
+// A value in the database, not a setting, with the link types whose default
+// provider has been added to ConfigMetadataProviders.
+const metadataProvidersKnownKey string = "MetadataProvidersKnown"
+
+// The link types in the default of ConfigMetadataProviders before
+// metadataProvidersKnownKey was stored.
+const metadataProvidersKnownBefore string = "IMDb,MyAnimeList"
+
+// addNewMetadataProviders adds the default provider of each link type that's
+// new since the last start to the stored ConfigMetadataProviders, so existing
+// installs get providers added later, eg AniList.  Each link type is only
+// added once so providers an admin removes stay removed.
+func (b *backend) addNewMetadataProviders() error {
+	setting, err := b.config.get(ConfigMetadataProviders)
+	if err != nil {
+		return err
 	}
-	val, err := b.data.GetCfgInt(key, config.Default.(int))
+
+	known, err := b.data.GetCfgString(metadataProvidersKnownKey, "")
 	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgInt(key, config.Default.(int))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
+		known = metadataProvidersKnownBefore
+	} else if err != nil {
+		return err
 	}
 
-	return val, err
-}
+	stored, err := b.data.GetCfgString(setting.Key, setting.Default.(string))
+	if err != nil && !errors.Is(err, database.ErrNoValue) {
+		return err
+	}
 
-func (b *backend) GetMaxDuration() (int, error) {
-	key := ConfigMaxMultEpLength
-	config, ok := ConfigValues[key]
-	if !ok {
-		return 0, fmt.Errorf("Could not find ConfigValue named %s", key)
+	linkType := func(pair string) string {
+		return strings.TrimSpace(strings.SplitN(pair, ":", 2)[0])
 	}
-	val, err := b.data.GetCfgInt(key, config.Default.(int))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgInt(key, config.Default.(int))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
+
+	seen := map[string]bool{}
+	for _, t := range strings.Split(known, ",") {
+		seen[strings.TrimSpace(t)] = true
+	}
+	pairs := []string{}
+	for _, pair := range strings.Split(stored, ",") {
+		if strings.TrimSpace(pair) != "" {
+			pairs = append(pairs, pair)
+			seen[linkType(pair)] = true
 		}
-		return val, nil
 	}
 
-	return val, err
-}
-
-func (b *backend) GetMaxUploadlimit() (int, error) {
-	key := ConfigMaxPosterSize
-	config, ok := ConfigValues[key]
-	if !ok {
-		return 0, fmt.Errorf("Could not find ConfigValue named %s", key)
+	added := []string{}
+	defaultTypes := []string{}
+	for _, pair := range strings.Split(setting.Default.(string), ",") {
+		defaultTypes = append(defaultTypes, linkType(pair))
+		if !seen[linkType(pair)] {
+			added = append(added, pair)
+		}
 	}
-	val, err := b.data.GetCfgInt(key, config.Default.(int))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgInt(key, config.Default.(int))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
+
+	if len(added) > 0 {
+		value := strings.Join(append(pairs, added...), ",")
+		if err = b.data.SetCfgString(setting.Key, value); err != nil {
+			return err
 		}
-		return val, nil
+		b.l.Info("Added %s to %s", strings.Join(added, ","), setting.Key)
 	}
 
-	return val, err
+	return b.data.SetCfgString(metadataProvidersKnownKey, strings.Join(defaultTypes, ","))
 }
 
-func (b *backend) GetMaxLinkLength() (int, error) {
-	key := ConfigMaxLinkLength
-	config, ok := ConfigValues[key]
-	if !ok {
-		return 0, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgInt(key, config.Default.(int))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgInt(key, config.Default.(int))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
+// GetMetadataRefreshInterval returns the number of hours between metadata
+// refreshes of the active movies.  Zero disables the refresh.
+func (b *backend) GetMetadataRefreshInterval() (int, error) {
+	return getConfig[int](b, ConfigMetadataRefreshInterval)
+}
 
-	return val, err
+func (b *backend) GetJikanMaxEpisodes() (int, error) {
+	return getConfig[int](b, ConfigJikanMaxEpisodes)
 }
 
-func (b *backend) GetMaxTitleLength() (int, error) {
-	key := ConfigMaxTitleLength
-	config, ok := ConfigValues[key]
-	if !ok {
-		return 0, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgInt(key, config.Default.(int))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgInt(key, config.Default.(int))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
+func (b *backend) GetTmdbMaxEpisodes() (int, error) {
+	return getConfig[int](b, ConfigTmdbMaxEpisodes)
+}
 
-	return val, err
+func (b *backend) GetMaxDuration() (int, error) {
+	return getConfig[int](b, ConfigMaxMultEpLength)
 }
 
-func (b *backend) GetMaxNameLength() (int, error) {
-	key := ConfigMaxNameLength
-	config, ok := ConfigValues[key]
-	if !ok {
-		return 0, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgInt(key, config.Default.(int))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgInt(key, config.Default.(int))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
+// GetDuplicateTitleDistance returns the max number of edits between two
+// titles for them to be considered possible duplicates.
+func (b *backend) GetDuplicateTitleDistance() (int, error) {
+	return getConfig[int](b, ConfigDuplicateTitleDistance)
+}
 
-	return val, err
+// GetPosterSweepInterval returns the number of hours between scheduled
+// sweeps for orphaned posters.  Zero disables the scheduled sweep.
+func (b *backend) GetPosterSweepInterval() (int, error) {
+	return getConfig[int](b, ConfigPosterSweepInterval)
+}
 
+func (b *backend) GetPosterSweepAutoDelete() (bool, error) {
+	return getConfig[bool](b, ConfigPosterSweepAutoDelete)
 }
 
-func (b *backend) GetMinNameLength() (int, error) {
-	key := ConfigMinNameLength
-	config, ok := ConfigValues[key]
-	if !ok {
-		return 0, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgInt(key, config.Default.(int))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgInt(key, config.Default.(int))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
+func (b *backend) GetMaxUploadlimit() (int, error) {
+	return getConfig[int](b, ConfigMaxPosterSize)
+}
 
-	return val, err
+func (b *backend) GetMaxLinkLength() (int, error) {
+	return getConfig[int](b, ConfigMaxLinkLength)
 }
 
-func (b *backend) GetMaxDescriptionLength() (int, error) {
-	key := ConfigMaxDescriptionLength
-	config, ok := ConfigValues[key]
-	if !ok {
-		return 0, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgInt(key, config.Default.(int))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgInt(key, config.Default.(int))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
+func (b *backend) GetMaxTitleLength() (int, error) {
+	return getConfig[int](b, ConfigMaxTitleLength)
+}
+
+func (b *backend) GetMaxNameLength() (int, error) {
+	return getConfig[int](b, ConfigMaxNameLength)
+}
 
-	return val, err
+func (b *backend) GetMinNameLength() (int, error) {
+	return getConfig[int](b, ConfigMinNameLength)
+}
+
+func (b *backend) GetMaxDescriptionLength() (int, error) {
+	return getConfig[int](b, ConfigMaxDescriptionLength)
 }
 
 func (b *backend) AddMovieToDB(movie *models.Movie) (int, error) {
+	requireApproval, err := b.GetEntriesRequireApproval()
+	if err != nil {
+		return -1, err
+	}
+
+	movie.Pending = requireApproval
+	movie.Approved = !requireApproval
+
 	return b.data.AddMovie(movie)
 }
 
 // Oauth
 func (b *backend) GetLocalSignupEnabled() (bool, error) {
-	key := ConfigLocalSignupEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[bool](b, ConfigLocalSignupEnabled)
 }
 
 func (b *backend) GetTwitchOauthSignupEnabled() (bool, error) {
-	key := ConfigTwitchOauthSignupEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[bool](b, ConfigTwitchOauthSignupEnabled)
 }
 
 func (b *backend) GetTwitchOauthEnabled() (bool, error) {
-	key := ConfigTwitchOauthEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[bool](b, ConfigTwitchOauthEnabled)
 }
 
 func (b *backend) GetDiscordOauthSignupEnabled() (bool, error) {
-	key := ConfigDiscordOauthSignupEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[bool](b, ConfigDiscordOauthSignupEnabled)
 }
 
 func (b *backend) GetDiscordOauthEnabled() (bool, error) {
-	key := ConfigDiscordOauthEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[bool](b, ConfigDiscordOauthEnabled)
 }
 
 func (b *backend) GetPatreonOauthSignupEnabled() (bool, error) {
-	key := ConfigPatreonOauthSignupEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[bool](b, ConfigPatreonOauthSignupEnabled)
 }
 
 func (b *backend) GetPatreonOauthEnabled() (bool, error) {
-	key := ConfigPatreonOauthEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[bool](b, ConfigPatreonOauthEnabled)
 }
 
 func (b *backend) GetHostAddress() (string, error) {
-	key := ConfigHostAddress
-	config, ok := ConfigValues[key]
-	if !ok {
-		return "", fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgString(key, config.Default.(string))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgString(key, config.Default.(string))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[string](b, ConfigHostAddress)
 }
 
 func (b *backend) GetTwitchOauthClientID() (string, error) {
-	key := ConfigTwitchOauthClientID
-	config, ok := ConfigValues[key]
-	if !ok {
-		return "", fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgString(key, config.Default.(string))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgString(key, config.Default.(string))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[string](b, ConfigTwitchOauthClientID)
 }
 
 func (b *backend) GetTwitchOauthClientSecret() (string, error) {
-	key := ConfigTwitchOauthClientSecret
-	config, ok := ConfigValues[key]
-	if !ok {
-		return "", fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgString(key, config.Default.(string))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgString(key, config.Default.(string))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[string](b, ConfigTwitchOauthClientSecret)
 }
 
 func (b *backend) GetDiscordOauthClientID() (string, error) {
-	key := ConfigDiscordOauthClientID
-	config, ok := ConfigValues[key]
-	if !ok {
-		return "", fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgString(key, config.Default.(string))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgString(key, config.Default.(string))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[string](b, ConfigDiscordOauthClientID)
 }
 
 func (b *backend) GetDiscordOauthClientSecret() (string, error) {
-	key := ConfigDiscordOauthClientSecret
-	config, ok := ConfigValues[key]
-	if !ok {
-		return "", fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgString(key, config.Default.(string))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgString(key, config.Default.(string))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[string](b, ConfigDiscordOauthClientSecret)
 }
 
 func (b *backend) GetPatreonOauthClientID() (string, error) {
-	key := ConfigPatreonOauthClientID
-	config, ok := ConfigValues[key]
-	if !ok {
-		return "", fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgString(key, config.Default.(string))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgString(key, config.Default.(string))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[string](b, ConfigPatreonOauthClientID)
 }
 
 func (b *backend) GetPatreonOauthClientSecret() (string, error) {
-	key := ConfigPatreonOauthClientSecret
-	config, ok := ConfigValues[key]
-	if !ok {
-		return "", fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgString(key, config.Default.(string))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgString(key, config.Default.(string))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[string](b, ConfigPatreonOauthClientSecret)
 }
 
 func (b *backend) AddUser(user *models.User) (int, error) {
@@ -689,8 +645,27 @@ func (b *backend) CheckOauthUsage(id string, authType models.AuthType) bool {
 	return b.data.CheckOauthUsage(id, authType)
 }
 
+// UserLocalLogin checks a user name and password.  After too many failed
+// logins in a row the name is locked for a while.
 func (b *backend) UserLocalLogin(name string, passwd string) (*models.User, error) {
-	return b.data.UserLocalLogin(name, passwd)
+	if wait := b.limiter.lockedOut(name); wait > 0 {
+		return nil, fmt.Errorf("Too many failed logins, try again in %s", wait.Round(time.Second))
+	}
+
+	user, err := b.data.UserLocalLogin(name, passwd)
+	if err != nil {
+		attempts, duration, lerr := b.loginLockout()
+		if lerr != nil {
+			b.l.Error("Unable to get the login lockout settings: %v", lerr)
+		} else if b.limiter.loginFailed(name, attempts, duration) {
+			metricLoginLockouts.Inc()
+			b.l.Info("Locked user name %q for %s after %d failed logins", name, duration, attempts)
+		}
+		return nil, err
+	}
+
+	b.limiter.loginSucceeded(name)
+	return user, nil
 }
 
 func (b *backend) UserDiscordLogin(extid string) (*models.User, error) {
@@ -706,21 +681,7 @@ func (b *backend) UserTwitchLogin(extid string) (*models.User, error) {
 }
 
 func (b *backend) GetConfigBanner() (string, error) {
-	key := ConfigNoticeBanner
-	config, ok := ConfigValues[key]
-	if !ok {
-		return "", fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgString(key, config.Default.(string))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgString(key, config.Default.(string))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[string](b, ConfigNoticeBanner)
 }
 
 func (b *backend) SetHostAddress(host string) error {
@@ -752,31 +713,45 @@ func (b *backend) GetCfgString(key string, defVal string) (string, error) {
 }
 
 func (b *backend) GetEntriesRequireApproval() (bool, error) {
-	key := ConfigEntriesRequireApproval
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
+	return getConfig[bool](b, ConfigEntriesRequireApproval)
+}
 
-	return val, err
+// Twitch chat bot
+func (b *backend) GetTwitchBotEnabled() (bool, error) {
+	return getConfig[bool](b, ConfigTwitchBotEnabled)
 }
 
-func (b *backend) GetAutofillEnabled() (bool, error) {
-	jikan, err := b.GetJikanEnabled()
+func (b *backend) GetTwitchBotServer() (string, error) {
+	return getConfig[string](b, ConfigTwitchBotServer)
+}
+
+func (b *backend) GetTwitchBotUsername() (string, error) {
+	return getConfig[string](b, ConfigTwitchBotUsername)
+}
+
+func (b *backend) GetTwitchBotOauthToken() (string, error) {
+	return getConfig[string](b, ConfigTwitchBotOauthToken)
+}
+
+func (b *backend) GetTwitchBotChannel() (string, error) {
+	return getConfig[string](b, ConfigTwitchBotChannel)
+}
+
+func (b *backend) GetMetricsToken() (string, error) {
+	return getConfig[string](b, ConfigMetricsToken)
+}
+
+func (b *backend) GetMetricsAllowedIPs() ([]string, error) {
+	val, err := getConfig[string](b, ConfigMetricsAllowedIPs)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	tmdb, err := b.GetTmdbEnabled()
-	if err != nil {
-		return false, err
+
+	ips := []string{}
+	for _, ip := range strings.Split(val, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			ips = append(ips, ip)
+		}
 	}
-	return jikan || tmdb, nil
+	return ips, nil
 }
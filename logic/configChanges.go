@@ -0,0 +1,288 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// ExportConfig returns the current value of every setting that isn't
+// private as a JSON object, keyed by setting name.
+func (b *backend) ExportConfig() ([]byte, error) {
+	values := map[string]interface{}{}
+	for _, setting := range b.config.ordered {
+		if setting.Type == ConfigStringPriv {
+			continue
+		}
+
+		val, err := b.configValue(setting)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get config value for %s: %v", setting.Key, err)
+		}
+		values[setting.Key] = val
+	}
+
+	return json.MarshalIndent(values, "", "  ")
+}
+
+// ConfigImportChange is a setting that an import would change, or can't.
+type ConfigImportChange struct {
+	Key     string
+	Setting *ConfigSetting // nil for unknown settings
+	Before  string
+	After   string
+
+	// Why the value can't be imported.  Any error stops the whole import.
+	Error string
+
+	// Why the value is left out of the import, eg because it's locked.
+	Skipped string
+}
+
+// PreviewConfigImport compares an exported config with the current one.
+// Settings that wouldn't change are left out.
+func (b *backend) PreviewConfigImport(data []byte) ([]*ConfigImportChange, error) {
+	values := map[string]interface{}{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("Unable to read the config: %v", err)
+	}
+
+	locks := b.GetConfigLocks()
+	changes := []*ConfigImportChange{}
+
+	// Go through the registry so the preview has the same order as the
+	// config page.
+	for _, setting := range b.config.ordered {
+		raw, ok := values[setting.Key]
+		if !ok {
+			continue
+		}
+		delete(values, setting.Key)
+
+		change := &ConfigImportChange{
+			Key:     setting.Key,
+			Setting: setting,
+			After:   fmt.Sprintf("%v", raw),
+		}
+
+		current, err := b.configValue(setting)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get config value for %s: %v", setting.Key, err)
+		}
+		change.Before = fmt.Sprintf("%v", current)
+
+		if setting.Type == ConfigStringPriv {
+			change.Before = "[hidden]"
+			change.After = "[hidden]"
+			change.Error = "Private settings can't be imported"
+		} else if _, err := setting.Parse(change.After); err != nil {
+			change.Error = err.Error()
+		} else if change.Before == change.After {
+			continue
+		} else if source, locked := locks[setting.Key]; locked {
+			change.Skipped = fmt.Sprintf("Set by %s", source)
+		}
+
+		changes = append(changes, change)
+	}
+
+	for key, raw := range values {
+		changes = append(changes, &ConfigImportChange{
+			Key:   key,
+			After: fmt.Sprintf("%v", raw),
+			Error: "Unknown setting",
+		})
+	}
+
+	return changes, nil
+}
+
+// ImportConfig applies an exported config.  Nothing is changed if any value
+// can't be imported, and values already saved are put back if saving one
+// fails.
+func (b *backend) ImportConfig(admin *models.User, data []byte) ([]*ConfigImportChange, error) {
+	changes, err := b.PreviewConfigImport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		if change.Error != "" {
+			return changes, fmt.Errorf("%s: %s", change.Key, change.Error)
+		}
+	}
+
+	// Keep the current values to put back on a failure
+	snapshot := map[string]interface{}{}
+	for _, change := range changes {
+		if change.Skipped != "" {
+			continue
+		}
+
+		val, err := b.configValue(change.Setting)
+		if err != nil {
+			return changes, fmt.Errorf("Unable to get config value for %s: %v", change.Key, err)
+		}
+		snapshot[change.Key] = val
+	}
+
+	applied := []*ConfigImportChange{}
+	for _, change := range changes {
+		if change.Skipped != "" {
+			continue
+		}
+
+		if err = b.SetConfigValue(change.Key, change.After); err != nil {
+			b.restoreConfig(admin, applied, snapshot)
+			return changes, fmt.Errorf("Unable to save %s: %v", change.Key, err)
+		}
+		applied = append(applied, change)
+	}
+
+	if len(applied) > 0 {
+		before := map[string]string{}
+		after := map[string]string{}
+		for _, change := range applied {
+			before[change.Key] = change.Before
+			after[change.Key] = change.After
+		}
+		b.Audit(admin, models.AUDIT_CONFIG_IMPORT, "config", before, after)
+	}
+	return changes, nil
+}
+
+// restoreConfig puts back the values of a failed import.  Values that can't
+// be put back are audited, as they stay changed.
+func (b *backend) restoreConfig(admin *models.User, applied []*ConfigImportChange, snapshot map[string]interface{}) {
+	before := map[string]string{}
+	after := map[string]string{}
+	for _, change := range applied {
+		if err := b.storeConfig(change.Setting, snapshot[change.Key]); err != nil {
+			b.l.Error("Unable to restore %s after a failed import: %v", change.Key, err)
+			before[change.Key] = change.Before
+			after[change.Key] = change.After
+		}
+	}
+
+	if len(after) > 0 {
+		b.Audit(admin, models.AUDIT_CONFIG_IMPORT, "config", before, after)
+	}
+}
+
+// ConfigHistoryChange is a single setting changed by a config audit entry.
+type ConfigHistoryChange struct {
+	Entry   *models.AuditEntry
+	Change  models.AuditChange
+	Setting *ConfigSetting // nil if the setting doesn't exist anymore
+
+	// The change can be reverted: the setting exists, isn't private or
+	// locked, and doesn't already have the old value.
+	Revertable bool
+}
+
+// GetConfigHistory returns every change made to the config, newest first.
+func (b *backend) GetConfigHistory() ([]*ConfigHistoryChange, error) {
+	entries, err := b.configAuditEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	locks := b.GetConfigLocks()
+	history := []*ConfigHistoryChange{}
+
+	for _, entry := range entries {
+		for _, change := range entry.Changes {
+			hc := &ConfigHistoryChange{Entry: entry, Change: change}
+
+			setting, err := b.config.get(change.Field)
+			if err == nil {
+				hc.Setting = setting
+
+				current, err := b.configValue(setting)
+				_, locked := locks[setting.Key]
+				hc.Revertable = err == nil && !locked &&
+					setting.Type != ConfigStringPriv &&
+					fmt.Sprintf("%v", current) != change.Before
+			}
+
+			history = append(history, hc)
+		}
+	}
+
+	return history, nil
+}
+
+func (b *backend) configAuditEntries() ([]*models.AuditEntry, error) {
+	entries, err := b.data.GetAuditEntries(models.AuditFilter{Target: "config"})
+	if err != nil {
+		return nil, err
+	}
+
+	config := []*models.AuditEntry{}
+	for _, entry := range entries {
+		if entry.Target == "config" && strings.HasPrefix(string(entry.Action), "config.") {
+			config = append(config, entry)
+		}
+	}
+	return config, nil
+}
+
+// RevertConfigChange sets a setting back to the value it had before the
+// given audit entry changed it.
+func (b *backend) RevertConfigChange(admin *models.User, entryId int, key string) error {
+	entries, err := b.configAuditEntries()
+	if err != nil {
+		return err
+	}
+
+	var change *models.AuditChange
+	for _, entry := range entries {
+		if entry.Id != entryId {
+			continue
+		}
+
+		for i := range entry.Changes {
+			if entry.Changes[i].Field == key {
+				change = &entry.Changes[i]
+			}
+		}
+	}
+
+	if change == nil {
+		return fmt.Errorf("No change to %s found in audit entry %d", key, entryId)
+	}
+
+	setting, err := b.config.get(key)
+	if err != nil {
+		return err
+	}
+
+	if setting.Type == ConfigStringPriv {
+		return fmt.Errorf("Changes to private settings can't be reverted")
+	}
+
+	current, err := b.configValue(setting)
+	if err != nil {
+		return err
+	}
+
+	if fmt.Sprintf("%v", current) == change.Before {
+		return fmt.Errorf("%s already has the value %q", key, change.Before)
+	}
+
+	if err = b.SetConfigValue(key, change.Before); err != nil {
+		return err
+	}
+
+	b.Audit(admin, models.AUDIT_CONFIG_REVERT, "config",
+		map[string]string{key: fmt.Sprintf("%v", current)},
+		map[string]string{key: change.Before},
+	)
+	return nil
+}
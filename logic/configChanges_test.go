@@ -0,0 +1,170 @@
+package logic
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/database"
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+func newConfigBackend(t *testing.T) *backend {
+	log := logger.NewSilent()
+
+	db, err := database.GetDatabase("json", filepath.Join(t.TempDir(), "data.json"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &backend{
+		data:      db,
+		config:    defaultConfig(),
+		overrides: map[string]configOverride{},
+		l:         log,
+		limiter:   newRateLimiter(),
+	}
+
+	if err = b.LoadDefaultsIfNotSet(); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func Test_PreviewConfigImport(t *testing.T) {
+	b := newConfigBackend(t)
+	b.overrides[ConfigVotingEnabled] = configOverride{value: "false", source: "a test"}
+
+	changes, err := b.PreviewConfigImport([]byte(`{
+		"MaxUserVotes": 3,
+		"MaxTitleLength": 100,
+		"VotingEnabled": true,
+		"NoticeBanner": "Hello"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]*ConfigImportChange{}
+	for _, change := range changes {
+		found[change.Key] = change
+	}
+
+	if _, ok := found[ConfigMaxTitleLength]; ok {
+		t.Errorf("Expected unchanged settings to be left out")
+	}
+
+	votes := found[ConfigMaxUserVotes]
+	if votes == nil || votes.Before != "5" || votes.After != "3" || votes.Error != "" {
+		t.Errorf("Unexpected change for MaxUserVotes: %v", votes)
+	}
+
+	if found[ConfigVotingEnabled] == nil || found[ConfigVotingEnabled].Skipped == "" {
+		t.Errorf("Expected the locked setting to be skipped")
+	}
+
+	for _, bad := range []string{
+		`{"MaxUserVotes": 0}`,
+		`{"NotASetting": 1}`,
+		`{"TmdbToken": "abc"}`,
+	} {
+		changes, err := b.PreviewConfigImport([]byte(bad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 1 || changes[0].Error == "" {
+			t.Errorf("Expected an error for %s, got %v", bad, changes)
+		}
+	}
+
+	if _, err := b.PreviewConfigImport([]byte("not json")); err == nil {
+		t.Errorf("Expected an error for invalid JSON")
+	}
+}
+
+// failingCfgDatabase fails to save one config key.
+type failingCfgDatabase struct {
+	database.Database
+	key string
+}
+
+func (db *failingCfgDatabase) SetCfgInt(key string, value int) error {
+	if key == db.key {
+		return errors.New("disk full")
+	}
+	return db.Database.SetCfgInt(key, value)
+}
+
+func Test_ImportConfigRestore(t *testing.T) {
+	b := newConfigBackend(t)
+	admin := &models.User{Id: 1, Name: "admin"}
+
+	// NoticeBanner and MaxTitleLength are saved before MaxUserVotes fails
+	b.data = &failingCfgDatabase{Database: b.data, key: ConfigMaxUserVotes}
+	_, err := b.ImportConfig(admin, []byte(`{"MaxUserVotes": 3, "MaxTitleLength": 50, "NoticeBanner": "Hello"}`))
+	if err == nil {
+		t.Fatal("Expected the import to fail")
+	}
+
+	if banner, _ := getConfig[string](b, ConfigNoticeBanner); banner != "" {
+		t.Errorf("Expected NoticeBanner to be restored, got %q", banner)
+	}
+	if length, _ := getConfig[int](b, ConfigMaxTitleLength); length != 100 {
+		t.Errorf("Expected MaxTitleLength to be restored, got %d", length)
+	}
+	if votes, _ := b.GetMaxUserVotes(); votes != 5 {
+		t.Errorf("Expected MaxUserVotes to be unchanged, got %d", votes)
+	}
+
+	// Nothing changed, so nothing is audited
+	history, err := b.GetConfigHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Errorf("Expected no config history, got %v", history)
+	}
+}
+
+func Test_RevertConfigChange(t *testing.T) {
+	b := newConfigBackend(t)
+	admin := &models.User{Id: 1, Name: "admin"}
+
+	_, err := b.ImportConfig(admin, []byte(`{"MaxUserVotes": 3, "NoticeBanner": "Hello"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := b.GetConfigHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || !history[0].Revertable {
+		t.Fatalf("Unexpected history: %v", history)
+	}
+
+	entry := history[0].Entry.Id
+	if err = b.RevertConfigChange(admin, entry, ConfigMaxUserVotes); err != nil {
+		t.Fatal(err)
+	}
+
+	if votes, _ := b.GetMaxUserVotes(); votes != 5 {
+		t.Errorf("Expected MaxUserVotes to be 5 again, got %d", votes)
+	}
+	if banner, _ := getConfig[string](b, ConfigNoticeBanner); banner != "Hello" {
+		t.Errorf("Expected NoticeBanner to be left alone, got %q", banner)
+	}
+
+	if err = b.RevertConfigChange(admin, entry, ConfigMaxUserVotes); err == nil {
+		t.Errorf("Expected an error reverting the same change twice")
+	}
+	if err = b.RevertConfigChange(admin, entry, ConfigMaxTitleLength); err == nil {
+		t.Errorf("Expected an error reverting a setting the entry didn't change")
+	}
+
+	history, _ = b.GetConfigHistory()
+	if len(history) != 3 || history[0].Entry.Action != models.AUDIT_CONFIG_REVERT {
+		t.Errorf("Expected the revert to be recorded first, got %v", history)
+	}
+}
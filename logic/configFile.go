@@ -0,0 +1,293 @@
+package logic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables starting with this override settings, eg
+// MOVIEPOLLS_TMDB_TOKEN sets TmdbToken.
+const ConfigEnvPrefix string = "MOVIEPOLLS_"
+
+// Environment variables with the prefix that aren't settings.
+var configEnvReserved = map[string]bool{
+	"MOVIEPOLLS_CONFIG":          true,
+	"MOVIEPOLLS_SECRET_KEY":      true,
+	"MOVIEPOLLS_SECRET_KEY_FILE": true,
+}
+
+// BootstrapConfig holds the settings given to the server when it starts,
+// from a config file and the environment.  The values are already validated.
+type BootstrapConfig struct {
+	// Stored if the setting hasn't been set yet, after that they can be
+	// changed on the admin page as usual.
+	Seed map[string]string
+
+	// Used instead of the stored value and locked on the admin page.
+	Override map[string]string
+
+	// Where each override came from, eg "the environment variable
+	// MOVIEPOLLS_TMDB_TOKEN".
+	Source map[string]string
+
+	// Encrypts the private settings and the auth tokens in the database.
+	// From MOVIEPOLLS_SECRET_KEY, or the file in MOVIEPOLLS_SECRET_KEY_FILE.
+	SecretKey []byte
+}
+
+func newBootstrapConfig() *BootstrapConfig {
+	return &BootstrapConfig{
+		Seed:     map[string]string{},
+		Override: map[string]string{},
+		Source:   map[string]string{},
+	}
+}
+
+// LoadBootstrapConfig reads the config file at path, if path isn't empty,
+// and the MOVIEPOLLS_* variables in environ.  The environment wins over the
+// file.  Unknown or invalid settings are an error so typos don't go
+// unnoticed.
+//
+// Files ending in .toml are read as TOML and files ending in .yaml or .yml as
+// YAML.  Settings are strings, numbers or booleans at the top level or one
+// level down in a section.  Settings under the "seed" section are seeds, everything
+// else is an override.  Keys are the setting names, in any case, with or
+// without underscores: TmdbToken, tmdb_token and TMDB_TOKEN are the same.
+func LoadBootstrapConfig(path string, environ []string) (*BootstrapConfig, error) {
+	config := defaultConfig()
+	boot := newBootstrapConfig()
+
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to open config file: %v", err)
+		}
+		defer file.Close()
+
+		var entries []configFileEntry
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".toml":
+			entries, err = parseTomlConfig(file)
+		case ".yaml", ".yml":
+			entries, err = parseYamlConfig(file)
+		default:
+			return nil, fmt.Errorf("Unknown config file type %q, use .toml or .yaml", filepath.Ext(path))
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		for _, entry := range entries {
+			setting := config.find(entry.Key)
+			if setting == nil {
+				return nil, fmt.Errorf("%s: unknown setting %q", path, entry.Key)
+			}
+
+			if _, err = setting.Parse(entry.Value); err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", path, entry.Key, err)
+			}
+
+			if entry.Seed {
+				boot.Seed[setting.Key] = entry.Value
+			} else {
+				boot.Override[setting.Key] = entry.Value
+				boot.Source[setting.Key] = fmt.Sprintf("the config file %s", filepath.Base(path))
+			}
+		}
+	}
+
+	for _, env := range environ {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], ConfigEnvPrefix) {
+			continue
+		}
+
+		var err error
+		switch kv[0] {
+		case "MOVIEPOLLS_SECRET_KEY":
+			boot.SecretKey, err = ParseSecretKey(kv[1])
+		case "MOVIEPOLLS_SECRET_KEY_FILE":
+			boot.SecretKey, err = ReadSecretKeyFile(kv[1])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Environment variable %s: %v", kv[0], err)
+		}
+
+		if configEnvReserved[kv[0]] {
+			continue
+		}
+
+		setting := config.find(strings.TrimPrefix(kv[0], ConfigEnvPrefix))
+		if setting == nil {
+			return nil, fmt.Errorf("Unknown setting in environment variable %s", kv[0])
+		}
+
+		if _, err := setting.Parse(kv[1]); err != nil {
+			return nil, fmt.Errorf("Environment variable %s: %v", kv[0], err)
+		}
+
+		boot.Override[setting.Key] = kv[1]
+		boot.Source[setting.Key] = fmt.Sprintf("the environment variable %s", kv[0])
+	}
+
+	return boot, nil
+}
+
+// configOverride is a setting value from a BootstrapConfig that takes the
+// place of the stored value.
+type configOverride struct {
+	value  interface{}
+	source string
+}
+
+// applyBootstrap stores the seeds that aren't set yet and remembers the
+// overrides.
+func (b *backend) applyBootstrap(boot *BootstrapConfig) error {
+	if boot == nil {
+		return nil
+	}
+
+	for key, str := range boot.Seed {
+		setting, err := b.config.get(key)
+		if err != nil {
+			return err
+		}
+
+		_, err = b.storedConfig(setting)
+		if err == nil {
+			continue
+		}
+
+		val, err := setting.Parse(str)
+		if err != nil {
+			return err
+		}
+
+		if err = b.storeConfig(setting, val); err != nil {
+			return err
+		}
+		b.l.Info("Seeded config value %s", key)
+	}
+
+	for key, str := range boot.Override {
+		setting, err := b.config.get(key)
+		if err != nil {
+			return err
+		}
+
+		val, err := setting.Parse(str)
+		if err != nil {
+			return err
+		}
+
+		b.overrides[key] = configOverride{value: val, source: boot.Source[key]}
+		b.l.Info("Config value %s is set by %s", key, boot.Source[key])
+	}
+
+	return nil
+}
+
+// GetConfigLocks returns the settings that can't be changed on the admin
+// page, with where their value comes from.
+func (b *backend) GetConfigLocks() map[string]string {
+	locks := map[string]string{}
+	for key, o := range b.overrides {
+		locks[key] = o.source
+	}
+	return locks
+}
+
+type configFileEntry struct {
+	Key   string
+	Value string
+	Seed  bool
+}
+
+func parseTomlConfig(r io.Reader) ([]configFileEntry, error) {
+	raw := map[string]any{}
+	if _, err := toml.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	return configFileEntries(raw)
+}
+
+func parseYamlConfig(r io.Reader) ([]configFileEntry, error) {
+	raw := map[string]any{}
+	if err := yaml.NewDecoder(r).Decode(&raw); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return configFileEntries(raw)
+}
+
+// configFileEntries flattens a decoded config file.  Top level keys are
+// settings or sections holding settings, sorted by name.
+func configFileEntries(raw map[string]any) ([]configFileEntry, error) {
+	entries := []configFileEntry{}
+
+	for _, key := range sortedKeys(raw) {
+		section, ok := raw[key].(map[string]any)
+		if !ok {
+			val, err := configFileValue(raw[key])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			entries = append(entries, configFileEntry{Key: key, Value: val})
+			continue
+		}
+
+		seed := strings.EqualFold(key, "seed")
+		for _, name := range sortedKeys(section) {
+			if _, ok := section[name].(map[string]any); ok {
+				return nil, fmt.Errorf("%s.%s: sections can't be nested", key, name)
+			}
+
+			val, err := configFileValue(section[name])
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", key, name, err)
+			}
+			entries = append(entries, configFileEntry{Key: name, Value: val, Seed: seed})
+		}
+	}
+
+	return entries, nil
+}
+
+// configFileValue turns a decoded value into the string a setting parses.
+// Only strings, numbers and booleans are settings.
+func configFileValue(val any) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", fmt.Errorf("missing value")
+	}
+	return "", fmt.Errorf("unsupported value %v", val)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
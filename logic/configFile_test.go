@@ -0,0 +1,133 @@
+package logic
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ParseTomlConfig(t *testing.T) {
+	input := `# MoviePolls settings
+host_address = "movies.example.com"
+MaxUserVotes = 3 # per cycle
+
+[authentication]
+TwitchOauthEnabled = true
+TwitchOauthClientSecret = 'not#a"comment'
+
+[seed]
+NoticeBanner = "Welcome!\tHave fun"
+`
+
+	entries, err := parseTomlConfig(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sorted by section and name
+	expected := []configFileEntry{
+		{Key: "MaxUserVotes", Value: "3"},
+		{Key: "TwitchOauthClientSecret", Value: `not#a"comment`},
+		{Key: "TwitchOauthEnabled", Value: "true"},
+		{Key: "host_address", Value: "movies.example.com"},
+		{Key: "NoticeBanner", Value: "Welcome!\tHave fun", Seed: true},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v, got %v", expected, entries)
+	}
+
+	for _, bad := range []string{
+		"[seed",
+		"NoValue",
+		`Name = "unterminated`,
+		`Name = "a" b`,
+		"[seed.nested]\nName = 1",
+		"Name = [1, 2]",
+	} {
+		if _, err := parseTomlConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func Test_ParseYamlConfig(t *testing.T) {
+	input := `---
+host_address: movies.example.com
+notice_banner: Don't panic # not part of the value
+seed:
+  max_user_votes: 3
+  tmdb_token: "abc:def"
+voting_enabled: true
+`
+
+	entries, err := parseYamlConfig(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []configFileEntry{
+		{Key: "host_address", Value: "movies.example.com"},
+		{Key: "notice_banner", Value: "Don't panic"},
+		{Key: "max_user_votes", Value: "3", Seed: true},
+		{Key: "tmdb_token", Value: "abc:def", Seed: true},
+		{Key: "voting_enabled", Value: "true"},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v, got %v", expected, entries)
+	}
+
+	if entries, err = parseYamlConfig(strings.NewReader("")); err != nil || len(entries) != 0 {
+		t.Errorf("Expected nothing from an empty file, got %v %v", entries, err)
+	}
+
+	for _, bad := range []string{
+		"name: [unterminated",
+		"name:",
+		"seed:\n  nested:\n    name: 1",
+		"name:\n  - 1\n  - 2",
+	} {
+		if _, err := parseYamlConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func Test_LoadBootstrapConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "moviepolls.toml")
+	err := os.WriteFile(path, []byte("TmdbToken = \"from-file\"\nVotingEnabled = true\n[seed]\nMaxUserVotes = 3\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boot, err := LoadBootstrapConfig(path, []string{
+		"HOME=/root",
+		"MOVIEPOLLS_CONFIG=" + path,
+		"MOVIEPOLLS_TMDB_TOKEN=from-env",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if boot.Override[ConfigTmdbToken] != "from-env" {
+		t.Errorf("Expected the environment to win, got %q", boot.Override[ConfigTmdbToken])
+	}
+	if boot.Source[ConfigTmdbToken] != "the environment variable MOVIEPOLLS_TMDB_TOKEN" {
+		t.Errorf("Unexpected source %q", boot.Source[ConfigTmdbToken])
+	}
+	if boot.Source[ConfigVotingEnabled] != "the config file moviepolls.toml" {
+		t.Errorf("Unexpected source %q", boot.Source[ConfigVotingEnabled])
+	}
+	if boot.Seed[ConfigMaxUserVotes] != "3" {
+		t.Errorf("Expected MaxUserVotes to be seeded, got %v", boot.Seed)
+	}
+
+	for _, env := range []string{"MOVIEPOLLS_NOT_A_SETTING=1", "MOVIEPOLLS_MAX_USER_VOTES=0"} {
+		if _, err := LoadBootstrapConfig("", []string{env}); err == nil {
+			t.Errorf("Expected an error for %s", env)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/database"
+)
+
+type ConfigValueType int
+
+const (
+	ConfigInt ConfigValueType = iota
+	ConfigString
+	ConfigStringPriv
+	ConfigBool
+	ConfigKey
+)
+
+func (t ConfigValueType) String() string {
+	switch t {
+	case ConfigInt:
+		return "int"
+	case ConfigString:
+		return "string"
+	case ConfigStringPriv:
+		return "private string"
+	case ConfigBool:
+		return "bool"
+	case ConfigKey:
+		return "key"
+	}
+	return fmt.Sprintf("ConfigValueType(%d)", int(t))
+}
+
+// ConfigSetting describes a single config key: its type, default, which
+// values are valid and how it is shown on the admin config page.
+type ConfigSetting struct {
+	Key         string
+	Section     string
+	Type        ConfigValueType
+	Default     interface{}
+	Label       string
+	Description string
+
+	// Limits for ConfigInt values.  A Max of zero means there is no upper
+	// limit.
+	Min int
+	Max int
+
+	// Allowed values for string settings, compared without case.  If List
+	// is set the value is a comma separated list of them.
+	Options []string
+	List    bool
+
+	// String settings have to match this, if set.
+	Pattern *regexp.Regexp
+}
+
+// Validate checks a value against the type and limits of the setting.
+func (s *ConfigSetting) Validate(value interface{}) error {
+	switch s.Type {
+	case ConfigInt:
+		val, ok := value.(int)
+		if !ok {
+			return fmt.Errorf("%s must be a number", s.Label)
+		}
+		if val < s.Min {
+			return fmt.Errorf("%s must be at least %d", s.Label, s.Min)
+		}
+		if s.Max != 0 && val > s.Max {
+			return fmt.Errorf("%s must be at most %d", s.Label, s.Max)
+		}
+
+	case ConfigBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be true or false", s.Label)
+		}
+
+	case ConfigString, ConfigStringPriv:
+		val, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be text", s.Label)
+		}
+
+		if len(s.Options) > 0 {
+			items := []string{val}
+			if s.List {
+				items = strings.Split(val, ",")
+			}
+
+			for _, item := range items {
+				item = strings.TrimSpace(item)
+				if item == "" && s.List {
+					continue
+				}
+				if !s.isOption(item) {
+					return fmt.Errorf("%s: %q is not one of %s", s.Label, item, strings.Join(s.Options, ", "))
+				}
+			}
+		}
+
+		if s.Pattern != nil && !s.Pattern.MatchString(val) {
+			return fmt.Errorf("%s is not in the right format", s.Label)
+		}
+
+	default:
+		return fmt.Errorf("Unknown config value type for %s: %v", s.Key, s.Type)
+	}
+
+	return nil
+}
+
+func (s *ConfigSetting) isOption(value string) bool {
+	for _, opt := range s.Options {
+		if strings.EqualFold(opt, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse converts a value from a form or a file to the type of the setting
+// and validates it.
+func (s *ConfigSetting) Parse(str string) (interface{}, error) {
+	var value interface{}
+
+	switch s.Type {
+	case ConfigInt:
+		val, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", s.Label)
+		}
+		value = val
+
+	case ConfigBool:
+		val, err := strconv.ParseBool(strings.TrimSpace(str))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", s.Label)
+		}
+		value = val
+
+	default:
+		value = str
+	}
+
+	if err := s.Validate(value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// configRegistry holds every known setting.  Each backend builds its own and
+// it isn't changed afterwards.
+type configRegistry struct {
+	settings map[string]*ConfigSetting
+	ordered  []*ConfigSetting
+	sections []string
+}
+
+func newConfigRegistry() *configRegistry {
+	return &configRegistry{
+		settings: map[string]*ConfigSetting{},
+		ordered:  []*ConfigSetting{},
+		sections: []string{},
+	}
+}
+
+// section adds settings to the registry under the given section name.  The
+// sections and settings keep the order they were added in.
+func (r *configRegistry) section(name string, settings ...*ConfigSetting) {
+	r.sections = append(r.sections, name)
+	for _, setting := range settings {
+		if _, exists := r.settings[setting.Key]; exists {
+			panic(fmt.Sprintf("config setting %s registered twice", setting.Key))
+		}
+		if err := setting.Validate(setting.Default); err != nil {
+			panic(fmt.Sprintf("invalid default for config setting %s: %v", setting.Key, err))
+		}
+
+		setting.Section = name
+		r.settings[setting.Key] = setting
+		r.ordered = append(r.ordered, setting)
+	}
+}
+
+func (r *configRegistry) get(key string) (*ConfigSetting, error) {
+	setting, ok := r.settings[key]
+	if !ok {
+		return nil, fmt.Errorf("Could not find ConfigValue named %s", key)
+	}
+	return setting, nil
+}
+
+// find looks up a setting by name, ignoring case, underscores and dashes, so
+// TMDB_TOKEN finds TmdbToken.
+func (r *configRegistry) find(name string) *ConfigSetting {
+	name = normalizeConfigKey(name)
+	for _, setting := range r.ordered {
+		if normalizeConfigKey(setting.Key) == name {
+			return setting
+		}
+	}
+	return nil
+}
+
+func normalizeConfigKey(name string) string {
+	name = strings.ReplaceAll(name, "_", "")
+	name = strings.ReplaceAll(name, "-", "")
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+type configType interface {
+	int | bool | string
+}
+
+// getConfig returns the value of a setting, storing the default if it hasn't
+// been set yet.  A stored value that doesn't validate is logged and the
+// default is returned instead.
+func getConfig[T configType](b *backend, key string) (T, error) {
+	var zero T
+
+	setting, err := b.config.get(key)
+	if err != nil {
+		return zero, err
+	}
+
+	val, err := b.configValue(setting)
+	if err != nil {
+		return zero, err
+	}
+
+	if err = setting.Validate(val); err != nil {
+		b.l.Error("Invalid value for %s, using the default: %v", key, err)
+		val = setting.Default
+	}
+
+	typed, ok := val.(T)
+	if !ok {
+		return zero, fmt.Errorf("Config value %s is a %s, not a %T", key, setting.Type, zero)
+	}
+	return typed, nil
+}
+
+// storedConfig reads the value of a setting from the database.  Returns
+// database.ErrNoValue if it hasn't been set.
+func (b *backend) storedConfig(setting *ConfigSetting) (interface{}, error) {
+	switch def := setting.Default.(type) {
+	case int:
+		return b.data.GetCfgInt(setting.Key, def)
+	case bool:
+		return b.data.GetCfgBool(setting.Key, def)
+	case string:
+		return b.data.GetCfgString(setting.Key, def)
+	}
+	return nil, fmt.Errorf("Unknown config value type for %s: %v", setting.Key, setting.Type)
+}
+
+func (b *backend) storeConfig(setting *ConfigSetting, value interface{}) error {
+	switch val := value.(type) {
+	case int:
+		return b.data.SetCfgInt(setting.Key, val)
+	case bool:
+		return b.data.SetCfgBool(setting.Key, val)
+	case string:
+		return b.data.SetCfgString(setting.Key, val)
+	}
+	return fmt.Errorf("Unknown config value type for %s: %v", setting.Key, setting.Type)
+}
+
+// configValue returns the override of a setting if there is one, otherwise
+// it's storedConfig, but stores and returns the default if the setting hasn't
+// been set.
+func (b *backend) configValue(setting *ConfigSetting) (interface{}, error) {
+	if o, ok := b.overrides[setting.Key]; ok {
+		return o.value, nil
+	}
+
+	val, err := b.storedConfig(setting)
+	if errors.Is(err, database.ErrNoValue) {
+		err = b.storeConfig(setting, setting.Default)
+		if err != nil {
+			b.l.Error("Unable to set default value for %s: %v", setting.Key, err)
+		}
+		return setting.Default, nil
+	}
+	return val, err
+}
+
+// GetConfigSettings returns every setting, grouped by section.
+func (b *backend) GetConfigSettings() []*ConfigSetting {
+	return b.config.ordered
+}
+
+// GetConfigSections returns the section names in the order they are shown.
+func (b *backend) GetConfigSections() []string {
+	return b.config.sections
+}
+
+// GetConfigValue returns the value of a setting without validating it.
+func (b *backend) GetConfigValue(key string) (interface{}, error) {
+	setting, err := b.config.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.configValue(setting)
+}
+
+// SetConfigValue parses, validates and stores the value of a setting.
+// Invalid values are not stored, and neither are settings locked by the
+// BootstrapConfig.
+func (b *backend) SetConfigValue(key string, value string) error {
+	setting, err := b.config.get(key)
+	if err != nil {
+		return err
+	}
+
+	if o, ok := b.overrides[key]; ok {
+		return fmt.Errorf("%s is set by %s and can't be changed here", setting.Label, o.source)
+	}
+
+	val, err := setting.Parse(value)
+	if err != nil {
+		return err
+	}
+	return b.storeConfig(setting, val)
+}
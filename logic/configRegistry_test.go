@@ -0,0 +1,94 @@
+package logic
+
+import (
+	"testing"
+)
+
+func Test_ConfigParse(t *testing.T) {
+	config := defaultConfig()
+
+	tests := []struct {
+		key   string
+		value string
+		valid bool
+	}{
+		{ConfigMaxUserVotes, "3", true},
+		{ConfigMaxUserVotes, "0", false},
+		{ConfigMaxUserVotes, "three", false},
+		{ConfigDuplicateTitleDistance, "10", true},
+		{ConfigDuplicateTitleDistance, "11", false},
+		{ConfigVotingEnabled, "true", true},
+		{ConfigVotingEnabled, "yes", false},
+		{ConfigJikanBannedTypes, "tv, Music", true},
+		{ConfigJikanBannedTypes, "", true},
+		{ConfigJikanBannedTypes, "TV,cartoon", false},
+		{ConfigMetadataProviders, "IMDb:tmdb,AniList:anilist", true},
+		{ConfigMetadataProviders, "IMDb", false},
+		{ConfigTwitchBotServer, "irc.chat.twitch.tv:6697", true},
+		{ConfigTwitchBotServer, "irc.chat.twitch.tv", false},
+		{ConfigTwitchBotChannel, "#zorchenhimer", true},
+		{ConfigTwitchBotChannel, "two words", false},
+	}
+
+	for _, tt := range tests {
+		setting, err := config.get(tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = setting.Parse(tt.value)
+		if tt.valid && err != nil {
+			t.Errorf("Expected %s=%q to be valid, got %v", tt.key, tt.value, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("Expected %s=%q to be invalid", tt.key, tt.value)
+		}
+	}
+}
+
+func Test_ConfigRegistry(t *testing.T) {
+	config := defaultConfig()
+
+	if _, err := config.get("NotASetting"); err == nil {
+		t.Errorf("Expected an error for an unknown setting")
+	}
+
+	for _, setting := range config.ordered {
+		if setting.Label == "" {
+			t.Errorf("Setting %s has no label", setting.Key)
+		}
+		if setting.Section == "" {
+			t.Errorf("Setting %s has no section", setting.Key)
+		}
+	}
+}
+
+func Test_AddNewMetadataProviders(t *testing.T) {
+	b := newConfigBackend(t)
+
+	// Stored before TMDB and AniList links were added
+	if err := b.data.SetCfgString(ConfigMetadataProviders, "IMDb:tmdb,MyAnimeList:jikan"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.addNewMetadataProviders(); err != nil {
+		t.Fatal(err)
+	}
+
+	value, _ := b.data.GetCfgString(ConfigMetadataProviders, "")
+	if value != "IMDb:tmdb,MyAnimeList:jikan,TMDB:tmdb,AniList:anilist" {
+		t.Fatalf("The new providers weren't added: %q", value)
+	}
+
+	// Removed by an admin
+	if err := b.data.SetCfgString(ConfigMetadataProviders, "IMDb:tmdb"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.addNewMetadataProviders(); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ = b.data.GetCfgString(ConfigMetadataProviders, ""); value != "IMDb:tmdb" {
+		t.Errorf("Removed providers were added again: %q", value)
+	}
+}
@@ -31,8 +31,46 @@ func (b *backend) AddCycle(plannedEnd *time.Time) (int, error) {
 	return b.data.AddCycle(plannedEnd)
 }
 
+// CycleEndHandler is called after a cycle has been ended with the list of
+// movies that were picked as watched.
+type CycleEndHandler func(cycle *models.Cycle, watched []*models.Movie)
+
+func (b *backend) AddCycleEndHandler(handler CycleEndHandler) {
+	b.cycleEndHandlers = append(b.cycleEndHandlers, handler)
+}
+
 func (b *backend) UpdateCycle(cycle *models.Cycle) error {
-	return b.data.UpdateCycle(cycle)
+	old, err := b.data.GetCycle(cycle.Id)
+	if err != nil {
+		return err
+	}
+
+	err = b.data.UpdateCycle(cycle)
+	if err != nil {
+		return err
+	}
+
+	// Only notify on the transition from running to ended
+	if old.Ended == nil && cycle.Ended != nil {
+		b.notifyCycleEnd(cycle)
+	}
+	return nil
+}
+
+func (b *backend) notifyCycleEnd(cycle *models.Cycle) {
+	if len(b.cycleEndHandlers) == 0 {
+		return
+	}
+
+	watched, err := b.data.GetMoviesFromCycle(cycle.Id)
+	if err != nil {
+		b.l.Error("Unable to get watched movies for cycle %d: %v", cycle.Id, err)
+		return
+	}
+
+	for _, handler := range b.cycleEndHandlers {
+		handler(cycle, watched)
+	}
 }
 
 func (b *backend) EndCycle(cid int) error {
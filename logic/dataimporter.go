@@ -1,437 +1,282 @@
 package logic
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
-	"image/jpeg"
-	"io/ioutil"
-	"net/http"
-	"os"
-	"regexp"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/nfnt/resize"
-	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/models"
 )
 
 const defaultPosterPath = "posters/unknown.jpg"
 
-type dataapi interface {
-	getTitle() (string, error)
-	getDesc() (string, error)
-	getPoster() (string, error) //path to the file  (from root)
-	getDuration() (string, error)
-	getRating() (string, error) //returns the rating as string i.e. 8.69
-	getTags() (string, error)   //returns the tags as comma seperated string
-	requestResults() error
+// MetadataResult is what a MetadataProvider found for a link.
+type MetadataResult struct {
+	// ID of the entry at the provider.
+	SourceId string
+
+	// Title is the name the movie is added under.  Providers may include
+	// extra information like the year or an English title in it.
+	Title       string
+	Description string
+	PosterUrl   string // Empty if there is no poster
+	Runtime     string // Human readable, eg "1 hr 57 min"
+	Rating      float32
+	Tags        []string
+	Year        int // Zero if unknown
+
+	// IDs of the entry at other sites, keyed by site.  Eg, "imdb": "tt0078748"
+	ExternalIds map[string]string
 }
 
-type tmdb struct {
-	l           *logger.Logger
-	id          string
-	token       string
-	resp        *map[string]interface{}
-	uploadlimit int
+// MetadataProvider looks up the information for a link to fill in a new
+// movie.  Errors are shown to the user, so they should be readable.
+type MetadataProvider interface {
+	Lookup(link *models.Link) (*MetadataResult, error)
 }
 
-type jikan struct {
-	l             *logger.Logger
-	id            string
-	excludedTypes []string
-	resp          *map[string]interface{}
-	maxEpisodes   int
-	maxDuration   int
-	uploadlimit   int
+// MetadataCandidate is a single search result from a MetadataSearcher.
+type MetadataCandidate struct {
+	Provider  string
+	Title     string
+	Year      int    // Zero if unknown
+	PosterUrl string // Empty if there is no poster
+
+	// Canonical link to the entry.  This is the link that gets looked up
+	// when the candidate is picked, so it has to match a link type that is
+	// mapped to the same provider.
+	Link string
 }
 
-func getMovieData(api dataapi) ([]string, error) {
-	var slice []string
-
-	err := api.requestResults()
-
-	if err != nil {
-		return nil, err
-	}
-
-	val, err := api.getTitle()
-	if err != nil {
-		return nil, err
-	}
-	slice = append(slice, val)
-
-	val, err = api.getDesc()
-	if err != nil {
-		return nil, err
-	}
-	slice = append(slice, val)
+// MetadataSearcher is implemented by providers that can search by title.
+// year is zero if the user didn't give one.
+type MetadataSearcher interface {
+	Search(title string, year int) ([]*MetadataCandidate, error)
+}
 
-	val, err = api.getPoster()
-	if err != nil {
-		return nil, err
-	}
-	slice = append(slice, val)
+// Max number of candidates returned per provider by a search.
+const maxSearchResults int = 5
+
+// canonicalLinks turns the external IDs of a result into links that can be
+// attached to a movie.
+var canonicalLinks = map[string]string{
+	"imdb":        "https://www.imdb.com/title/%s/",
+	"myanimelist": "https://myanimelist.net/anime/%s",
+	"anilist":     "https://anilist.co/anime/%s",
+	"tmdb":        "https://www.themoviedb.org/movie/%s",
+	"tmdb-tv":     "https://www.themoviedb.org/tv/%s",
+}
 
-	val, err = api.getDuration()
-	if err != nil {
-		return nil, err
-	}
-	slice = append(slice, val)
+// The constructor returns an error if the provider is disabled or not
+// configured.
+type metadataConstructor func(b *backend) (MetadataProvider, error)
 
-	val, err = api.getRating()
-	if err != nil {
-		return nil, err
-	}
-	slice = append(slice, val)
+var registeredProviders map[string]metadataConstructor
 
-	val, err = api.getTags()
-	if err != nil {
-		return nil, err
+// registerMetadataProvider makes a provider available to be mapped to a link
+// type with the ConfigMetadataProviders setting.  Call this from an init()
+// along with models.RegisterLinkType().
+func registerMetadataProvider(name string, initFunc metadataConstructor) {
+	if registeredProviders == nil {
+		registeredProviders = map[string]metadataConstructor{}
 	}
-	slice = append(slice, val)
 
-	return slice, nil
+	registeredProviders[name] = initFunc
 }
 
-func (t *tmdb) requestResults() error {
-	url := fmt.Sprintf("https://api.themoviedb.org/3/find/%v?api_key=%v&language=en-US&external_source=imdb_id", t.id, t.token)
-	resp, err := http.Get(url)
-
-	if err != nil || resp.StatusCode != 200 {
-		return fmt.Errorf("Tried to access API - Response Code: %v\nMaybe check your tmdb api token", resp.Status)
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-
+// getMetadataProvider returns the provider configured for the link type.
+func (b *backend) getMetadataProvider(linkType string) (MetadataProvider, error) {
+	providers, err := b.GetMetadataProviders()
 	if err != nil {
-		return err
+		b.l.Error("Unable to get %s: %v", ConfigMetadataProviders, err)
+		return nil, fmt.Errorf("Something went wrong :C")
 	}
 
-	var tmp map[string][]map[string]interface{}
+	name, ok := providers[linkType]
+	if !ok {
+		types := []string{}
+		for t := range providers {
+			types = append(types, t)
+		}
+		sort.Strings(types)
 
-	if err := json.Unmarshal(body, &tmp); err != nil {
-		return errors.New("Error while unmarshalling json response")
+		return nil, fmt.Errorf("To use autofill the first link has to be one of these: %s", strings.Join(types, ", "))
 	}
 
-	if len(tmp["movie_results"]) == 0 {
-		return errors.New("JSON Result did not return a movie, make sure the imdb link is for a movie")
+	initFunc, ok := registeredProviders[name]
+	if !ok {
+		b.l.Error("Link type %s is mapped to unknown metadata provider %q", linkType, name)
+		return nil, fmt.Errorf("The autofill for %s links is not configured correctly, contact the site administrator", linkType)
 	}
 
-	movieId := tmp["movie_results"][0]["id"]
-
-	url = fmt.Sprintf("https://api.themoviedb.org/3/movie/%v?api_key=%v", movieId, t.token)
-
-	resp, err = http.Get(url)
-	if err != nil || resp.StatusCode != 200 {
-		return fmt.Errorf("Tried to access API - Response Code: %v\nMaybe check your tmdb api token", resp.Status)
+	provider, err := initFunc(b)
+	if err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err = ioutil.ReadAll(resp.Body)
+	return &timedProvider{name: name, provider: provider}, nil
+}
 
+// GetAutofillEnabled returns true if at least one of the configured metadata
+// providers is enabled.
+func (b *backend) GetAutofillEnabled() (bool, error) {
+	providers, err := b.GetMetadataProviders()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	var dat map[string]interface{}
+	for _, name := range providers {
+		initFunc, ok := registeredProviders[name]
+		if !ok {
+			continue
+		}
 
-	if err := json.Unmarshal(body, &dat); err != nil {
-		return errors.New("Error while unmarshalling json response")
+		if _, err := initFunc(b); err == nil {
+			return true, nil
+		}
 	}
 
-	t.resp = &dat
-	return nil
-}
-
-func (t *tmdb) getTitle() (string, error) {
-
-	title := ""
-
-	dat := t.resp
-
-	title = (*dat)["title"].(string)
-	release := (*dat)["release_date"].(string)
-
-	release = release[0:4]
-
-	title = title + " (" + release + ")"
-
-	return title, nil
-}
-
-func (t *tmdb) getDesc() (string, error) {
-
-	desc := ""
-
-	dat := t.resp
-
-	desc = (*dat)["overview"].(string)
-
-	return desc, nil
+	return false, nil
 }
 
-func (t *tmdb) getPoster() (string, error) {
-
-	external_path := ""
-
-	dat := t.resp
-
-	external_path = (*dat)["poster_path"].(string)
-
-	if external_path == "" {
-		return "unknown.jpg", nil
+// SearchMetadata searches every configured provider that supports searching
+// for the title.  Candidates are grouped by provider.  A provider failing
+// only results in an error if none of them returned anything.
+func (b *backend) SearchMetadata(title string, year int) ([]*MetadataCandidate, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil, fmt.Errorf("Enter a title to search for")
 	}
 
-	fileurl := "https://image.tmdb.org/t/p/original" + external_path
-
-	path := "posters/" + t.id + ".jpg"
-
-	err := DownloadFile(path, fileurl, t.uploadlimit)
-
+	providers, err := b.GetMetadataProviders()
 	if err != nil {
-		return "unknown.jpg", fmt.Errorf("Error while downloading file, using unknown.jpg. Error: %v", err.Error())
+		b.l.Error("Unable to get %s: %v", ConfigMetadataProviders, err)
+		return nil, fmt.Errorf("Something went wrong :C")
 	}
 
-	return path, nil
-}
-
-func (t *tmdb) getDuration() (string, error) {
-
-	runtime := 0
-
-	dat := t.resp
-
-	runtime = int((*dat)["runtime"].(float64))
-
-	return fmt.Sprintf("%v hr %v min", runtime/60, runtime%60), nil
-}
-
-func (t *tmdb) getRating() (string, error) {
-
-	dat := t.resp
-
-	rating := (*dat)["vote_average"].(float64)
-
-	return fmt.Sprintf("%v", rating), nil
-}
-
-func (t *tmdb) getTags() (string, error) {
-
-	dat := t.resp
-
-	tagMaps := (*dat)["genres"].([]interface{})
-
-	tags := []string{}
-	tags = append(tags, "IMDB")
-
-	for _, tag := range tagMaps {
-		tg := tag.(map[string]interface{})
-		tags = append(tags, tg["name"].(string))
+	// The same provider can be mapped to multiple link types.
+	names := []string{}
+	seen := map[string]bool{}
+	for _, name := range providers {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
 	}
+	sort.Strings(names)
 
-	// Sadly the Decision was made to pass all results as a slice of strings
-	// Therefore this has to be a string instead of a slice of string, otherwise it cannot be passed
-	// to the caller
-	return strings.Join(tags, ","), nil
-}
-
-var re_duration = regexp.MustCompile(`([0-9]{1,3}) min`)
+	candidates := []*MetadataCandidate{}
+	var lastErr error
+	searched := false
 
-func (j *jikan) requestResults() error {
-	resp, err := http.Get("https://api.jikan.moe/v4/anime/" + j.id)
-	if err != nil || resp.StatusCode != 200 {
-		return errors.New("\n\nTried to access API - Response Code: " + resp.Status + "\n Request URL: " + "https://api.jikan.moe/v4/anime/" + j.id + "\n")
-	} else {
-		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return err
+	for _, name := range names {
+		initFunc, ok := registeredProviders[name]
+		if !ok {
+			continue
 		}
 
-		var rawDat map[string]map[string]interface{}
-
-		if err := json.Unmarshal(body, &rawDat); err != nil {
-			return errors.New("Error while unmarshalling json response")
+		provider, err := initFunc(b)
+		if err != nil {
+			continue
 		}
 
-		var dat map[string]interface{}
-		dat = rawDat["data"]
-
-		for _, etype := range j.excludedTypes {
-			thisType := dat["type"].(string)
-			if strings.EqualFold(thisType, etype) {
-				return fmt.Errorf("The anime type %s was banned by the sites administrator. Please choose a different type!", thisType)
-			}
+		searcher, ok := provider.(MetadataSearcher)
+		if !ok {
+			continue
 		}
+		searched = true
 
-		if dat["episodes"] != nil {
-			episodes := dat["episodes"].(float64)
-
-			if int(episodes) > j.maxEpisodes && j.maxEpisodes != 0 {
-				return fmt.Errorf("The anime has too many (%d) episodes. The site administrator only allowed animes up to %d episodes.", int(episodes), j.maxEpisodes)
-			}
-		} else {
-			return fmt.Errorf("The episode count of this anime has not been published yet. Therefore this anime can not be added.")
+		start := time.Now()
+		found, err := searcher.Search(title, year)
+		observeMetadata(name, "search", start, err)
+		if err != nil {
+			b.l.Error("Metadata search for %q with %s failed: %v", title, name, err)
+			lastErr = err
+			continue
 		}
 
-		if dat["duration"] != nil && dat["duration"] != "Unknown" && j.maxDuration >= 0 {
-			match := re_duration.FindStringSubmatch(dat["duration"].(string))
-			if len(match) < 2 {
-				j.l.Error("Could not detect episode duration.")
-				return fmt.Errorf("The episode duration of this anime has not been published or has an unexpected format. Therefore this anime can not be added.")
-			}
-			duration, err := strconv.Atoi(match[1])
-
-			if err != nil {
-				j.l.Error("Could not convert duration %v to int", match[1])
-				return fmt.Errorf("The episode duration of this anime has not been published or has an unexpected format. Therefore this anime can not be added.")
-			}
-
-			// this looks stupid but it works lul
-			if (duration * int(dat["episodes"].(float64))) > j.maxDuration {
-				j.l.Error("Duration of the anime %s is too long: %d", dat["title"].(string), (duration * int(dat["episodes"].(float64))))
-				return fmt.Errorf("The duration of this series (episode duration * episodes) is longer than the maximum duration defined by the admin. Therefore this anime can not be added.")
-			}
+		for _, c := range found {
+			c.Provider = name
 		}
-
-		j.resp = &dat
-		return nil
-	}
-}
-
-func (j *jikan) getTitle() (string, error) {
-
-	title := ""
-	dat := j.resp
-
-	if (*dat)["title"] != nil {
-		title = (*dat)["title"].(string)
-	} else {
-		return "", errors.New("No title returned from API")
+		candidates = append(candidates, found...)
 	}
 
-	if (*dat)["title_english"] != nil && (*dat)["title_english"].(string) != (*dat)["title"].(string) {
-		title += " (" + (*dat)["title_english"].(string) + ")"
+	if !searched {
+		return nil, fmt.Errorf("Searching by title is not enabled on this site")
 	}
 
-	return title, nil
-}
-
-func (j *jikan) getDesc() (string, error) {
-	dat := j.resp
-
-	if (*dat)["synopsis"] != nil {
-		return (*dat)["synopsis"].(string), nil
+	if len(candidates) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("Could not complete search\n Error: %s", lastErr.Error())
 	}
 
-	return "", nil
-
+	return candidates, nil
 }
 
-func (j *jikan) getPoster() (string, error) {
-
-	fileurl := ""
-	resp := *j.resp
-	dat1 := resp["images"].(map[string]interface{})
-	dat := dat1["jpg"].(map[string]interface{})
-
-	if (dat)["large_image_url"] != nil {
-		fileurl = (dat)["large_image_url"].(string)
-	} else {
-		return defaultPosterPath, nil
+// PrefillFromMetadata looks up a link picked from the search results and
+// returns the add movie form fields filled in with the result.  The picked
+// link is the first one so autofill uses it when the form is submitted.
+func (b *backend) PrefillFromMetadata(linkUrl string) (map[string]*InputField, error) {
+	link, err := models.NewLink(strings.TrimSpace(linkUrl), 0)
+	if err != nil {
+		return nil, err
 	}
 
-	path := "posters/" + j.id + ".jpg"
-	err := DownloadFile(path, fileurl, j.uploadlimit)
-
-	if !(err == nil) {
-		fmt.Printf("Error while downloading file: %s", err)
-		return defaultPosterPath, errors.New("Error while downloading file, using unknown.jpg")
+	provider, err := b.getMetadataProvider(link.Type)
+	if err != nil {
+		return nil, err
 	}
-	j.l.Debug("poster path: %s", path)
-	return path, nil
-}
 
-func (j *jikan) getDuration() (string, error) {
-
-	dat := j.resp
-
-	if (*dat)["duration"] != nil {
-		return (*dat)["duration"].(string), nil
+	result, err := provider.Lookup(link)
+	if err != nil {
+		return nil, err
 	}
 
-	return "", nil
-}
-
-func (j *jikan) getRating() (string, error) {
-
-	dat := j.resp
-
-	if (*dat)["score"] != nil {
-		return fmt.Sprintf("%v", (*dat)["score"].(float64)), nil
+	links := []string{link.Url}
+	sites := []string{}
+	for site := range result.ExternalIds {
+		sites = append(sites, site)
 	}
+	sort.Strings(sites)
 
-	return "", nil
-}
-
-func (j *jikan) getTags() (string, error) {
-
-	dat := j.resp
-
-	tagMaps := (*dat)["genres"].([]interface{})
-
-	tags := []string{}
-	tags = append(tags, "MAL")
+	for _, site := range sites {
+		format, ok := canonicalLinks[site]
+		if !ok {
+			continue
+		}
 
-	for _, tag := range tagMaps {
-		tg := tag.(map[string]interface{})
-		tags = append(tags, tg["name"].(string))
+		url := fmt.Sprintf(format, result.ExternalIds[site])
+		if !strings.EqualFold(strings.TrimRight(url, "/"), strings.TrimRight(link.Url, "/")) {
+			links = append(links, url)
+		}
 	}
 
-	// Sadly the Decision was made to pass all results as a slice of strings
-	// Therefore this has to be a string instead of a slice of string, otherwise it cannot be passed
-	// to the caller
-	return strings.Join(tags, ","), nil
+	return map[string]*InputField{
+		"Title":       &InputField{Value: result.Title},
+		"Description": &InputField{Value: result.Description},
+		"Links":       &InputField{Value: strings.Join(links, "\n")},
+		"AutofillBox": &InputField{Value: "on"},
+	}, nil
 }
 
-func DownloadFile(filepath string, url string, uploadlimit int) error {
-
-	// Download image data
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.ContentLength > int64(uploadlimit) {
-		return fmt.Errorf("Poster is too large - Max: %d, Requested: %d", uploadlimit, resp.ContentLength)
+// downloadPoster saves the poster of the result, falling back to the default
+// poster if there isn't one or it can't be downloaded.
+func (b *backend) downloadPoster(result *MetadataResult) string {
+	if result.PosterUrl == "" {
+		return defaultPosterPath
 	}
 
-	// Create the file
-	file, err := os.Create(filepath)
+	uploadlimit, err := b.GetMaxUploadlimit()
 	if err != nil {
-		return err
+		b.l.Error("Error while retriving config value 'MaxUploadLimit': %v", err)
+		return defaultPosterPath
 	}
-	defer file.Close()
-
-	// Decode image data
-	image, err := jpeg.Decode(resp.Body)
-	if err != nil {
-		os.Remove(file.Name())
-		return err
-	}
-
-	// Resize the raw image
-	resized := resize.Resize(360, 0, image, resize.NearestNeighbor)
 
-	// Reencode the image data
-	err = jpeg.Encode(file, resized, nil)
+	path, err := b.downloadPosterFile(result.PosterUrl, uploadlimit)
 	if err != nil {
-		os.Remove(file.Name())
-		return err
+		b.l.Error("Error while downloading poster %s, using unknown.jpg: %v", result.PosterUrl, err)
+		return defaultPosterPath
 	}
 
-	return nil
+	b.l.Debug("poster path: %s", path)
+	return path
 }
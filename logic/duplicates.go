@@ -0,0 +1,100 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// DuplicateMatch is an existing movie that looks like the one being added.
+type DuplicateMatch struct {
+	Movie  *models.Movie
+	Reason string
+}
+
+// DuplicateError is returned in the "Duplicates" field of the add movie
+// form when there are likely duplicates.  Submitting the form again with
+// DuplicateConfirm set to "yes" adds the movie anyway.
+type DuplicateError struct {
+	Matches []*DuplicateMatch
+}
+
+func (e *DuplicateError) Error() string {
+	names := []string{}
+	for _, m := range e.Matches {
+		names = append(names, m.Movie.Name)
+	}
+	return fmt.Sprintf("Possible duplicate of %s", strings.Join(names, ", "))
+}
+
+// Titles with fewer runes than this are only matched exactly.  Short titles
+// are too close to each other for the edit distance to mean anything.
+const minFuzzyTitleLength int = 6
+
+// FindDuplicates looks for existing movies with the same external ID as one
+// of the links or ids, or a title that is the same or close after
+// normalizing.  ids are keyed by site like MetadataResult.ExternalIds.
+func (b *backend) FindDuplicates(title string, links []*models.Link, ids map[string]string) ([]*DuplicateMatch, error) {
+	maxDistance, err := b.GetDuplicateTitleDistance()
+	if err != nil {
+		return nil, err
+	}
+
+	movies, err := b.data.GetAllMovies()
+	if err != nil {
+		return nil, err
+	}
+
+	wantIds := map[string]string{}
+	for site, id := range ids {
+		wantIds[site] = id
+	}
+	for _, link := range links {
+		if site, id := link.ExternalId(); site != "" {
+			wantIds[site] = id
+		}
+	}
+
+	variants := models.TitleVariants(title)
+	matches := []*DuplicateMatch{}
+
+	for _, movie := range movies {
+		if reason := matchExternalIds(movie, wantIds); reason != "" {
+			matches = append(matches, &DuplicateMatch{Movie: movie, Reason: reason})
+		} else if reason := matchTitles(variants, models.TitleVariants(movie.Name), maxDistance); reason != "" {
+			matches = append(matches, &DuplicateMatch{Movie: movie, Reason: reason})
+		}
+	}
+
+	return matches, nil
+}
+
+func matchExternalIds(movie *models.Movie, ids map[string]string) string {
+	for _, link := range movie.Links {
+		site, id := link.ExternalId()
+		if site != "" && ids[site] == id {
+			return fmt.Sprintf("Same %s ID (%s)", site, id)
+		}
+	}
+	return ""
+}
+
+func matchTitles(want, have []string, maxDistance int) string {
+	for _, w := range want {
+		for _, h := range have {
+			if w == h {
+				return "Same title"
+			}
+
+			if maxDistance <= 0 || len([]rune(w)) < minFuzzyTitleLength || len([]rune(h)) < minFuzzyTitleLength {
+				continue
+			}
+
+			if models.EditDistance(w, h) <= maxDistance {
+				return "Similar title"
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+func Test_MatchTitles(t *testing.T) {
+	tests := []struct {
+		want   string
+		have   string
+		reason string
+	}{
+		{"The Thing (1982)", "Thing, The", "Same title"},
+		{"Akira", "AKIRA [1988]", "Same title"},
+		{"Spirited Away (Sen to Chihiro no Kamikakushi)", "Sen to Chihiro no Kamikakushi", "Same title"},
+		{"Terminator 2: Judgment Day", "Terminator 2 Judgement Day", "Similar title"},
+		{"Alien", "Aliens", ""},
+		{"The Godfather", "The Godfather Part II", ""},
+		{"Die Hard", "Hard", ""},
+		{"Plan A", "Plan", ""},
+	}
+
+	for _, tt := range tests {
+		reason := matchTitles(models.TitleVariants(tt.want), models.TitleVariants(tt.have), 2)
+		if reason != tt.reason {
+			t.Errorf("%q vs %q: expected %q, got %q", tt.want, tt.have, tt.reason, reason)
+		}
+	}
+}
+
+func Test_MatchExternalIds(t *testing.T) {
+	movie := &models.Movie{
+		Links: []*models.Link{
+			&models.Link{Url: "https://www.imdb.com/title/tt0084787/"},
+			&models.Link{Url: "https://myanimelist.net/anime/47/Akira"},
+		},
+	}
+
+	if reason := matchExternalIds(movie, map[string]string{"myanimelist": "47"}); reason == "" {
+		t.Errorf("Expected a match on the MAL ID")
+	}
+
+	if reason := matchExternalIds(movie, map[string]string{"imdb": "tt0084788"}); reason != "" {
+		t.Errorf("Unexpected match: %s", reason)
+	}
+}
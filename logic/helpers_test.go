@@ -0,0 +1,56 @@
+package logic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixture is a recorded API response in testdata.  A fixture without a file
+// only sends the status.
+type fixture struct {
+	File   string
+	Status int // 200 if not set
+}
+
+// fixtureServer stands in for a metadata provider's API.  Requests counts
+// the requests made to it.
+type fixtureServer struct {
+	*httptest.Server
+	Requests int
+}
+
+// newFixtureServer serves the fixture route picks for each request, or a 404
+// for the zero fixture.  The server is closed at the end of the test.
+func newFixtureServer(t *testing.T, route func(r *http.Request) fixture) *fixtureServer {
+	s := &fixtureServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Requests++
+
+		f := route(r)
+		if f == (fixture{}) {
+			http.NotFound(w, r)
+			return
+		}
+
+		var body []byte
+		if f.File != "" {
+			var err error
+			if body, err = os.ReadFile(filepath.Join("testdata", f.File)); err != nil {
+				t.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if f.Status != 0 {
+			w.WriteHeader(f.Status)
+		}
+		w.Write(body)
+	}))
+
+	t.Cleanup(s.Close)
+	return s
+}
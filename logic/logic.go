@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"mime/multipart"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/zorchenhimer/MoviePolls/database"
@@ -19,16 +20,34 @@ type Logic interface {
 	DeleteUrlKey(key string)
 	GetCryptRandKey(size int) string
 	HashPassword(password string) string
-	NewPasswordResetKey(userId int) (*models.UrlKey, error)
+	NewPasswordResetKey(admin *models.User, user *models.User) (*models.UrlKey, error)
 
 	// Movie stuff
 	AddMovie(fields map[string]*InputField, user *models.User, file multipart.File, fileHeader *multipart.FileHeader) (int, map[string]*InputField)
 	GetMovie(id int) *models.Movie
 	GetActiveMovies() ([]*models.Movie, error)
-	SearchMovieTitles(query string) ([]*models.Movie, error)
+	GetPendingMovies() ([]*models.Movie, error)
+	ApproveMovie(admin *models.User, mid int) error
+	RejectMovie(admin *models.User, mid int, reason string) error
+	SearchMovies(query models.SearchQuery) ([]*models.Movie, error)
 	UpdateMovie(movie *models.Movie) error
-	DeleteMovie(mid int) error
-	UploadFile(file multipart.File, header *multipart.FileHeader, name string) (string, error)
+	AdminUpdateMovie(admin *models.User, movie *models.Movie) error
+	DeleteMovie(admin *models.User, mid int) error
+	RefreshMovieMetadata(actor *models.User, mid int) ([]models.AuditChange, error)
+	GetMovieHistory(mid int) ([]*MovieRevisionDiff, error)
+
+	GetTagCounts(activeOnly bool) ([]*TagCount, error)
+	GetMoviesByTags(tags []string) ([]*models.Movie, error)
+	RenameTag(admin *models.User, id int, name string) error
+	MergeTags(admin *models.User, fromId, intoId int) error
+	AddTagAlias(admin *models.User, id int, alias string) error
+	RemoveTagAlias(admin *models.User, id int, alias string) error
+	RevertMovie(admin *models.User, mid int, revisionId int) error
+	FindOrphanedPosters() (*PosterSweep, error)
+	DeleteOrphanedPosters(admin *models.User, paths []string) (*PosterSweep, error)
+	GetLastPosterSweep() *PosterSweep
+	RunScheduledJobs(quit chan struct{})
+	UploadFile(file multipart.File, header *multipart.FileHeader) (string, error)
 
 	// Link stuff
 	AddLink(*models.Link) (int, error)
@@ -37,6 +56,7 @@ type Logic interface {
 	AddCycle(*time.Time) (int, error)
 	UpdateCycle(*models.Cycle) error
 	EndCycle(cid int) error
+	AddCycleEndHandler(handler CycleEndHandler)
 
 	// User stuff
 	AddUser(user *models.User) (int, error)
@@ -53,6 +73,8 @@ type Logic interface {
 	UserDiscordLogin(extId string) (*models.User, error)
 	UserPatreonLogin(extId string) (*models.User, error)
 	UserLocalLogin(name string, passwd string) (*models.User, error)
+	ExportUserData(user *models.User) (*UserDataExport, error)
+	DeleteOwnAccount(user *models.User, purge bool) error
 
 	// Vote stuff
 	AddVote(userid int, movieid int) error
@@ -63,11 +85,33 @@ type Logic interface {
 
 	// Admin stuff
 	CheckAdminRights(user *models.User) bool
-	AdminDeleteUser(user *models.User) error
+	HasCapability(user *models.User, capability models.Capability) bool
+	GetUserCapabilities(user *models.User) []models.Capability
+	GetRoleCapabilities(role models.PrivilegeLevel) ([]models.Capability, error)
+	SetRoleCapabilities(admin *models.User, role models.PrivilegeLevel, caps []models.Capability) error
+	AdminSetUserRole(admin *models.User, user *models.User, role models.PrivilegeLevel) error
+	AdminDeleteUser(admin *models.User, user *models.User) error
 	AdminBanUser(user *models.User) error
-	AdminPurgeUser(user *models.User) error
+	AdminPurgeUser(admin *models.User, user *models.User) error
+
+	// Audit log
+	Audit(actor *models.User, action models.AuditAction, target string, before, after map[string]string)
+	GetAuditEntries(filter models.AuditFilter) ([]*models.AuditEntry, error)
+	GetConfigSnapshot() map[string]string
+	AuditConfigChange(actor *models.User, before map[string]string)
 
 	// Settings
+	GetConfigSettings() []*ConfigSetting
+	GetConfigSections() []string
+	GetConfigValue(key string) (interface{}, error)
+	SetConfigValue(key string, value string) error
+	GetConfigLocks() map[string]string
+	RotateSecretKey(newKey []byte) (int, error)
+	ExportConfig() ([]byte, error)
+	PreviewConfigImport(data []byte) ([]*ConfigImportChange, error)
+	ImportConfig(admin *models.User, data []byte) ([]*ConfigImportChange, error)
+	GetConfigHistory() ([]*ConfigHistoryChange, error)
+	RevertConfigChange(admin *models.User, entryId int, key string) error
 	GetConfigBanner() (string, error)
 
 	GetFormFillEnabled() (bool, error)
@@ -84,8 +128,11 @@ type Logic interface {
 	GetMaxDescriptionLength() (int, error)
 	GetMinNameLength() (int, error)
 	GetMaxLinkLength() (int, error)
+	GetMaxUploadlimit() (int, error)
 	GetMaxNameLength() (int, error)
 	GetAutofillEnabled() (bool, error)
+	SearchMetadata(title string, year int) ([]*MetadataCandidate, error)
+	PrefillFromMetadata(linkUrl string) (map[string]*InputField, error)
 	GetPastCycles(start, count int) ([]*models.Cycle, error)
 	GetPreviousCycle() *models.Cycle
 
@@ -105,6 +152,13 @@ type Logic interface {
 	GetDiscordOauthClientSecret() (string, error)
 	GetPatreonOauthClientID() (string, error)
 	GetPatreonOauthClientSecret() (string, error)
+	GetTwitchBotEnabled() (bool, error)
+	GetTwitchBotServer() (string, error)
+	GetTwitchBotUsername() (string, error)
+	GetTwitchBotOauthToken() (string, error)
+	GetTwitchBotChannel() (string, error)
+	GetMetricsToken() (string, error)
+	GetMetricsAllowedIPs() ([]string, error)
 
 	SetCfgInt(key string, value int) error
 	SetCfgBool(key string, value bool) error
@@ -112,6 +166,18 @@ type Logic interface {
 	GetCfgInt(key string, defVal int) (int, error)
 	GetCfgBool(key string, defVal bool) (bool, error)
 	GetCfgString(key string, defVal string) (string, error)
+
+	// Logging
+	WithRequestId(id string) Logic
+
+	// Health checks
+	Ping() error
+
+	// Rate limiting
+	RateLimit(action RateLimitAction, ip string, user *models.User) time.Duration
+	GetThrottledClients() []*ThrottledClient
+	ClearThrottle(key string) *ThrottledClient
+	GetTrustForwardedFor() (bool, error)
 }
 
 type InputField struct {
@@ -125,18 +191,67 @@ type backend struct {
 	authKey      string
 	encryptKey   string
 	passwordSalt string
+	config       *configRegistry
+	overrides    map[string]configOverride
 	l            *logger.Logger
+
+	cycleEndHandlers []CycleEndHandler
+
+	// Result of the last scheduled poster sweep.  A pointer so it's shared
+	// with the copies made by WithRequestId().
+	sweep *posterSweepState
+
+	// Shared with the copies too
+	limiter *rateLimiter
 }
 
-func New(db database.Database, log *logger.Logger) (Logic, error) {
+type posterSweepState struct {
+	lock sync.Mutex
+	last *PosterSweep
+}
+
+// WithRequestId returns a backend whose log messages carry the ID of the
+// current request.  Everything else is shared with b.
+func (b *backend) WithRequestId(id string) Logic {
+	cp := *b
+	cp.l = b.l.With("request_id", id)
+	return &cp
+}
+
+// New creates the backend.  boot can be nil if there's no config file or
+// environment variables to apply.
+func New(db database.Database, log *logger.Logger, boot *BootstrapConfig) (Logic, error) {
 	back := &backend{
-		data:    db,
-		urlKeys: make(map[string]*models.UrlKey),
-		l:       log,
+		data:      db,
+		urlKeys:   make(map[string]*models.UrlKey),
+		config:    defaultConfig(),
+		overrides: make(map[string]configOverride),
+		l:         log,
+		sweep:     &posterSweepState{},
+		limiter:   newRateLimiter(),
+	}
+
+	var secretKey []byte
+	if boot != nil {
+		secretKey = boot.SecretKey
+	}
+
+	err := back.setupSecrets(secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = back.applyBootstrap(boot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = back.LoadDefaultsIfNotSet()
+	if err != nil {
+		return nil, err
 	}
 
-	back.setupConfig()
-	err := back.LoadDefaultsIfNotSet()
+	err = back.addNewMetadataProviders()
 	if err != nil {
 		return nil, err
 	}
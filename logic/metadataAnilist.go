@@ -0,0 +1,352 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+func init() {
+	models.RegisterLinkType("AniList", func(url string) bool {
+		return strings.Contains(url, "anilist.co")
+	})
+	registerMetadataProvider("anilist", newAnilist)
+}
+
+const anilistApiUrl = "https://graphql.anilist.co"
+
+const anilistQuery = `query ($id: Int) {
+  Media(id: $id, type: ANIME) {
+    id
+    idMal
+    title { romaji english }
+    description(asHtml: false)
+    coverImage { extraLarge large }
+    format
+    episodes
+    duration
+    averageScore
+    genres
+    seasonYear
+  }
+}`
+
+const anilistSearchQuery = `query ($search: String, $year: Int, $perPage: Int) {
+  Page(perPage: $perPage) {
+    media(search: $search, seasonYear: $year, type: ANIME) {
+      id
+      title { romaji english }
+      coverImage { large }
+      format
+      seasonYear
+    }
+  }
+}`
+
+var re_anilistToken = regexp.MustCompile(`anilist\.co\/anime\/([0-9]+)`)
+var re_htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// anilist looks up AniList links with the AniList GraphQL API.
+type anilist struct {
+	l   *logger.Logger
+	url string // API endpoint, changed in tests
+
+	bannedFormats []string
+	maxEpisodes   int
+	maxDuration   int
+}
+
+type anilistMedia struct {
+	Id    int
+	IdMal int
+	Title struct {
+		Romaji  string
+		English string
+	}
+	Description string
+	CoverImage  struct {
+		ExtraLarge string
+		Large      string
+	}
+	Format       string
+	Episodes     int
+	Duration     int // minutes per episode
+	AverageScore int // 0-100
+	Genres       []string
+	SeasonYear   int
+}
+
+func newAnilist(b *backend) (MetadataProvider, error) {
+	enabled, err := b.GetAnilistEnabled()
+	if err != nil {
+		b.l.Debug(err.Error())
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	if !enabled {
+		return nil, fmt.Errorf("AniList API usage was not enabled by the site administrator")
+	}
+
+	bannedFormats, err := b.GetAnilistBannedFormats()
+	if err != nil {
+		b.l.Debug("Error while retriving config value '%s':\n %v", ConfigAnilistBannedFormats, err)
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	maxEpisodes, err := b.GetAnilistMaxEpisodes()
+	if err != nil {
+		b.l.Debug("Error while retriving config value '%s':\n %v", ConfigAnilistMaxEpisodes, err)
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	maxDuration, err := b.GetMaxDuration()
+	if err != nil {
+		b.l.Debug("Error while retriving config value 'MaxMultEpLength':\n %v", err)
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	return &anilist{
+		l:             b.l,
+		url:           anilistApiUrl,
+		bannedFormats: bannedFormats,
+		maxEpisodes:   maxEpisodes,
+		maxDuration:   maxDuration,
+	}, nil
+}
+
+func (a *anilist) Lookup(link *models.Link) (*MetadataResult, error) {
+	match := re_anilistToken.FindStringSubmatch(link.Url)
+	if len(match) < 2 {
+		a.l.Debug("Regex match didn't find the anime id in %v", link.Url)
+		return nil, fmt.Errorf("Could not retrive anime id from provided link, did you input a manga link?")
+	}
+	id := match[1]
+
+	media, err := a.requestResults(id)
+	if err != nil {
+		a.l.Debug("Error while accessing AniList API: %v", err)
+		return nil, fmt.Errorf("Could not complete autofill, contact your site administrator\n Error: %s", err.Error())
+	}
+
+	if err = a.checkLimits(media); err != nil {
+		return nil, err
+	}
+
+	result := &MetadataResult{
+		SourceId:    "anilist-" + id,
+		Title:       media.Title.Romaji,
+		Description: cleanAnilistDescription(media.Description),
+		PosterUrl:   media.CoverImage.ExtraLarge,
+		Rating:      float32(media.AverageScore) / 10,
+		Tags:        append([]string{"AniList"}, media.Genres...),
+		Year:        media.SeasonYear,
+		ExternalIds: map[string]string{"anilist": id},
+	}
+
+	if result.Title == "" {
+		result.Title = media.Title.English
+	} else if media.Title.English != "" && media.Title.English != media.Title.Romaji {
+		result.Title += " (" + media.Title.English + ")"
+	}
+
+	if result.Title == "" {
+		return nil, fmt.Errorf("No title returned from API")
+	}
+
+	if result.PosterUrl == "" {
+		result.PosterUrl = media.CoverImage.Large
+	}
+
+	if media.IdMal != 0 {
+		result.ExternalIds["myanimelist"] = fmt.Sprintf("%d", media.IdMal)
+	}
+
+	if media.Duration > 0 {
+		if media.Episodes > 1 {
+			result.Runtime = fmt.Sprintf("%d eps x %d min", media.Episodes, media.Duration)
+		} else {
+			result.Runtime = fmt.Sprintf("%v hr %v min", media.Duration/60, media.Duration%60)
+		}
+	}
+
+	return result, nil
+}
+
+// checkLimits applies the same kind of limits as the Jikan provider: banned
+// formats, a maximum episode count and a maximum total duration.
+func (a *anilist) checkLimits(media *anilistMedia) error {
+	for _, format := range a.bannedFormats {
+		if strings.EqualFold(strings.TrimSpace(format), media.Format) {
+			return fmt.Errorf("The anime format %s was banned by the sites administrator. Please choose a different format!", media.Format)
+		}
+	}
+
+	if media.Episodes == 0 {
+		return fmt.Errorf("The episode count of this anime has not been published yet. Therefore this anime can not be added.")
+	}
+
+	if media.Episodes > a.maxEpisodes && a.maxEpisodes != 0 {
+		return fmt.Errorf("The anime has too many (%d) episodes. The site administrator only allowed animes up to %d episodes.", media.Episodes, a.maxEpisodes)
+	}
+
+	if a.maxDuration >= 0 && media.Duration*media.Episodes > a.maxDuration {
+		a.l.Error("Duration of the anime %s is too long: %d", media.Title.Romaji, media.Duration*media.Episodes)
+		return fmt.Errorf("The duration of this series (episode duration * episodes) is longer than the maximum duration defined by the admin. Therefore this anime can not be added.")
+	}
+
+	return nil
+}
+
+func (a *anilist) requestResults(id string) (*anilistMedia, error) {
+	var mediaId int
+	if _, err := fmt.Sscanf(id, "%d", &mediaId); err != nil {
+		return nil, fmt.Errorf("Invalid anime id %q", id)
+	}
+
+	var dat struct {
+		Media *anilistMedia
+	}
+
+	err := a.query(anilistQuery, map[string]interface{}{"id": mediaId}, &dat)
+	if err != nil {
+		return nil, err
+	}
+
+	if dat.Media == nil {
+		return nil, fmt.Errorf("No anime found with id %d", mediaId)
+	}
+
+	return dat.Media, nil
+}
+
+// Search uses the media search of the API.  Banned formats are left out of
+// the results, the other limits are checked when a result is picked.
+func (a *anilist) Search(title string, year int) ([]*MetadataCandidate, error) {
+	variables := map[string]interface{}{
+		"search":  title,
+		"perPage": maxSearchResults * 2,
+	}
+	if year != 0 {
+		variables["year"] = year
+	}
+
+	var dat struct {
+		Page struct {
+			Media []*anilistMedia
+		}
+	}
+
+	err := a.query(anilistSearchQuery, variables, &dat)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []*MetadataCandidate{}
+results:
+	for _, media := range dat.Page.Media {
+		if len(candidates) >= maxSearchResults {
+			break
+		}
+
+		for _, format := range a.bannedFormats {
+			if strings.EqualFold(strings.TrimSpace(format), media.Format) {
+				continue results
+			}
+		}
+
+		title := media.Title.Romaji
+		if title == "" {
+			title = media.Title.English
+		}
+
+		candidates = append(candidates, &MetadataCandidate{
+			Title:     title,
+			Year:      media.SeasonYear,
+			PosterUrl: media.CoverImage.Large,
+			Link:      fmt.Sprintf(canonicalLinks["anilist"], strconv.Itoa(media.Id)),
+		})
+	}
+
+	return candidates, nil
+}
+
+// query sends a GraphQL query to the API and unmarshals the data of the
+// response into out.
+func (a *anilist) query(query string, variables map[string]interface{}, out interface{}) error {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Tried to access API - Error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("The AniList API is rate limiting requests, try again in a minute")
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var dat struct {
+		Data   json.RawMessage
+		Errors []struct {
+			Message string
+			Status  int
+		}
+	}
+
+	if err := json.Unmarshal(body, &dat); err != nil {
+		return fmt.Errorf("Error while unmarshalling json response")
+	}
+
+	if len(dat.Errors) > 0 {
+		if dat.Errors[0].Status == http.StatusNotFound {
+			return fmt.Errorf("Not found on AniList")
+		}
+		return fmt.Errorf("Tried to access API - Response Code: %v Error: %s", resp.Status, dat.Errors[0].Message)
+	}
+
+	if resp.StatusCode != http.StatusOK || len(dat.Data) == 0 {
+		return fmt.Errorf("Tried to access API - Response Code: %v", resp.Status)
+	}
+
+	if err := json.Unmarshal(dat.Data, out); err != nil {
+		return fmt.Errorf("Error while unmarshalling json response")
+	}
+
+	return nil
+}
+
+// AniList descriptions contain some HTML even when asking for plain text.
+func cleanAnilistDescription(desc string) string {
+	desc = strings.ReplaceAll(desc, "<br>", "\n")
+	desc = re_htmlTag.ReplaceAllString(desc, "")
+	for strings.Contains(desc, "\n\n\n") {
+		desc = strings.ReplaceAll(desc, "\n\n\n", "\n\n")
+	}
+	return strings.TrimSpace(desc)
+}
@@ -0,0 +1,148 @@
+package logic
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// newAnilistFixture serves the recorded API responses in testdata, or the
+// given status code if it isn't 200.
+func newAnilistFixture(t *testing.T, status int) *fixtureServer {
+	return newFixtureServer(t, func(r *http.Request) fixture {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Method != http.MethodPost:
+			return fixture{}
+		case strings.Contains(string(body), `"search":"akira"`):
+			return fixture{File: "anilist-search.json"}
+		case !strings.Contains(string(body), `"id":47`):
+			return fixture{File: "anilist-error.json", Status: http.StatusBadRequest}
+		case status != http.StatusOK:
+			return fixture{Status: status}
+		}
+		return fixture{File: "anilist-akira.json"}
+	})
+}
+
+func newTestAnilist(url string) *anilist {
+	return &anilist{
+		l:             logger.NewSilent(),
+		url:           url,
+		bannedFormats: []string{"TV", "TV_SHORT"},
+		maxEpisodes:   1,
+		maxDuration:   -1,
+	}
+}
+
+func Test_AnilistLookup(t *testing.T) {
+	server := newAnilistFixture(t, http.StatusOK)
+
+	a := newTestAnilist(server.URL)
+	result, err := a.Lookup(&models.Link{Url: "https://anilist.co/anime/47/AKIRA/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Title != "AKIRA (Akira)" {
+		t.Errorf("Unexpected title %q", result.Title)
+	}
+
+	if result.SourceId != "anilist-47" {
+		t.Errorf("Unexpected source id %q", result.SourceId)
+	}
+
+	if strings.Contains(result.Description, "<br>") || !strings.HasSuffix(result.Description, "(Source: Crunchyroll)") {
+		t.Errorf("Unexpected description %q", result.Description)
+	}
+
+	if !strings.HasSuffix(result.PosterUrl, "/large/bx47-jeFpFrwWwC5E.jpg") {
+		t.Errorf("Unexpected poster %q", result.PosterUrl)
+	}
+
+	if result.Runtime != "2 hr 4 min" {
+		t.Errorf("Unexpected runtime %q", result.Runtime)
+	}
+
+	if result.Rating != 7.8 || result.Year != 1988 {
+		t.Errorf("Unexpected rating %v or year %d", result.Rating, result.Year)
+	}
+
+	if strings.Join(result.Tags, ",") != "AniList,Action,Adventure,Sci-Fi" {
+		t.Errorf("Unexpected tags %v", result.Tags)
+	}
+
+	if result.ExternalIds["anilist"] != "47" || result.ExternalIds["myanimelist"] != "47" {
+		t.Errorf("Unexpected external ids %v", result.ExternalIds)
+	}
+}
+
+func Test_AnilistLimits(t *testing.T) {
+	server := newAnilistFixture(t, http.StatusOK)
+
+	link := &models.Link{Url: "https://anilist.co/anime/47"}
+
+	a := newTestAnilist(server.URL)
+	a.bannedFormats = []string{"movie"}
+	if _, err := a.Lookup(link); err == nil || !strings.Contains(err.Error(), "banned") {
+		t.Errorf("Expected banned format error, got %v", err)
+	}
+
+	a = newTestAnilist(server.URL)
+	a.maxEpisodes = 0
+	a.maxDuration = 90
+	if _, err := a.Lookup(link); err == nil || !strings.Contains(err.Error(), "duration") {
+		t.Errorf("Expected duration error, got %v", err)
+	}
+
+	if _, err := a.Lookup(&models.Link{Url: "https://anilist.co/manga/30664"}); err == nil {
+		t.Errorf("Expected an error for a manga link")
+	}
+}
+
+func Test_AnilistErrors(t *testing.T) {
+	server := newAnilistFixture(t, http.StatusTooManyRequests)
+
+	a := newTestAnilist(server.URL)
+	if _, err := a.Lookup(&models.Link{Url: "https://anilist.co/anime/47"}); err == nil || !strings.Contains(err.Error(), "rate limiting") {
+		t.Errorf("Expected rate limit error, got %v", err)
+	}
+
+	if _, err := a.Lookup(&models.Link{Url: "https://anilist.co/anime/48"}); err == nil || !strings.Contains(err.Error(), "Bad request") {
+		t.Errorf("Expected API error, got %v", err)
+	}
+}
+
+func Test_AnilistSearch(t *testing.T) {
+	server := newAnilistFixture(t, http.StatusOK)
+
+	a := newTestAnilist(server.URL)
+	a.bannedFormats = []string{"MUSIC"}
+
+	candidates, err := a.Search("akira", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(candidates) != 1 {
+		t.Fatalf("Expected one candidate, got %d", len(candidates))
+	}
+
+	if candidates[0].Title != "AKIRA" || candidates[0].Year != 1988 || candidates[0].Link != "https://anilist.co/anime/47" {
+		t.Errorf("Unexpected candidate %+v", candidates[0])
+	}
+
+	// The picked link has to be one the provider can look up.
+	link, err := models.NewLink(candidates[0].Link, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Lookup(link); err != nil {
+		t.Errorf("Unable to look up picked candidate: %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+func init() {
+	models.RegisterLinkType("MyAnimeList", func(url string) bool {
+		return strings.Contains(url, "myanimelist")
+	})
+	registerMetadataProvider("jikan", newJikan)
+}
+
+const jikanApiUrl = "https://api.jikan.moe/v4"
+
+var re_jikanToken = regexp.MustCompile(`[^\/]*\/anime\/([0-9]+)`)
+var re_duration = regexp.MustCompile(`([0-9]{1,3}) min`)
+
+// jikan looks up MyAnimeList links with the Jikan API.
+type jikan struct {
+	l             *logger.Logger
+	url           string // API endpoint, changed in tests
+	excludedTypes []string
+	maxEpisodes   int
+	maxDuration   int
+}
+
+func newJikan(b *backend) (MetadataProvider, error) {
+	jikanEnabled, err := b.GetJikanEnabled()
+	if err != nil {
+		b.l.Debug(err.Error())
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	if !jikanEnabled {
+		return nil, fmt.Errorf("Jikan API usage was not enabled by the site administrator")
+	}
+
+	bannedTypes, err := b.GetJikanBannedTypes()
+	if err != nil {
+		b.l.Debug("Error while retriving config value 'JikanBannedTypes':\n %v", err)
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	maxEpisodes, err := b.GetJikanMaxEpisodes()
+	if err != nil {
+		b.l.Debug("Error while retriving config value 'JikanMaxEpisodes':\n %v", err)
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	maxDuration, err := b.GetMaxDuration()
+	if err != nil {
+		b.l.Debug("Error while retriving config value 'MaxMultEpLength':\n %v", err)
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	return &jikan{
+		l:             b.l,
+		url:           jikanApiUrl,
+		excludedTypes: bannedTypes,
+		maxEpisodes:   maxEpisodes,
+		maxDuration:   maxDuration,
+	}, nil
+}
+
+func (j *jikan) Lookup(link *models.Link) (*MetadataResult, error) {
+	// Get Data from MAL (jikan api)
+	match := re_jikanToken.FindStringSubmatch(link.Url)
+	if len(match) < 2 {
+		j.l.Debug("Regex match didn't find the anime id in %v", link.Url)
+		return nil, fmt.Errorf("Could not retrive anime id from provided link, did you input a manga link?")
+	}
+	id := match[1]
+
+	dat, err := j.requestResults(id)
+	if err != nil {
+		j.l.Debug("Error while accessing Jikan API: %v", err)
+		return nil, fmt.Errorf("Could not complete autofill, contact your site administrator\n Error: %s", err.Error())
+	}
+
+	result := &MetadataResult{
+		SourceId:    id,
+		Tags:        []string{"MAL"},
+		ExternalIds: map[string]string{"myanimelist": id},
+	}
+
+	title, ok := dat["title"].(string)
+	if !ok {
+		return nil, errors.New("No title returned from API")
+	}
+	result.Title = title
+
+	if english, ok := dat["title_english"].(string); ok && english != title {
+		result.Title += " (" + english + ")"
+	}
+
+	if synopsis, ok := dat["synopsis"].(string); ok {
+		result.Description = synopsis
+	}
+
+	if images, ok := dat["images"].(map[string]interface{}); ok {
+		if jpg, ok := images["jpg"].(map[string]interface{}); ok {
+			if url, ok := jpg["large_image_url"].(string); ok {
+				result.PosterUrl = url
+			}
+		}
+	}
+
+	if duration, ok := dat["duration"].(string); ok {
+		result.Runtime = duration
+	}
+
+	if score, ok := dat["score"].(float64); ok {
+		result.Rating = float32(score)
+	}
+
+	if year, ok := dat["year"].(float64); ok {
+		result.Year = int(year)
+	}
+
+	if genres, ok := dat["genres"].([]interface{}); ok {
+		for _, tag := range genres {
+			if tg, ok := tag.(map[string]interface{}); ok {
+				if name, ok := tg["name"].(string); ok {
+					result.Tags = append(result.Tags, name)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Search uses the Jikan anime search.  Banned types are left out of the
+// results, the other limits are checked when a result is picked.
+func (j *jikan) Search(title string, year int) ([]*MetadataCandidate, error) {
+	url := fmt.Sprintf("%s/anime?q=%s&limit=%d", j.url, neturl.QueryEscape(title), maxSearchResults*2)
+	if year != 0 {
+		url = fmt.Sprintf("%s&start_date=%d-01-01&end_date=%d-12-31", url, year, year)
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Tried to access API - Error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("Tried to access API - Response Code: " + resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var dat struct {
+		Data []struct {
+			Mal_Id int
+			Title  string
+			Type   string
+			Year   int
+			Images struct {
+				Jpg struct {
+					Image_Url string
+				}
+			}
+		}
+	}
+
+	if err := json.Unmarshal(body, &dat); err != nil {
+		return nil, errors.New("Error while unmarshalling json response")
+	}
+
+	candidates := []*MetadataCandidate{}
+results:
+	for _, anime := range dat.Data {
+		if len(candidates) >= maxSearchResults {
+			break
+		}
+
+		for _, etype := range j.excludedTypes {
+			if strings.EqualFold(anime.Type, etype) {
+				continue results
+			}
+		}
+
+		candidates = append(candidates, &MetadataCandidate{
+			Title:     anime.Title,
+			Year:      anime.Year,
+			PosterUrl: anime.Images.Jpg.Image_Url,
+			Link:      fmt.Sprintf(canonicalLinks["myanimelist"], strconv.Itoa(anime.Mal_Id)),
+		})
+	}
+
+	return candidates, nil
+}
+
+func (j *jikan) requestResults(id string) (map[string]interface{}, error) {
+	url := j.url + "/anime/" + id
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("\n\nTried to access API - Error: %v\n Request URL: %s\n", err, url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("\n\nTried to access API - Response Code: " + resp.Status + "\n Request URL: " + url + "\n")
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawDat map[string]map[string]interface{}
+
+	if err := json.Unmarshal(body, &rawDat); err != nil {
+		return nil, errors.New("Error while unmarshalling json response")
+	}
+
+	dat := rawDat["data"]
+
+	thisType, _ := dat["type"].(string)
+	for _, etype := range j.excludedTypes {
+		if strings.EqualFold(thisType, etype) {
+			return nil, fmt.Errorf("The anime type %s was banned by the sites administrator. Please choose a different type!", thisType)
+		}
+	}
+
+	episodes, ok := dat["episodes"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("The episode count of this anime has not been published yet. Therefore this anime can not be added.")
+	}
+
+	if int(episodes) > j.maxEpisodes && j.maxEpisodes != 0 {
+		return nil, fmt.Errorf("The anime has too many (%d) episodes. The site administrator only allowed animes up to %d episodes.", int(episodes), j.maxEpisodes)
+	}
+
+	if durStr, ok := dat["duration"].(string); ok && durStr != "Unknown" && j.maxDuration >= 0 {
+		match := re_duration.FindStringSubmatch(durStr)
+		if len(match) < 2 {
+			j.l.Error("Could not detect episode duration.")
+			return nil, fmt.Errorf("The episode duration of this anime has not been published or has an unexpected format. Therefore this anime can not be added.")
+		}
+		duration, err := strconv.Atoi(match[1])
+
+		if err != nil {
+			j.l.Error("Could not convert duration %v to int", match[1])
+			return nil, fmt.Errorf("The episode duration of this anime has not been published or has an unexpected format. Therefore this anime can not be added.")
+		}
+
+		if duration*int(episodes) > j.maxDuration {
+			j.l.Error("Duration of the anime %v is too long: %d", dat["title"], duration*int(episodes))
+			return nil, fmt.Errorf("The duration of this series (episode duration * episodes) is longer than the maximum duration defined by the admin. Therefore this anime can not be added.")
+		}
+	}
+
+	return dat, nil
+}
@@ -0,0 +1,85 @@
+package logic
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// newJikanFixture serves the recorded API responses in testdata.
+func newJikanFixture(t *testing.T) *fixtureServer {
+	return newFixtureServer(t, func(r *http.Request) fixture {
+		switch {
+		case r.URL.Path == "/anime" && r.URL.Query().Get("q") == "akira":
+			return fixture{File: "jikan-search-akira.json"}
+		case r.URL.Path == "/anime/47":
+			return fixture{File: "jikan-anime-akira.json"}
+		}
+		return fixture{}
+	})
+}
+
+func newTestJikan(url string) *jikan {
+	return &jikan{
+		l:             logger.NewSilent(),
+		url:           url,
+		excludedTypes: []string{"TV", "Music"},
+		maxEpisodes:   1,
+		maxDuration:   -1,
+	}
+}
+
+func Test_JikanSearch(t *testing.T) {
+	server := newJikanFixture(t)
+
+	j := newTestJikan(server.URL)
+
+	candidates, err := j.Search("akira", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The TV series and the music video are banned
+	if len(candidates) != 1 {
+		t.Fatalf("Expected one candidate, got %d", len(candidates))
+	}
+
+	c := candidates[0]
+	if c.Title != "Akira" || c.Year != 1988 || c.Link != "https://myanimelist.net/anime/47" {
+		t.Errorf("Unexpected candidate %+v", c)
+	}
+
+	if c.PosterUrl != "https://cdn.myanimelist.net/images/anime/1405/143284.jpg" {
+		t.Errorf("Unexpected poster %q", c.PosterUrl)
+	}
+
+	// The picked link has to be one the provider can look up.
+	link, err := models.NewLink(c.Link, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if link.Type != "MyAnimeList" {
+		t.Errorf("Expected a MyAnimeList link, got %q", link.Type)
+	}
+
+	result, err := j.Lookup(link)
+	if err != nil {
+		t.Fatalf("Unable to look up picked candidate: %v", err)
+	}
+
+	if result.Title != "Akira" || result.Runtime != "2 hr 4 min" || result.ExternalIds["myanimelist"] != "47" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+func Test_JikanSearchError(t *testing.T) {
+	server := newJikanFixture(t)
+
+	j := newTestJikan(server.URL)
+	if _, err := j.Search("nothing", 0); err == nil {
+		t.Errorf("Expected an error for a failed search")
+	}
+}
@@ -0,0 +1,336 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+func init() {
+	models.RegisterLinkType("IMDb", func(url string) bool {
+		return strings.Contains(url, "imdb")
+	})
+	models.RegisterLinkType("TMDB", func(url string) bool {
+		return strings.Contains(url, "themoviedb.org")
+	})
+	registerMetadataProvider("tmdb", newTmdb)
+}
+
+const tmdbApiUrl = "https://api.themoviedb.org/3"
+
+var re_tmdbToken = regexp.MustCompile(`[^\/]*\/title\/(tt[0-9]*)`)
+var re_tmdbLink = regexp.MustCompile(`themoviedb\.org\/(movie|tv)\/([0-9]+)`)
+
+// tmdb looks up IMDb and TMDB links with The Movie Database API.  Links to
+// series are limited by the number of episodes and the total runtime.
+type tmdb struct {
+	l           *logger.Logger
+	url         string // API endpoint, changed in tests
+	token       string
+	maxEpisodes int
+	maxDuration int
+}
+
+func newTmdb(b *backend) (MetadataProvider, error) {
+	tmdbEnabled, err := b.GetTmdbEnabled()
+	if err != nil {
+		b.l.Error(err.Error())
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	if !tmdbEnabled {
+		b.l.Debug("Aborting Tmdb autofill since it is not enabled")
+		return nil, fmt.Errorf("Tmdb API usage was not enabled by the site administrator")
+	}
+
+	// Retrieve token from database
+	token, err := b.GetTmdbToken()
+	if err != nil || token == "" {
+		b.l.Debug("Aborting Tmdb autofill since no token was found, its either empty or was never set")
+		return nil, fmt.Errorf("The Tmdb integration is not configured correctly, contact the site administrator")
+	}
+
+	maxEpisodes, err := b.GetTmdbMaxEpisodes()
+	if err != nil {
+		b.l.Debug("Error while retriving config value '%s':\n %v", ConfigTmdbMaxEpisodes, err)
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	maxDuration, err := b.GetMaxDuration()
+	if err != nil {
+		b.l.Debug("Error while retriving config value 'MaxMultEpLength':\n %v", err)
+		return nil, fmt.Errorf("Something went wrong :C")
+	}
+
+	return &tmdb{
+		l:           b.l,
+		url:         tmdbApiUrl,
+		token:       token,
+		maxEpisodes: maxEpisodes,
+		maxDuration: maxDuration,
+	}, nil
+}
+
+func (t *tmdb) Lookup(link *models.Link) (*MetadataResult, error) {
+	var dat map[string]interface{}
+	var series bool
+	var err error
+	var result *MetadataResult
+
+	if match := re_tmdbLink.FindStringSubmatch(link.Url); match != nil {
+		// Links from the search results point straight at the details
+		series = match[1] == "tv"
+		dat, err = t.requestDetails(match[1], match[2])
+		result = &MetadataResult{
+			SourceId:    "tmdb-" + match[2],
+			Tags:        []string{"TMDB"},
+			ExternalIds: map[string]string{},
+		}
+		if imdbId, ok := dat["imdb_id"].(string); ok && imdbId != "" {
+			result.ExternalIds["imdb"] = imdbId
+		}
+	} else {
+		// get the movie id
+		match := re_tmdbToken.FindStringSubmatch(link.Url)
+		if len(match) < 2 {
+			t.l.Debug("Regex match didn't find the movie id in %v", link.Url)
+			return nil, fmt.Errorf("Could not retrive movie information from the first provided link")
+		}
+		id := match[1]
+
+		dat, series, err = t.requestResults(id)
+		result = &MetadataResult{
+			SourceId:    id,
+			Tags:        []string{"IMDB"},
+			ExternalIds: map[string]string{"imdb": id},
+		}
+	}
+
+	if err != nil {
+		t.l.Debug("Error while accessing Tmdb API: %v", err)
+		return nil, fmt.Errorf("Could not complete autofill, contact your site administrator\n Error: %s", err.Error())
+	}
+
+	// Series use different keys for the same things.
+	titleKey, releaseKey, idKey := "title", "release_date", "tmdb"
+	if series {
+		titleKey, releaseKey, idKey = "name", "first_air_date", "tmdb-tv"
+	}
+
+	if title, ok := dat[titleKey].(string); ok {
+		result.Title = title
+	} else {
+		return nil, errors.New("No title returned from API")
+	}
+
+	if release, ok := dat[releaseKey].(string); ok && len(release) >= 4 {
+		result.Year, _ = strconv.Atoi(release[0:4])
+		result.Title = result.Title + " (" + release[0:4] + ")"
+	}
+
+	if tmdbId, ok := dat["id"].(float64); ok {
+		result.ExternalIds[idKey] = fmt.Sprintf("%d", int(tmdbId))
+	}
+
+	if desc, ok := dat["overview"].(string); ok {
+		result.Description = desc
+	}
+
+	if path, ok := dat["poster_path"].(string); ok && path != "" {
+		result.PosterUrl = "https://image.tmdb.org/t/p/original" + path
+	}
+
+	if series {
+		episodes, runtime, err := t.checkSeries(dat)
+		if err != nil {
+			return nil, err
+		}
+
+		if episodes > 1 {
+			result.Runtime = fmt.Sprintf("%d eps x %d min", episodes, runtime)
+		} else {
+			result.Runtime = fmt.Sprintf("%v hr %v min", runtime/60, runtime%60)
+		}
+	} else if runtime, ok := dat["runtime"].(float64); ok {
+		result.Runtime = fmt.Sprintf("%v hr %v min", int(runtime)/60, int(runtime)%60)
+	}
+
+	if rating, ok := dat["vote_average"].(float64); ok {
+		result.Rating = float32(rating)
+	}
+
+	if genres, ok := dat["genres"].([]interface{}); ok {
+		for _, tag := range genres {
+			if tg, ok := tag.(map[string]interface{}); ok {
+				if name, ok := tg["name"].(string); ok {
+					result.Tags = append(result.Tags, name)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Search uses the TMDB movie search.  The candidates link to the movie on
+// TMDB, so the details are only requested when one is picked.
+func (t *tmdb) Search(title string, year int) ([]*MetadataCandidate, error) {
+	url := fmt.Sprintf("%s/search/movie?api_key=%v&language=en-US&query=%v",
+		t.url, t.token, neturl.QueryEscape(title))
+	if year != 0 {
+		url = fmt.Sprintf("%s&year=%d", url, year)
+	}
+
+	body, err := t.get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var dat struct {
+		Results []struct {
+			Id           int
+			Title        string
+			Release_Date string
+			Poster_Path  string
+		}
+	}
+
+	if err := json.Unmarshal(body, &dat); err != nil {
+		return nil, errors.New("Error while unmarshalling json response")
+	}
+
+	candidates := []*MetadataCandidate{}
+	for _, movie := range dat.Results {
+		if len(candidates) >= maxSearchResults {
+			break
+		}
+
+		candidate := &MetadataCandidate{
+			Title: movie.Title,
+			Link:  fmt.Sprintf(canonicalLinks["tmdb"], strconv.Itoa(movie.Id)),
+		}
+
+		if len(movie.Release_Date) >= 4 {
+			candidate.Year, _ = strconv.Atoi(movie.Release_Date[0:4])
+		}
+
+		if movie.Poster_Path != "" {
+			candidate.PosterUrl = "https://image.tmdb.org/t/p/w185" + movie.Poster_Path
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, nil
+}
+
+// checkSeries returns the episode count and the runtime of an episode of a
+// series if it is within the configured limits.
+func (t *tmdb) checkSeries(dat map[string]interface{}) (int, int, error) {
+	episodes, ok := dat["number_of_episodes"].(float64)
+	if !ok || episodes == 0 {
+		return 0, 0, fmt.Errorf("The episode count of this series has not been published yet. Therefore this series can not be added.")
+	}
+
+	if int(episodes) > t.maxEpisodes && t.maxEpisodes != 0 {
+		return 0, 0, fmt.Errorf("The series has too many (%d) episodes. The site administrator only allowed series up to %d episodes.", int(episodes), t.maxEpisodes)
+	}
+
+	// episode_run_time is empty for a lot of newer series, fall back to the
+	// runtime of the latest episode.
+	runtime := 0
+	if runtimes, ok := dat["episode_run_time"].([]interface{}); ok && len(runtimes) > 0 {
+		if rt, ok := runtimes[0].(float64); ok {
+			runtime = int(rt)
+		}
+	}
+
+	if runtime == 0 {
+		if last, ok := dat["last_episode_to_air"].(map[string]interface{}); ok {
+			if rt, ok := last["runtime"].(float64); ok {
+				runtime = int(rt)
+			}
+		}
+	}
+
+	if runtime == 0 {
+		return 0, 0, fmt.Errorf("The episode duration of this series has not been published. Therefore this series can not be added.")
+	}
+
+	if t.maxDuration >= 0 && runtime*int(episodes) > t.maxDuration {
+		t.l.Error("Duration of the series %v is too long: %d", dat["name"], runtime*int(episodes))
+		return 0, 0, fmt.Errorf("The duration of this series (episode duration * episodes) is longer than the maximum duration defined by the admin. Therefore this series can not be added.")
+	}
+
+	return int(episodes), runtime, nil
+}
+
+// requestResults returns the details of the movie or series with the IMDb
+// ID.  The bool is true if it is a series.
+func (t *tmdb) requestResults(id string) (map[string]interface{}, bool, error) {
+	url := fmt.Sprintf("%s/find/%v?api_key=%v&language=en-US&external_source=imdb_id", t.url, id, t.token)
+	body, err := t.get(url)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var tmp map[string][]struct {
+		Id int
+	}
+
+	if err := json.Unmarshal(body, &tmp); err != nil {
+		return nil, false, errors.New("Error while unmarshalling json response")
+	}
+
+	switch {
+	case len(tmp["movie_results"]) > 0:
+		dat, err := t.requestDetails("movie", strconv.Itoa(tmp["movie_results"][0].Id))
+		return dat, false, err
+	case len(tmp["tv_results"]) > 0:
+		dat, err := t.requestDetails("tv", strconv.Itoa(tmp["tv_results"][0].Id))
+		return dat, true, err
+	case len(tmp["tv_episode_results"]) > 0:
+		return nil, false, errors.New("JSON Result returned a single episode, use the link to the series instead")
+	default:
+		return nil, false, errors.New("JSON Result did not return a movie or series, make sure the imdb link is for a movie or series")
+	}
+}
+
+// requestDetails gets the details of a movie or a tv series by its TMDB ID.
+func (t *tmdb) requestDetails(kind, id string) (map[string]interface{}, error) {
+	body, err := t.get(fmt.Sprintf("%s/%s/%s?api_key=%v", t.url, kind, id, t.token))
+	if err != nil {
+		return nil, err
+	}
+
+	var dat map[string]interface{}
+
+	if err := json.Unmarshal(body, &dat); err != nil {
+		return nil, errors.New("Error while unmarshalling json response")
+	}
+
+	return dat, nil
+}
+
+func (t *tmdb) get(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Tried to access API - Error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Tried to access API - Response Code: %v\nMaybe check your tmdb api token", resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,143 @@
+package logic
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// newTmdbFixture serves the recorded API responses in testdata for the
+// Chernobyl miniseries and the Akira movie.
+func newTmdbFixture(t *testing.T) *fixtureServer {
+	fixtures := map[string]string{
+		"/find/tt7366338": "tmdb-find-chernobyl.json",
+		"/tv/87108":       "tmdb-tv-chernobyl.json",
+		"/search/movie":   "tmdb-search-akira.json",
+		"/movie/149":      "tmdb-movie-akira.json",
+	}
+
+	return newFixtureServer(t, func(r *http.Request) fixture {
+		if r.URL.Query().Get("api_key") != "token" {
+			return fixture{}
+		}
+		return fixture{File: fixtures[r.URL.Path]}
+	})
+}
+
+func newTestTmdb(url string) *tmdb {
+	return &tmdb{
+		l:           logger.NewSilent(),
+		url:         url,
+		token:       "token",
+		maxEpisodes: 0,
+		maxDuration: -1,
+	}
+}
+
+func Test_TmdbSeries(t *testing.T) {
+	server := newTmdbFixture(t)
+
+	link := &models.Link{Url: "https://www.imdb.com/title/tt7366338/"}
+
+	result, err := newTestTmdb(server.URL).Lookup(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Title != "Chernobyl (2019)" || result.Year != 2019 {
+		t.Errorf("Unexpected title %q or year %d", result.Title, result.Year)
+	}
+
+	if result.Runtime != "5 eps x 72 min" {
+		t.Errorf("Unexpected runtime %q", result.Runtime)
+	}
+
+	if !strings.HasSuffix(result.PosterUrl, "/hlLXt2tOPT6RRnjiUmoxyG1LTFi.jpg") || result.Description == "" {
+		t.Errorf("Unexpected poster %q or description %q", result.PosterUrl, result.Description)
+	}
+
+	if result.ExternalIds["imdb"] != "tt7366338" || result.ExternalIds["tmdb-tv"] != "87108" {
+		t.Errorf("Unexpected external ids %v", result.ExternalIds)
+	}
+
+	tm := newTestTmdb(server.URL)
+	tm.maxEpisodes = 4
+	if _, err := tm.Lookup(link); err == nil || !strings.Contains(err.Error(), "too many") {
+		t.Errorf("Expected too many episodes error, got %v", err)
+	}
+
+	tm = newTestTmdb(server.URL)
+	tm.maxDuration = 300
+	if _, err := tm.Lookup(link); err == nil || !strings.Contains(err.Error(), "duration") {
+		t.Errorf("Expected duration error, got %v", err)
+	}
+}
+
+func Test_TmdbSearch(t *testing.T) {
+	server := newTmdbFixture(t)
+
+	tm := newTestTmdb(server.URL)
+	candidates, err := tm.Search("akira", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the search itself, no details for each result
+	if server.Requests != 1 {
+		t.Errorf("Expected one request, got %d", server.Requests)
+	}
+
+	if len(candidates) != 3 {
+		t.Fatalf("Expected three candidates, got %d", len(candidates))
+	}
+
+	first := candidates[0]
+	if first.Title != "Akira" || first.Year != 1988 || first.Link != "https://www.themoviedb.org/movie/149" {
+		t.Errorf("Unexpected candidate %+v", first)
+	}
+	if !strings.HasSuffix(first.PosterUrl, "/w185/neZ0ykEsPqxamsX6o5QNUFILQrz.jpg") {
+		t.Errorf("Unexpected poster %q", first.PosterUrl)
+	}
+
+	if last := candidates[2]; last.Year != 0 || last.PosterUrl != "" {
+		t.Errorf("Expected no year or poster, got %+v", last)
+	}
+
+	// The picked link has to be one the provider can look up.
+	link, err := models.NewLink(first.Link, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Type != "TMDB" {
+		t.Errorf("Unexpected link type %q", link.Type)
+	}
+
+	result, err := tm.Lookup(link)
+	if err != nil {
+		t.Fatalf("Unable to look up picked candidate: %v", err)
+	}
+
+	if result.Title != "Akira (1988)" || result.Runtime != "2 hr 4 min" {
+		t.Errorf("Unexpected title %q or runtime %q", result.Title, result.Runtime)
+	}
+
+	if result.ExternalIds["imdb"] != "tt0094625" || result.ExternalIds["tmdb"] != "149" {
+		t.Errorf("Unexpected external ids %v", result.ExternalIds)
+	}
+}
+
+func Test_TmdbSeriesLink(t *testing.T) {
+	server := newTmdbFixture(t)
+
+	result, err := newTestTmdb(server.URL).Lookup(&models.Link{Url: "https://www.themoviedb.org/tv/87108"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Title != "Chernobyl (2019)" || result.Runtime != "5 eps x 72 min" {
+		t.Errorf("Unexpected title %q or runtime %q", result.Title, result.Runtime)
+	}
+}
@@ -0,0 +1,50 @@
+package logic
+
+import (
+	"time"
+
+	"github.com/zorchenhimer/MoviePolls/metrics"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+var (
+	metricVotesCast = metrics.NewCounter("moviepolls_votes_cast_total",
+		"Number of votes cast.")
+	metricMoviesAdded = metrics.NewCounter("moviepolls_movies_added_total",
+		"Number of movies added, by how the form was filled.", "method")
+	metricMetadataDuration = metrics.NewHistogram("moviepolls_metadata_request_duration_seconds",
+		"Time taken by lookups and searches at the metadata providers.", metrics.DurationBuckets, "provider", "operation")
+	metricMetadataErrors = metrics.NewCounter("moviepolls_metadata_errors_total",
+		"Number of failed lookups and searches at the metadata providers.", "provider", "operation")
+	metricRateLimited = metrics.NewCounter("moviepolls_rate_limited_total",
+		"Number of requests refused by the rate limits, by action.", "action")
+	metricLoginLockouts = metrics.NewCounter("moviepolls_login_lockouts_total",
+		"Number of times a user name was locked after failed logins.")
+)
+
+// observeMetadata records the duration and the result of a request to a
+// metadata provider.
+func observeMetadata(provider, operation string, start time.Time, err error) {
+	metricMetadataDuration.ObserveSince(start, provider, operation)
+	if err != nil {
+		metricMetadataErrors.Inc(provider, operation)
+	}
+}
+
+// timedProvider records metrics for the lookups of a metadata provider.
+type timedProvider struct {
+	name     string
+	provider MetadataProvider
+}
+
+func (t *timedProvider) Lookup(link *models.Link) (*MetadataResult, error) {
+	start := time.Now()
+	result, err := t.provider.Lookup(link)
+	observeMetadata(t.name, "lookup", start, err)
+	return result, err
+}
+
+// Ping checks that the database can be used.
+func (b *backend) Ping() error {
+	return b.data.Ping()
+}
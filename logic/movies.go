@@ -1,45 +1,108 @@
 package logic
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"mime/multipart"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/zorchenhimer/MoviePolls/models"
 )
 
-var re_tagSearch = regexp.MustCompile(`t:"([a-zA-Z ]+)"`)
+var re_tagSearch = regexp.MustCompile(`t:"([^"]+)"`)
 
-func (b *backend) SearchMovieTitles(query string) ([]*models.Movie, error) {
-	// finding tags
-	tags := re_tagSearch.FindAllString(query, -1)
-
-	// clean up the tags from the "tagsyntax"
-	tagsToFind := []string{}
-	for _, tag := range tags {
-		tagsToFind = append(tagsToFind, tag[3:len(tag)-1])
+// SearchMovies runs a ranked search.  Tags can also be given in the text
+// with the t:"tag name" syntax.
+func (b *backend) SearchMovies(query models.SearchQuery) ([]*models.Movie, error) {
+	for _, match := range re_tagSearch.FindAllStringSubmatch(query.Text, -1) {
+		if tag := cleanTagName(match[1]); tag != "" {
+			query.Tags = append(query.Tags, tag)
+		}
 	}
+	query.Text = strings.TrimSpace(re_tagSearch.ReplaceAllString(query.Text, ""))
 
-	query = re_tagSearch.ReplaceAllString(query, "")
-	query = strings.Trim(query, " ")
-
-	// we first seach for matching titles (ignoring the tags for now)
-	movieList, err := b.data.SearchMovieTitles(query)
+	results, err := b.data.SearchMovies(query)
 	if err != nil {
 		return nil, err
 	}
 
-	// NOW we filter the already found movies by the tags provided
-	return models.FilterMoviesByTags(movieList, tagsToFind)
+	movies := []*models.Movie{}
+	for _, result := range results {
+		movies = append(movies, result.Movie)
+	}
+	return movies, nil
 }
 
 func (b *backend) GetActiveMovies() ([]*models.Movie, error) {
 	return b.data.GetActiveMovies()
 }
 
+func (b *backend) GetPendingMovies() ([]*models.Movie, error) {
+	return b.data.GetPendingMovies()
+}
+
+// ApproveMovie takes a movie out of the approval queue and makes it available
+// for voting.
+func (b *backend) ApproveMovie(admin *models.User, mid int) error {
+	movie, err := b.data.GetMovie(mid)
+	if err != nil {
+		return err
+	}
+
+	if !movie.Pending {
+		return fmt.Errorf("Movie with ID %d is not awaiting approval", mid)
+	}
+
+	before := movieAuditFields(movie)
+	movie.Pending = false
+	movie.Approved = true
+	movie.Removed = false
+	movie.RejectReason = ""
+
+	b.l.Info("Approved movie %d %q", movie.Id, movie.Name)
+	err = b.data.UpdateMovie(movie)
+	if err != nil {
+		return err
+	}
+
+	b.Audit(admin, models.AUDIT_MOVIE_APPROVE, movieTarget(movie), before, movieAuditFields(movie))
+	return nil
+}
+
+// RejectMovie takes a movie out of the approval queue without approving it.
+// The reason is shown to the user that submitted the movie.
+func (b *backend) RejectMovie(admin *models.User, mid int, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return fmt.Errorf("A reason is required to reject a movie")
+	}
+
+	movie, err := b.data.GetMovie(mid)
+	if err != nil {
+		return err
+	}
+
+	if !movie.Pending {
+		return fmt.Errorf("Movie with ID %d is not awaiting approval", mid)
+	}
+
+	before := movieAuditFields(movie)
+	movie.Pending = false
+	movie.Approved = false
+	movie.Removed = true
+	movie.RejectReason = reason
+
+	b.l.Info("Rejected movie %d %q: %s", movie.Id, movie.Name, reason)
+	err = b.data.UpdateMovie(movie)
+	if err != nil {
+		return err
+	}
+
+	b.Audit(admin, models.AUDIT_MOVIE_REJECT, movieTarget(movie), before, movieAuditFields(movie))
+	return nil
+}
+
 func (b *backend) GetMovie(id int) *models.Movie {
 	m, err := b.data.GetMovie(id)
 	if err != nil {
@@ -184,21 +247,45 @@ func (b *backend) AddMovie(fields map[string]*InputField, user *models.User, fil
 
 	remarks := validatedForm["Remarks"].Value
 
+	// Likely duplicates are only reported once.  The form is sent again with
+	// DuplicateConfirm set when the user wants to add the movie anyway.
+	confirmed := false
+	if confirm, ok := fields["DuplicateConfirm"]; ok && confirm.Value == "yes" {
+		confirmed = true
+	}
+
 	var id int
 
 	if autofill {
 		var autofillErr error
 		var movieExistsErr error
 
-		id, autofillErr, movieExistsErr = b.doAutofill(links, user, remarks)
+		id, autofillErr, movieExistsErr = b.doAutofill(links, user, remarks, confirmed)
 		if autofillErr != nil {
 			validatedForm["Links"] = &InputField{Value: validatedForm["Links"].Value, Error: autofillErr}
 		}
 
-		if movieExistsErr != nil {
+		var dupErr *DuplicateError
+		if errors.As(movieExistsErr, &dupErr) {
+			validatedForm["Duplicates"] = &InputField{Error: dupErr}
+		} else if movieExistsErr != nil {
 			validatedForm["Links"] = &InputField{Value: validatedForm["Links"].Value, Error: movieExistsErr}
 		}
 	} else {
+		if !confirmed {
+			matches, err := b.FindDuplicates(validatedForm["Title"].Value, links, nil)
+			if err != nil {
+				b.l.Error("Unable to check for duplicates: %v", err)
+				validatedForm["Title"].Error = fmt.Errorf("Something went wrong :C")
+				return -1, validatedForm
+			}
+
+			if len(matches) > 0 {
+				validatedForm["Duplicates"] = &InputField{Error: &DuplicateError{Matches: matches}}
+				return -1, validatedForm
+			}
+		}
+
 		var err error
 		id, err = b.doFormfill(validatedForm, user, links, file, fileHeader)
 		if err != nil {
@@ -209,97 +296,65 @@ func (b *backend) AddMovie(fields map[string]*InputField, user *models.User, fil
 			return id, validatedForm
 		}
 	}
-	return id, validatedForm
-}
-
-func (b *backend) doAutofill(links []*models.Link, user *models.User, remarks string) (int, error, error) {
-
-	sourcelink := links[0]
-
-	results := []string{} //nolint:ineffassign,staticcheck
-
-	if sourcelink.Type == "MyAnimeList" {
-		b.l.Debug("MAL link")
-
-		apiResults, err := b.autofillJikan(sourcelink.Url)
 
-		if err != nil {
-			b.l.Error(err.Error())
-			return -1, err, nil
-		}
-
-		var title string
-
-		if len(apiResults) != 6 {
-			b.l.Error("Jikan API results have an unexpected length, expected 6 got %v", len(apiResults))
-			return -1, fmt.Errorf("API autofill did not return enough data, contact the server administrator"), nil
+	if id != -1 {
+		if autofill {
+			metricMoviesAdded.Inc("autofill")
 		} else {
-			title = apiResults[0]
+			metricMoviesAdded.Inc("formfill")
 		}
+	}
+	return id, validatedForm
+}
 
-		exists, err := b.CheckMovieExists(title)
-		if err != nil {
-			b.l.Error(err.Error())
-			return -1, fmt.Errorf("Something went wrong :C"), nil
-		}
+func (b *backend) doAutofill(links []*models.Link, user *models.User, remarks string, confirmed bool) (int, error, error) {
 
-		if exists {
-			b.l.Debug("Movie already exists")
-			return -1, nil, fmt.Errorf("Movie already exists in database")
-		}
-
-		results = apiResults
-	} else if sourcelink.Type == "IMDb" {
-		b.l.Debug("IMDB link")
+	sourcelink := links[0]
 
-		apiResults, err := b.autofillTmdb(sourcelink.Url)
+	provider, err := b.getMetadataProvider(sourcelink.Type)
+	if err != nil {
+		b.l.Debug("No autofill for %s link: %v", sourcelink.Type, err)
+		return -1, err, nil
+	}
 
-		if err != nil {
-			b.l.Error(err.Error())
-			return -1, err, nil
-		}
+	result, err := provider.Lookup(sourcelink)
+	if err != nil {
+		b.l.Error(err.Error())
+		return -1, err, nil
+	}
 
-		var title string
+	exists, err := b.CheckMovieExists(result.Title)
+	if err != nil {
+		b.l.Error(err.Error())
+		return -1, fmt.Errorf("Something went wrong :C"), nil
+	}
 
-		if len(apiResults) != 6 {
-			b.l.Error("Tmdb API results have an unexpected length, expected 6 got %v", len(apiResults))
-			return -1, fmt.Errorf("API autofill did not return enough data, did you input a link to a series?"), nil
-		} else {
-			title = apiResults[0]
-		}
+	if exists {
+		b.l.Debug("Movie already exists")
+		return -1, nil, fmt.Errorf("Movie already exists in database")
+	}
 
-		exists, err := b.CheckMovieExists(title)
+	if !confirmed {
+		matches, err := b.FindDuplicates(result.Title, links, result.ExternalIds)
 		if err != nil {
-			b.l.Error(err.Error())
+			b.l.Error("Unable to check for duplicates: %v", err)
 			return -1, fmt.Errorf("Something went wrong :C"), nil
 		}
 
-		if exists {
-			b.l.Debug("Movie already exists")
-			return -1, nil, fmt.Errorf("Movie already exists in database")
+		if len(matches) > 0 {
+			b.l.Debug("Possible duplicates for %q: %d", result.Title, len(matches))
+			return -1, nil, &DuplicateError{Matches: matches}
 		}
-
-		results = apiResults
-	} else {
-		b.l.Debug("no link")
-		return -1, fmt.Errorf("To use autofill an imdb or myanimelist link as first link is required"), nil
 	}
 
 	movie := models.Movie{}
 
 	// Fill all the fields in the movie struct
-	movie.Name = results[0]
-	movie.Description = results[1]
-	movie.Poster = results[2]
-	movie.Duration = results[3]
-
-	rating, err := strconv.ParseFloat(results[4], 32)
-	if err != nil {
-		b.l.Error("[AddMovie] Error converting string to float, defaulting to a rating of 0")
-		movie.Rating = 0.0
-	} else {
-		movie.Rating = float32(rating)
-	}
+	movie.Name = result.Title
+	movie.Description = result.Description
+	movie.Poster = b.downloadPoster(result)
+	movie.Duration = result.Runtime
+	movie.Rating = result.Rating
 
 	movie.Remarks = remarks
 
@@ -315,7 +370,8 @@ func (b *backend) doAutofill(links []*models.Link, user *models.User, remarks st
 	movie.AddedBy = user
 
 	tags := []*models.Tag{}
-	for _, tagStr := range strings.Split(results[5], ",") {
+	tagIds := map[int]bool{}
+	for _, tagStr := range cleanTagNames(result.Tags) {
 		tag := &models.Tag{
 			Name: tagStr,
 		}
@@ -326,6 +382,12 @@ func (b *backend) doAutofill(links []*models.Link, user *models.User, remarks st
 		}
 		tag.Id = id
 
+		// Two genres can be aliases of the same tag
+		if tagIds[id] {
+			continue
+		}
+		tagIds[id] = true
+
 		tags = append(tags, tag)
 	}
 
@@ -336,121 +398,6 @@ func (b *backend) doAutofill(links []*models.Link, user *models.User, remarks st
 	return id, err, nil
 }
 
-var re_jikanToken = regexp.MustCompile(`[^\/]*\/anime\/([0-9]+)`)
-
-func (b *backend) autofillJikan(sourcelink string) ([]string, error) {
-
-	jikanEnabled, err := b.GetJikanEnabled()
-	if err != nil {
-		b.l.Debug(err.Error())
-		return nil, fmt.Errorf("Something went wrong :C")
-	}
-
-	if !jikanEnabled {
-		return nil, fmt.Errorf("Jikan API usage was not enabled by the site administrator")
-	}
-
-	// Get Data from MAL (jikan api)
-	match := re_jikanToken.FindStringSubmatch(sourcelink)
-	var id string
-	if len(match) < 2 {
-		b.l.Debug("Regex match didn't find the anime id in %v", sourcelink)
-		return nil, fmt.Errorf("Could not retrive anime id from provided link, did you input a manga link?")
-	}
-	id = match[1]
-
-	bannedTypes, err := b.GetJikanBannedTypes()
-
-	if err != nil {
-		b.l.Debug("Error while retriving config value 'JikanBannedTypes':\n %v", err)
-		return nil, fmt.Errorf("Something went wrong :C")
-	}
-
-	maxEpisodes, err := b.GetJikanMaxEpisodes()
-
-	if err != nil {
-		b.l.Debug("Error while retriving config value 'JikanMaxEpisodes':\n %v", err)
-		return nil, fmt.Errorf("Something went wrong :C")
-	}
-
-	maxDuration, err := b.GetMaxDuration()
-
-	if err != nil {
-		b.l.Debug("Error while retriving config value 'MaxMultEpLength':\n %v", err)
-		return nil, fmt.Errorf("Something went wrong :C")
-	}
-
-	uploadlimit, err := b.GetMaxUploadlimit()
-
-	if err != nil {
-		b.l.Debug("Error while retriving config value 'MaxUploadLimit':\n %v", err)
-		return nil, fmt.Errorf("Something went wrong :C")
-	}
-
-	sourceAPI := jikan{id: id, l: b.l, excludedTypes: bannedTypes, maxEpisodes: maxEpisodes, maxDuration: maxDuration, uploadlimit: uploadlimit}
-
-	// Request data from API
-	results, err := getMovieData(&sourceAPI)
-
-	if err != nil {
-		b.l.Debug("Error while accessing Jikan API: %v", err)
-		return nil, fmt.Errorf("Could not complete autofill, contact your site administrator\n Error: %s", err.Error())
-	}
-
-	return results, nil
-}
-
-var re_tmdbToken = regexp.MustCompile(`[^\/]*\/title\/(tt[0-9]*)`)
-
-func (b *backend) autofillTmdb(sourcelink string) ([]string, error) {
-
-	tmdbEnabled, err := b.GetTmdbEnabled()
-	if err != nil {
-		b.l.Error(err.Error())
-		return nil, fmt.Errorf("Something went wrong :C")
-	}
-
-	if !tmdbEnabled {
-		b.l.Debug("Aborting Tmdb autofill since it is not enabled")
-		return nil, fmt.Errorf("Tmdb API usage was not enabled by the site administrator")
-	}
-
-	// Retrieve token from database
-	token, err := b.GetTmdbToken()
-	if err != nil || token == "" {
-		b.l.Debug("Aborting Tmdb autofill since no token was found, its either empty or was never set")
-		return nil, fmt.Errorf("The Tmdb integration is not configured correctly, contact the site administrator")
-	}
-	// get the movie id
-	match := re_tmdbToken.FindStringSubmatch(sourcelink)
-	var id string
-	if len(match) < 2 {
-		b.l.Debug("Regex match didn't find the movie id in %v", sourcelink)
-		return nil, fmt.Errorf("Could not retrive movie information from the first provided link")
-	}
-
-	id = match[1]
-
-	uploadlimit, err := b.GetMaxUploadlimit()
-
-	if err != nil {
-		b.l.Debug("Error while retriving config value 'MaxUploadLimit':\n %v", err)
-		return nil, fmt.Errorf("Something went wrong :C")
-	}
-
-	sourceAPI := tmdb{id: id, token: token, l: b.l, uploadlimit: uploadlimit}
-
-	// Request data from API
-	results, err := getMovieData(&sourceAPI)
-
-	if err != nil {
-		b.l.Debug("Error while accessing Tmdb API: %v", err)
-		return nil, fmt.Errorf("Could not complete autofill, contact your site administrator\n Error: %s", err.Error())
-	}
-
-	return results, nil
-}
-
 func (b *backend) doFormfill(validatedForm map[string]*InputField, user *models.User, links []*models.Link, file multipart.File, fileHeader *multipart.FileHeader) (int, error) {
 
 	movie := models.Movie{}
@@ -458,17 +405,25 @@ func (b *backend) doFormfill(validatedForm map[string]*InputField, user *models.
 	movie.Name = validatedForm["Title"].Value
 	movie.Description = validatedForm["Description"].Value
 	movie.Remarks = validatedForm["Remarks"].Value
+
+	for _, link := range links {
+		id, err := b.data.AddLink(link)
+		if err != nil {
+			b.l.Debug("[AddMovie] link error: %v", err)
+		}
+		link.Id = id
+	}
 	movie.Links = links
 
 	if file != nil && fileHeader != nil {
-		path, err := b.UploadFile(file, fileHeader, validatedForm["Title"].Value)
+		path, err := b.UploadFile(file, fileHeader)
 		if err != nil {
 			b.l.Debug("Upload failed: %v", err)
 			return -1, err
 		}
 		movie.Poster = path
 	} else {
-		movie.Poster = "posters/unknown.jpg"
+		movie.Poster = defaultPosterPath
 	}
 
 	movie.AddedBy = user
@@ -476,8 +431,11 @@ func (b *backend) doFormfill(validatedForm map[string]*InputField, user *models.
 	return b.AddMovieToDB(&movie)
 }
 
-func (b *backend) UploadFile(file multipart.File, fileHeader *multipart.FileHeader, name string) (string, error) {
+// UploadFile validates and stores an uploaded poster.  The returned path is
+// what goes into Movie.Poster.
+func (b *backend) UploadFile(file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
 	b.l.Debug("[uploadFile] Start")
+	defer file.Close()
 
 	uploadlimit, err := b.GetMaxUploadlimit()
 	if err != nil {
@@ -491,35 +449,61 @@ func (b *backend) UploadFile(file multipart.File, fileHeader *multipart.FileHead
 
 	b.l.Info("Uploaded File: %v - Size %v", fileHeader.Filename, fileHeader.Size)
 
-	defer file.Close()
-
-	tempFile, err := ioutil.TempFile("posters", name+"-*.png")
-
+	path, err := b.savePoster(file, uploadlimit)
 	if err != nil {
-		return "", fmt.Errorf("Error while saving file to disk: %v", err)
+		return "", err
 	}
-	defer tempFile.Close()
 
-	fileBytes, err := ioutil.ReadAll(file)
+	b.l.Debug("[uploadFile] Filename: %v", path)
+	return path, nil
+}
+
+func (b *backend) UpdateMovie(movie *models.Movie) error {
+	return b.data.UpdateMovie(movie)
+}
+
+// AdminUpdateMovie saves changes made to a movie on the admin pages.
+func (b *backend) AdminUpdateMovie(admin *models.User, movie *models.Movie) error {
+	return b.adminUpdateMovie(admin, movie, models.AUDIT_MOVIE_EDIT, "Edited")
+}
 
+// adminUpdateMovie saves a change made by a mod or admin, adding a revision
+// with the given comment and an audit entry with the given action.
+func (b *backend) adminUpdateMovie(admin *models.User, movie *models.Movie, action models.AuditAction, comment string) error {
+	old, err := b.data.GetMovie(movie.Id)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	written, err := tempFile.Write(fileBytes)
-	if err != nil || written != len(fileBytes) {
-		return "", fmt.Errorf("Error while saving file to disk: %v", err)
+	// Remember manual changes so the metadata refresh doesn't undo them.
+	before, after := movieAuditFields(old), movieAuditFields(movie)
+	for _, field := range refreshedFields {
+		if before[field] != after[field] && !movie.FieldEdited(field) {
+			movie.EditedFields = append(movie.EditedFields, field)
+		}
 	}
 
-	b.l.Debug("[uploadFile] Filename: %v", tempFile.Name())
+	err = b.data.UpdateMovie(movie)
+	if err != nil {
+		return err
+	}
 
-	return tempFile.Name(), nil
+	b.addRevision(admin, old, movie, comment)
+	b.Audit(admin, action, movieTarget(movie), before, after)
+	return nil
 }
 
-func (b *backend) UpdateMovie(movie *models.Movie) error {
-	return b.data.UpdateMovie(movie)
-}
+func (b *backend) DeleteMovie(admin *models.User, mid int) error {
+	movie, err := b.data.GetMovie(mid)
+	if err != nil {
+		return err
+	}
+
+	err = b.data.RemoveMovie(mid)
+	if err != nil {
+		return err
+	}
 
-func (b *backend) DeleteMovie(mid int) error {
-	return b.data.RemoveMovie(mid)
+	b.Audit(admin, models.AUDIT_MOVIE_REMOVE, movieTarget(movie), movieAuditFields(movie), nil)
+	return nil
 }
@@ -0,0 +1,66 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+func Test_SearchMovies(t *testing.T) {
+	b := newConfigBackend(t)
+
+	tagId, err := b.data.AddTag(&models.Tag{Name: "Anime", Aliases: []string{"Animation"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := &models.Tag{Id: tagId}
+
+	for _, movie := range []*models.Movie{
+		{Name: "Akira", Description: "Neo-Tokyo is about to explode.", Duration: "2 hr 4 min", Tags: []*models.Tag{tag}},
+		{Name: "Ghost in the Shell", Description: "A cyborg hunts a hacker in Neo-Tokyo.", Duration: "1 hr 23 min", Tags: []*models.Tag{tag}},
+		{Name: "Tokyo Story", Description: "An old couple visits their children.", Duration: "2 hr 16 min"},
+		{Name: "Shell Game", Description: "Nothing to see here.", Removed: true},
+		{Name: "Tokyo Drift", Pending: true},
+	} {
+		if _, err := b.data.AddMovie(movie); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query models.SearchQuery
+		want  []string
+	}{
+		// The name counts for more than the description
+		{"ranked", models.SearchQuery{Text: "tokyo"}, []string{"Tokyo Story", "Akira", "Ghost in the Shell"}},
+		{"all words", models.SearchQuery{Text: "tokyo cyborg"}, []string{"Ghost in the Shell"}},
+		{"prefix", models.SearchQuery{Text: "gho"}, []string{"Ghost in the Shell"}},
+		{"short words are whole", models.SearchQuery{Text: "gh"}, []string{}},
+		{"removed", models.SearchQuery{Text: "shell", Status: models.SEARCH_REMOVED}, []string{"Shell Game"}},
+		{"tag syntax", models.SearchQuery{Text: `tokyo t:"animation"`}, []string{"Akira", "Ghost in the Shell"}},
+		{"tag in the text", models.SearchQuery{Text: "anime"}, []string{"Akira", "Ghost in the Shell"}},
+		{"runtime", models.SearchQuery{Text: "tokyo", MaxRuntime: 125}, []string{"Akira", "Ghost in the Shell"}},
+		{"no text", models.SearchQuery{MinRuntime: 130}, []string{"Tokyo Story"}},
+		{"nothing", models.SearchQuery{Text: "zzz"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movies, err := b.SearchMovies(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, movie := range movies {
+				got = append(got, movie.Name)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: expected %q, got %q", tt.query, tt.want, got)
+			}
+		})
+	}
+}
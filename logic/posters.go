@@ -0,0 +1,377 @@
+package logic
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nfnt/resize"
+	"github.com/zorchenhimer/MoviePolls/models"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	posterDir = "posters"
+
+	// Width of the stored poster and thumbnail.  The height keeps the aspect
+	// ratio.  Smaller images are not scaled up.
+	posterWidth    uint = 360
+	thumbnailWidth uint = 120
+
+	// Files younger than this are never orphans.  A poster is saved before
+	// the movie it belongs to, so a new file may not be referenced yet.
+	orphanGracePeriod = time.Hour
+
+	// Anything larger than this is refused before decoding, the upload limit
+	// alone doesn't stop a small file from decoding to a huge image.
+	maxPosterPixels int = 6000 * 6000
+)
+
+// Formats that are accepted for posters, as named by image.DecodeConfig().
+var posterFormats = []string{"jpeg", "png", "webp"}
+
+// Matches the names given by savePoster().  These never change content so
+// they can be cached forever.
+var re_posterName = regexp.MustCompile(`^[0-9a-f]{32}(-thumb)?\.jpg$`)
+
+// PosterThumbnail returns the path of the thumbnail for a poster path.
+func PosterThumbnail(path string) string {
+	return strings.TrimSuffix(path, ".jpg") + "-thumb.jpg"
+}
+
+// IsHashedPoster returns true if the file name is a content hash given by the
+// poster pipeline.
+func IsHashedPoster(path string) bool {
+	return re_posterName.MatchString(filepath.Base(path))
+}
+
+// savePoster decodes and validates the image in r and stores it at the
+// canonical size along with a thumbnail.  Re-encoding drops any metadata that
+// was in the original.  The returned path is named by the hash of the
+// content, so the same image is only stored once.  limit is the max size of
+// the image in bytes.
+func (b *backend) savePoster(r io.Reader, limit int) (string, error) {
+	raw, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return "", fmt.Errorf("Unable to read image: %v", err)
+	}
+
+	if len(raw) > limit {
+		return "", fmt.Errorf("Poster is too large - Max: %d bytes", limit)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return "", fmt.Errorf("The poster is not a JPEG, PNG or WebP image")
+	}
+
+	supported := false
+	for _, f := range posterFormats {
+		if f == format {
+			supported = true
+		}
+	}
+
+	if !supported {
+		return "", fmt.Errorf("Unsupported poster format %s, use a JPEG, PNG or WebP image", format)
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPosterPixels {
+		return "", fmt.Errorf("The poster dimensions (%dx%d) are not allowed", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return "", fmt.Errorf("Unable to decode the %s poster: %v", format, err)
+	}
+
+	full, err := encodePoster(img, posterWidth)
+	if err != nil {
+		return "", err
+	}
+
+	thumb, err := encodePoster(img, thumbnailWidth)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(full)
+	path := filepath.ToSlash(filepath.Join(posterDir, hex.EncodeToString(hash[:16])+".jpg"))
+
+	// Same content, same name.  Nothing to do if it's already there.
+	if models.FileExists(path) && models.FileExists(PosterThumbnail(path)) {
+		return path, nil
+	}
+
+	if err = writePosterFile(path, full); err != nil {
+		return "", err
+	}
+
+	if err = writePosterFile(PosterThumbnail(path), thumb); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	b.l.Debug("Saved %s poster (%dx%d) as %s", format, config.Width, config.Height, path)
+	return path, nil
+}
+
+func encodePoster(img image.Image, width uint) ([]byte, error) {
+	if uint(img.Bounds().Dx()) > width {
+		img = resize.Resize(width, 0, img, resize.Lanczos3)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("Unable to encode poster: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writePosterFile writes to a temporary file first so a poster that is being
+// served is never half written.
+func writePosterFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(posterDir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("Error while saving file to disk: %v", err)
+	}
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Error while saving file to disk: %v", err)
+	}
+	return nil
+}
+
+// downloadPosterFile fetches an image and runs it through savePoster().
+func (b *backend) downloadPosterFile(url string, limit int) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Unable to download poster: %s", resp.Status)
+	}
+
+	if resp.ContentLength > int64(limit) {
+		return "", fmt.Errorf("Poster is too large - Max: %d, Requested: %d", limit, resp.ContentLength)
+	}
+
+	return b.savePoster(resp.Body, limit)
+}
+
+// PosterFile is a file in the posters directory.
+type PosterFile struct {
+	Path     string
+	Size     int64
+	Modified time.Time
+}
+
+// PosterSweep is the result of looking for posters no movie uses.
+type PosterSweep struct {
+	Time      time.Time
+	Orphans   []*PosterFile
+	TotalSize int64
+	Deleted   bool // The orphans were deleted
+}
+
+func (s PosterSweep) TotalSizeString() string {
+	return formatBytes(s.TotalSize)
+}
+
+func (f PosterFile) SizeString() string {
+	return formatBytes(f.Size)
+}
+
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KiB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
+
+// FindOrphanedPosters lists the files in the posters directory that aren't
+// the poster or thumbnail of any movie, including removed ones.  The default
+// poster is never an orphan.
+func (b *backend) FindOrphanedPosters() (*PosterSweep, error) {
+	movies, err := b.data.GetAllMovies()
+	if err != nil {
+		return nil, err
+	}
+
+	// Older movies have the poster stored without the directory.
+	used := map[string]bool{
+		filepath.Base(defaultPosterPath): true,
+	}
+	// Posters of old revisions are kept so they can be reverted to.
+	posters := []string{}
+	for _, movie := range movies {
+		posters = append(posters, movie.Poster)
+
+		revisions, err := b.data.GetMovieRevisions(movie.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, rev := range revisions {
+			posters = append(posters, rev.Poster)
+		}
+	}
+
+	for _, poster := range posters {
+		if poster == "" {
+			continue
+		}
+		used[filepath.Base(poster)] = true
+		used[filepath.Base(PosterThumbnail(poster))] = true
+	}
+
+	entries, err := ioutil.ReadDir(posterDir)
+	if err != nil {
+		return nil, err
+	}
+
+	sweep := &PosterSweep{
+		Time:    time.Now(),
+		Orphans: []*PosterFile{},
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || used[entry.Name()] || time.Since(entry.ModTime()) < orphanGracePeriod {
+			continue
+		}
+
+		sweep.Orphans = append(sweep.Orphans, &PosterFile{
+			Path:     filepath.ToSlash(filepath.Join(posterDir, entry.Name())),
+			Size:     entry.Size(),
+			Modified: entry.ModTime(),
+		})
+		sweep.TotalSize += entry.Size()
+	}
+
+	sort.Slice(sweep.Orphans, func(i, j int) bool {
+		return sweep.Orphans[i].Path < sweep.Orphans[j].Path
+	})
+
+	return sweep, nil
+}
+
+// DeleteOrphanedPosters deletes the given files, as confirmed by an admin.
+// Files that are no longer orphans, or never were, are skipped.  The
+// returned sweep has the files that were actually deleted.
+func (b *backend) DeleteOrphanedPosters(admin *models.User, paths []string) (*PosterSweep, error) {
+	sweep, err := b.FindOrphanedPosters()
+	if err != nil {
+		return nil, err
+	}
+
+	confirmed := map[string]bool{}
+	for _, p := range paths {
+		confirmed[p] = true
+	}
+
+	deleted := &PosterSweep{
+		Time:    sweep.Time,
+		Orphans: []*PosterFile{},
+		Deleted: true,
+	}
+
+	for _, orphan := range sweep.Orphans {
+		if !confirmed[orphan.Path] {
+			continue
+		}
+
+		if err := os.Remove(orphan.Path); err != nil {
+			b.l.Error("Unable to delete orphaned poster %s: %v", orphan.Path, err)
+			continue
+		}
+
+		deleted.Orphans = append(deleted.Orphans, orphan)
+		deleted.TotalSize += orphan.Size
+	}
+
+	if len(deleted.Orphans) > 0 {
+		b.auditPosterDelete(admin, deleted)
+	}
+
+	return deleted, nil
+}
+
+func (b *backend) auditPosterDelete(actor *models.User, deleted *PosterSweep) {
+	files := map[string]string{}
+	for _, orphan := range deleted.Orphans {
+		files[orphan.Path] = orphan.SizeString()
+	}
+
+	target := fmt.Sprintf("%d posters (%s)", len(deleted.Orphans), deleted.TotalSizeString())
+	b.Audit(actor, models.AUDIT_POSTER_DELETE, target, files, nil)
+}
+
+// GetLastPosterSweep returns the result of the last scheduled sweep, or nil
+// if it hasn't run yet.
+func (b *backend) GetLastPosterSweep() *PosterSweep {
+	b.sweep.lock.Lock()
+	defer b.sweep.lock.Unlock()
+	return b.sweep.last
+}
+
+// sweepPosters is run by the scheduler every PosterSweepInterval hours.
+// Orphans are only reported unless PosterSweepAutoDelete is enabled.
+func (b *backend) sweepPosters(quit chan struct{}) {
+	sweep, err := b.FindOrphanedPosters()
+	if err != nil {
+		b.l.Error("[posters] Unable to look for orphaned posters: %v", err)
+		return
+	}
+
+	b.l.Info("[posters] Found %d orphaned posters (%s)", len(sweep.Orphans), sweep.TotalSizeString())
+
+	autoDelete, err := b.GetPosterSweepAutoDelete()
+	if err != nil {
+		b.l.Error("[posters] Unable to get %s: %v", ConfigPosterSweepAutoDelete, err)
+	}
+
+	if autoDelete && len(sweep.Orphans) > 0 {
+		paths := []string{}
+		for _, orphan := range sweep.Orphans {
+			paths = append(paths, orphan.Path)
+		}
+
+		sweep, err = b.DeleteOrphanedPosters(nil, paths)
+		if err != nil {
+			b.l.Error("[posters] Unable to delete orphaned posters: %v", err)
+			return
+		}
+		b.l.Info("[posters] Deleted %d orphaned posters (%s)", len(sweep.Orphans), sweep.TotalSizeString())
+	}
+
+	b.sweep.lock.Lock()
+	b.sweep.last = sweep
+	b.sweep.lock.Unlock()
+}
@@ -0,0 +1,109 @@
+package logic
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+)
+
+func newPosterBackend(t *testing.T) *backend {
+	log := logger.NewSilent()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err = os.Mkdir(posterDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return &backend{l: log}
+}
+
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, x%height, color.RGBA{R: uint8(x), A: 255})
+	}
+	return img
+}
+
+func Test_SavePoster(t *testing.T) {
+	b := newPosterBackend(t)
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, testImage(720, 1080)); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.Bytes()
+
+	path, err := b.savePoster(bytes.NewReader(raw), len(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(path, "posters/") || !IsHashedPoster(path) {
+		t.Errorf("Unexpected poster path %q", path)
+	}
+
+	for file, width := range map[string]int{path: int(posterWidth), PosterThumbnail(path): int(thumbnailWidth)} {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		config, format, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if format != "jpeg" || config.Width != width || config.Height != width*3/2 {
+			t.Errorf("%s: expected %dx%d jpeg, got %dx%d %s", file, width, width*3/2, config.Width, config.Height, format)
+		}
+	}
+
+	// The same image gets the same name
+	again, err := b.savePoster(bytes.NewReader(raw), len(raw))
+	if err != nil || again != path {
+		t.Errorf("Expected %q for the same image, got %q (%v)", path, again, err)
+	}
+}
+
+func Test_SavePosterInvalid(t *testing.T) {
+	b := newPosterBackend(t)
+
+	if _, err := b.savePoster(strings.NewReader("<html>not an image</html>"), 1000); err == nil {
+		t.Errorf("Expected an error for a non-image")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, testImage(100, 150), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.savePoster(bytes.NewReader(buf.Bytes()), buf.Len()-1); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Expected too large error, got %v", err)
+	}
+
+	// Only the header is read for the dimension check
+	header := &bytes.Buffer{}
+	png.Encode(header, image.NewGray(image.Rect(0, 0, 10000, 10000)))
+	if _, err := b.savePoster(bytes.NewReader(header.Bytes()), header.Len()); err == nil || !strings.Contains(err.Error(), "dimensions") {
+		t.Errorf("Expected dimensions error, got %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package logic
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// RateLimitAction is something clients can only do so often.
+type RateLimitAction string
+
+const (
+	RateLimitLogin  RateLimitAction = "login"
+	RateLimitSignup RateLimitAction = "signup"
+	RateLimitVote   RateLimitAction = "vote"
+	RateLimitAdd    RateLimitAction = "add"
+	RateLimitSearch RateLimitAction = "search"
+)
+
+// The setting with the limit of each action
+var rateLimitSettings = map[RateLimitAction]string{
+	RateLimitLogin:  ConfigRateLimitLogin,
+	RateLimitSignup: ConfigRateLimitSignup,
+	RateLimitVote:   ConfigRateLimitVote,
+	RateLimitAdd:    ConfigRateLimitAdd,
+	RateLimitSearch: ConfigRateLimitSearch,
+}
+
+// Shown as the action of locked user names
+const lockoutAction string = "lockout"
+
+// How often buckets that are full again are forgotten
+const rateLimitPruneInterval = time.Minute
+
+// rateLimit allows Count requests per Per.  A zero Count is no limit.
+type rateLimit struct {
+	Count int
+	Per   time.Duration
+}
+
+// parseRateLimit parses a limit like "10/1m".  An empty value is no limit.
+func parseRateLimit(value string) (rateLimit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return rateLimit{}, nil
+	}
+
+	count, per, found := strings.Cut(value, "/")
+	if !found {
+		return rateLimit{}, fmt.Errorf("Invalid rate limit %q, expected <count>/<duration>", value)
+	}
+
+	limit := rateLimit{}
+	var err error
+	if limit.Count, err = strconv.Atoi(count); err != nil || limit.Count < 0 {
+		return rateLimit{}, fmt.Errorf("Invalid count in rate limit %q", value)
+	}
+	if limit.Per, err = time.ParseDuration(per); err != nil || limit.Per <= 0 {
+		return rateLimit{}, fmt.Errorf("Invalid duration in rate limit %q", value)
+	}
+	return limit, nil
+}
+
+// tokens per second
+func (l rateLimit) rate() float64 {
+	return float64(l.Count) / l.Per.Seconds()
+}
+
+// ThrottledClient is an address, user or user name that's currently refused.
+type ThrottledClient struct {
+	Key     string // for ClearThrottle()
+	Client  string // eg "127.0.0.1" or "user bob"
+	Action  string
+	Refused int // requests refused or failed logins
+	Until   time.Time
+}
+
+// rateLimitClient is one of the buckets a request takes a token from.
+type rateLimitClient struct {
+	key  string
+	name string
+}
+
+type tokenBucket struct {
+	action  RateLimitAction
+	client  string
+	limit   rateLimit
+	tokens  float64
+	updated time.Time
+	refused int
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	tb.tokens = math.Min(float64(tb.limit.Count), tb.tokens+now.Sub(tb.updated).Seconds()*tb.limit.rate())
+	tb.updated = now
+}
+
+// wait returns how long until the bucket has a token again.
+func (tb *tokenBucket) wait() time.Duration {
+	if tb.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) / tb.limit.rate() * float64(time.Second))
+}
+
+type loginFailures struct {
+	name   string
+	count  int
+	last   time.Time
+	locked time.Time // until
+}
+
+// rateLimiter keeps the token buckets and failed logins in memory, so they
+// are reset when the server restarts.
+type rateLimiter struct {
+	lock      sync.Mutex
+	now       func() time.Time
+	buckets   map[string]*tokenBucket
+	failures  map[string]*loginFailures
+	lastPrune time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		now:      time.Now,
+		buckets:  map[string]*tokenBucket{},
+		failures: map[string]*loginFailures{},
+	}
+}
+
+// take takes a token from the bucket of each client.  If one of them is
+// empty nothing is taken and it returns how long to wait.
+func (rl *rateLimiter) take(action RateLimitAction, limit rateLimit, clients []rateLimitClient) time.Duration {
+	if limit.Count == 0 {
+		return 0
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	now := rl.now()
+	rl.prune(now)
+
+	buckets := []*tokenBucket{}
+	var wait time.Duration
+	for _, client := range clients {
+		key := string(action) + " " + client.key
+		bucket, ok := rl.buckets[key]
+		if !ok {
+			bucket = &tokenBucket{action: action, client: client.name, tokens: float64(limit.Count), updated: now}
+			rl.buckets[key] = bucket
+		}
+		bucket.limit = limit
+		bucket.refill(now)
+		buckets = append(buckets, bucket)
+
+		if w := bucket.wait(); w > 0 {
+			bucket.refused++
+			wait = max(wait, w)
+		}
+	}
+
+	if wait > 0 {
+		return wait
+	}
+
+	for _, bucket := range buckets {
+		bucket.tokens--
+		bucket.refused = 0
+	}
+	return 0
+}
+
+// prune forgets buckets that are full again and failed logins that are too
+// old to matter.
+func (rl *rateLimiter) prune(now time.Time) {
+	if now.Sub(rl.lastPrune) < rateLimitPruneInterval {
+		return
+	}
+	rl.lastPrune = now
+
+	for key, bucket := range rl.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= float64(bucket.limit.Count) {
+			delete(rl.buckets, key)
+		}
+	}
+
+	for key, failures := range rl.failures {
+		if now.After(failures.locked) && now.Sub(failures.last) > time.Hour {
+			delete(rl.failures, key)
+		}
+	}
+}
+
+// lockedOut returns how long the user name is still locked.
+func (rl *rateLimiter) lockedOut(name string) time.Duration {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	failures, ok := rl.failures[strings.ToLower(name)]
+	if !ok {
+		return 0
+	}
+	return max(failures.locked.Sub(rl.now()), 0)
+}
+
+// loginFailed counts a failed login and locks the name after attempts
+// failures in a row.  Failures longer than duration ago are forgotten.
+func (rl *rateLimiter) loginFailed(name string, attempts int, duration time.Duration) bool {
+	if attempts <= 0 {
+		return false
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	now := rl.now()
+	key := strings.ToLower(name)
+
+	failures, ok := rl.failures[key]
+	if !ok || now.Sub(failures.last) > duration {
+		failures = &loginFailures{name: name}
+		rl.failures[key] = failures
+	}
+
+	failures.count++
+	failures.last = now
+	if failures.count%attempts != 0 {
+		return false
+	}
+
+	failures.locked = now.Add(duration)
+	return true
+}
+
+func (rl *rateLimiter) loginSucceeded(name string) {
+	rl.lock.Lock()
+	delete(rl.failures, strings.ToLower(name))
+	rl.lock.Unlock()
+}
+
+// throttled returns the clients that are refused right now, the ones that
+// can try again the latest first.
+func (rl *rateLimiter) throttled() []*ThrottledClient {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	now := rl.now()
+	clients := []*ThrottledClient{}
+
+	for key, bucket := range rl.buckets {
+		bucket.refill(now)
+		if wait := bucket.wait(); wait > 0 && bucket.refused > 0 {
+			clients = append(clients, &ThrottledClient{
+				Key:     key,
+				Client:  bucket.client,
+				Action:  string(bucket.action),
+				Refused: bucket.refused,
+				Until:   now.Add(wait),
+			})
+		}
+	}
+
+	for key, failures := range rl.failures {
+		if failures.locked.After(now) {
+			clients = append(clients, &ThrottledClient{
+				Key:     lockoutAction + " " + key,
+				Client:  "user name " + failures.name,
+				Action:  lockoutAction,
+				Refused: failures.count,
+				Until:   failures.locked,
+			})
+		}
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Until.Equal(clients[j].Until) {
+			return clients[i].Key < clients[j].Key
+		}
+		return clients[i].Until.After(clients[j].Until)
+	})
+	return clients
+}
+
+// clear forgets a bucket or a locked user name.
+func (rl *rateLimiter) clear(key string) *ThrottledClient {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if bucket, ok := rl.buckets[key]; ok {
+		delete(rl.buckets, key)
+		return &ThrottledClient{Key: key, Client: bucket.client, Action: string(bucket.action), Refused: bucket.refused}
+	}
+
+	name, found := strings.CutPrefix(key, lockoutAction+" ")
+	if failures, ok := rl.failures[name]; found && ok {
+		delete(rl.failures, name)
+		return &ThrottledClient{Key: key, Client: "user name " + failures.name, Action: lockoutAction, Refused: failures.count}
+	}
+	return nil
+}
+
+// RateLimit takes a token from the buckets of the address and, if there is
+// one, of the user.  It returns how long to wait if the client is over the
+// limit of the action.
+func (b *backend) RateLimit(action RateLimitAction, ip string, user *models.User) time.Duration {
+	setting, ok := rateLimitSettings[action]
+	if !ok {
+		b.l.Error("Unknown rate limit action %q", action)
+		return 0
+	}
+
+	value, err := getConfig[string](b, setting)
+	if err != nil {
+		b.l.Error("Unable to get %s: %v", setting, err)
+		return 0
+	}
+
+	limit, err := parseRateLimit(value)
+	if err != nil {
+		b.l.Error("%s: %v", setting, err)
+		return 0
+	}
+
+	clients := []rateLimitClient{{key: "ip:" + ip, name: ip}}
+	if user != nil {
+		clients = append(clients, rateLimitClient{key: fmt.Sprintf("user:%d", user.Id), name: "user " + user.Name})
+	}
+
+	wait := b.limiter.take(action, limit, clients)
+	if wait > 0 {
+		metricRateLimited.Inc(string(action))
+		b.l.Info("Rate limited %s from %s", action, ip)
+	}
+	return wait
+}
+
+// loginLockout returns the settings of the lockout after failed logins.
+func (b *backend) loginLockout() (int, time.Duration, error) {
+	attempts, err := getConfig[int](b, ConfigLoginLockoutAttempts)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	minutes, err := getConfig[int](b, ConfigLoginLockoutMinutes)
+	if err != nil {
+		return 0, 0, err
+	}
+	return attempts, time.Duration(minutes) * time.Minute, nil
+}
+
+// GetThrottledClients returns the addresses, users and user names that are
+// currently over a rate limit or locked out.
+func (b *backend) GetThrottledClients() []*ThrottledClient {
+	return b.limiter.throttled()
+}
+
+// ClearThrottle lets a throttled client in again.  It returns nil if the
+// client wasn't throttled.
+func (b *backend) ClearThrottle(key string) *ThrottledClient {
+	return b.limiter.clear(key)
+}
+
+func (b *backend) GetTrustForwardedFor() (bool, error) {
+	return getConfig[bool](b, ConfigTrustForwardedFor)
+}
@@ -0,0 +1,188 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+func testRateLimiter() (*rateLimiter, *time.Time) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	rl := newRateLimiter()
+	rl.now = func() time.Time { return now }
+	return rl, &now
+}
+
+func Test_ParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		limit rateLimit
+		valid bool
+	}{
+		{"10/1m", rateLimit{10, time.Minute}, true},
+		{"3/1h", rateLimit{3, time.Hour}, true},
+		{"", rateLimit{}, true},
+		{"0/1s", rateLimit{0, time.Second}, true},
+		{"10", rateLimit{}, false},
+		{"-1/1m", rateLimit{}, false},
+		{"10/0s", rateLimit{}, false},
+		{"10/minute", rateLimit{}, false},
+	}
+
+	for _, test := range tests {
+		limit, err := parseRateLimit(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: unexpected error %v", test.value, err)
+		} else if limit != test.limit {
+			t.Errorf("%q: expected %v, got %v", test.value, test.limit, limit)
+		}
+	}
+}
+
+func Test_RateLimitBucket(t *testing.T) {
+	rl, now := testRateLimiter()
+	limit := rateLimit{Count: 2, Per: time.Minute}
+	ip := []rateLimitClient{{key: "ip:127.0.0.1", name: "127.0.0.1"}}
+
+	for i := 0; i < 2; i++ {
+		if wait := rl.take(RateLimitVote, limit, ip); wait != 0 {
+			t.Fatalf("Request %d refused, wait %s", i+1, wait)
+		}
+	}
+
+	if wait := rl.take(RateLimitVote, limit, ip); wait != 30*time.Second {
+		t.Fatalf("Expected to wait 30s for the third request, got %s", wait)
+	}
+
+	// Other actions and addresses have their own buckets
+	if wait := rl.take(RateLimitAdd, limit, ip); wait != 0 {
+		t.Errorf("Other action refused, wait %s", wait)
+	}
+	if wait := rl.take(RateLimitVote, limit, []rateLimitClient{{key: "ip:::1", name: "::1"}}); wait != 0 {
+		t.Errorf("Other address refused, wait %s", wait)
+	}
+
+	throttled := rl.throttled()
+	if len(throttled) != 1 || throttled[0].Client != "127.0.0.1" || throttled[0].Refused != 1 {
+		t.Fatalf("Expected only 127.0.0.1 to be throttled, got %v", throttled)
+	}
+
+	*now = now.Add(30 * time.Second)
+	if wait := rl.take(RateLimitVote, limit, ip); wait != 0 {
+		t.Errorf("Request refused after the refill, wait %s", wait)
+	}
+	if throttled = rl.throttled(); len(throttled) != 0 {
+		t.Errorf("Expected no throttled clients, got %v", throttled)
+	}
+}
+
+func Test_RateLimitUser(t *testing.T) {
+	rl, _ := testRateLimiter()
+	limit := rateLimit{Count: 1, Per: time.Hour}
+	user := rateLimitClient{key: "user:1", name: "user bob"}
+
+	if wait := rl.take(RateLimitAdd, limit, []rateLimitClient{{key: "ip:10.0.0.1"}, user}); wait != 0 {
+		t.Fatalf("First request refused, wait %s", wait)
+	}
+
+	// Same user from another address
+	if wait := rl.take(RateLimitAdd, limit, []rateLimitClient{{key: "ip:10.0.0.2"}, user}); wait == 0 {
+		t.Fatal("Second request by the same user allowed")
+	}
+
+	// The refused request didn't use up the token of the other address
+	if wait := rl.take(RateLimitAdd, limit, []rateLimitClient{{key: "ip:10.0.0.2"}}); wait != 0 {
+		t.Errorf("Request from the other address refused, wait %s", wait)
+	}
+
+	key := string(RateLimitAdd) + " user:1"
+	if client := rl.clear(key); client == nil || client.Client != "user bob" {
+		t.Fatalf("Unexpected cleared client %v", client)
+	}
+	if client := rl.clear(key); client != nil {
+		t.Errorf("Cleared the same client twice: %v", client)
+	}
+}
+
+func Test_LoginLockout(t *testing.T) {
+	rl, now := testRateLimiter()
+
+	for i := 0; i < 2; i++ {
+		if rl.loginFailed("Bob", 3, time.Minute) {
+			t.Fatalf("Locked after %d failures", i+1)
+		}
+	}
+	if !rl.loginFailed("bob", 3, time.Minute) {
+		t.Fatal("Not locked after 3 failures")
+	}
+
+	if wait := rl.lockedOut("BOB"); wait != time.Minute {
+		t.Errorf("Expected a lockout of 1m, got %s", wait)
+	}
+
+	throttled := rl.throttled()
+	if len(throttled) != 1 || throttled[0].Action != lockoutAction || throttled[0].Refused != 3 {
+		t.Fatalf("Expected the locked name, got %v", throttled)
+	}
+
+	*now = now.Add(time.Minute)
+	if wait := rl.lockedOut("bob"); wait != 0 {
+		t.Errorf("Still locked after the lockout, wait %s", wait)
+	}
+
+	// A successful login resets the count
+	rl.loginFailed("bob", 3, time.Minute)
+	rl.loginFailed("bob", 3, time.Minute)
+	rl.loginSucceeded("bob")
+	if rl.loginFailed("bob", 3, time.Minute) {
+		t.Error("Locked after a successful login")
+	}
+
+	if rl.loginFailed("alice", 0, time.Minute) {
+		t.Error("Locked with the lockout disabled")
+	}
+}
+
+func Test_RateLimitConfig(t *testing.T) {
+	b := newConfigBackend(t)
+	user := &models.User{Id: 1, Name: "bob"}
+
+	if err := b.SetCfgString(ConfigRateLimitVote, "1/1h"); err != nil {
+		t.Fatal(err)
+	}
+
+	if wait := b.RateLimit(RateLimitVote, "127.0.0.1", user); wait != 0 {
+		t.Fatalf("First vote refused, wait %s", wait)
+	}
+	if wait := b.RateLimit(RateLimitVote, "127.0.0.1", user); wait == 0 {
+		t.Fatal("Second vote allowed")
+	}
+
+	if err := b.SetCfgString(ConfigRateLimitVote, ""); err != nil {
+		t.Fatal(err)
+	}
+	if wait := b.RateLimit(RateLimitVote, "127.0.0.1", user); wait != 0 {
+		t.Errorf("Vote refused without a limit, wait %s", wait)
+	}
+}
+
+// Searches have their own limit, so they don't use up the submissions.
+func Test_RateLimitSearch(t *testing.T) {
+	b := newConfigBackend(t)
+	user := &models.User{Id: 1, Name: "bob"}
+
+	if err := b.SetCfgString(ConfigRateLimitSearch, "1/1h"); err != nil {
+		t.Fatal(err)
+	}
+
+	if wait := b.RateLimit(RateLimitSearch, "127.0.0.1", user); wait != 0 {
+		t.Fatalf("First search refused, wait %s", wait)
+	}
+	if wait := b.RateLimit(RateLimitSearch, "127.0.0.1", user); wait == 0 {
+		t.Fatal("Second search allowed")
+	}
+	if wait := b.RateLimit(RateLimitAdd, "127.0.0.1", user); wait != 0 {
+		t.Errorf("Submission refused after searching, wait %s", wait)
+	}
+}
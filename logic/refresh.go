@@ -0,0 +1,120 @@
+package logic
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// Fields filled in by the metadata providers that are kept up to date by the
+// metadata refresh.  The names match the keys of movieAuditFields().
+var refreshedFields = []string{"Description", "Duration", "Rating", "Poster"}
+
+// Pause between movies so the provider APIs don't rate limit the refresh.
+var refreshMovieDelay = 4 * time.Second
+
+// RefreshMovieMetadata looks up the source link of a movie again and updates
+// the fields that changed at the provider, skipping fields a mod or admin has
+// edited.  The changes are written to the audit log and returned.  actor is
+// nil for the scheduled refresh.
+func (b *backend) RefreshMovieMetadata(actor *models.User, mid int) ([]models.AuditChange, error) {
+	movie, err := b.data.GetMovie(mid)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(movie.Links) == 0 {
+		return nil, fmt.Errorf("Movie has no links to refresh from")
+	}
+
+	source := movie.Links[0]
+	for _, link := range movie.Links {
+		if link.IsSource {
+			source = link
+			break
+		}
+	}
+
+	provider, err := b.getMetadataProvider(source.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := provider.Lookup(source)
+	if err != nil {
+		return nil, err
+	}
+
+	before := movieAuditFields(movie)
+	old := *movie
+
+	if result.Description != "" && !movie.FieldEdited("Description") {
+		movie.Description = result.Description
+	}
+
+	if result.Runtime != "" && !movie.FieldEdited("Duration") {
+		movie.Duration = result.Runtime
+	}
+
+	if result.Rating != 0 && !movie.FieldEdited("Rating") {
+		movie.Rating = result.Rating
+	}
+
+	// Only replace the placeholder.  Downloading the same poster again on
+	// every refresh isn't worth it.
+	if filepath.Base(movie.Poster) == filepath.Base(defaultPosterPath) && !movie.FieldEdited("Poster") {
+		movie.Poster = b.downloadPoster(result)
+	}
+
+	changes := auditDiff(before, movieAuditFields(movie))
+	if len(changes) == 0 {
+		return changes, nil
+	}
+
+	err = b.data.UpdateMovie(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	b.addRevision(actor, &old, movie, "Metadata refresh")
+	b.Audit(actor, models.AUDIT_MOVIE_REFRESH, movieTarget(movie), before, movieAuditFields(movie))
+	return changes, nil
+}
+
+// refreshActiveMovies is run by the scheduler every MetadataRefreshInterval
+// hours.
+func (b *backend) refreshActiveMovies(quit chan struct{}) {
+	movies, err := b.data.GetActiveMovies()
+	if err != nil {
+		b.l.Error("[refresh] Unable to get active movies: %v", err)
+		return
+	}
+
+	b.l.Info("[refresh] Refreshing metadata of %d movies", len(movies))
+	updated := 0
+
+	for _, movie := range movies {
+		changes, err := b.RefreshMovieMetadata(nil, movie.Id)
+		if err != nil {
+			b.l.Info("[refresh] Unable to refresh movie %d %q: %v", movie.Id, movie.Name, err)
+		} else if len(changes) > 0 {
+			fields := []string{}
+			for _, c := range changes {
+				fields = append(fields, c.Field)
+			}
+			b.l.Info("[refresh] Updated movie %d %q: %s", movie.Id, movie.Name, strings.Join(fields, ", "))
+			updated++
+		}
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(refreshMovieDelay):
+		}
+	}
+
+	b.l.Info("[refresh] Done, updated %d of %d movies", updated, len(movies))
+}
@@ -0,0 +1,186 @@
+package logic
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// MovieRevisionDiff is a revision of a movie and what it changed compared to
+// the revision before it.
+type MovieRevisionDiff struct {
+	Revision *models.MovieRevision
+	Changes  []*FieldDiff
+
+	// The revision matches the movie as it is now.
+	Current bool
+}
+
+// FieldDiff is a single changed field with a word diff of the values.
+type FieldDiff struct {
+	Field  string
+	Before string
+	After  string
+	Diff   []models.DiffSegment
+}
+
+// addRevision records the state of movie after a change.  Movies that were
+// added or last changed before revisions were recorded get a revision of the
+// old state first, so the first change can be reverted as well.  A failure is
+// logged, but does not undo the change.
+func (b *backend) addRevision(editor *models.User, old, movie *models.Movie, comment string) {
+	revisions, err := b.data.GetMovieRevisions(movie.Id)
+	if err != nil {
+		b.l.Error("Unable to get revisions of movie %d: %v", movie.Id, err)
+		return
+	}
+
+	if len(revisions) == 0 && old != nil {
+		_, err = b.data.AddMovieRevision(models.NewMovieRevision(old, nil, "Earliest known version"))
+		if err != nil {
+			b.l.Error("Unable to add revision of movie %d: %v", movie.Id, err)
+		}
+	}
+
+	_, err = b.data.AddMovieRevision(models.NewMovieRevision(movie, editor, comment))
+	if err != nil {
+		b.l.Error("Unable to add revision of movie %d: %v", movie.Id, err)
+	}
+}
+
+// GetMovieHistory returns the revisions of a movie, newest first, with the
+// changes each one made.
+func (b *backend) GetMovieHistory(mid int) ([]*MovieRevisionDiff, error) {
+	movie, err := b.data.GetMovie(mid)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := b.data.GetMovieRevisions(mid)
+	if err != nil {
+		return nil, err
+	}
+
+	current := models.NewMovieRevision(movie, nil, "").Fields()
+	history := []*MovieRevisionDiff{}
+
+	for i, rev := range revisions {
+		after := rev.Fields()
+
+		// The oldest revision is compared against nothing.
+		before := map[string]string{}
+		if i+1 < len(revisions) {
+			before = revisions[i+1].Fields()
+		}
+
+		history = append(history, &MovieRevisionDiff{
+			Revision: rev,
+			Changes:  diffFields(before, after),
+			Current:  len(diffFields(after, current)) == 0,
+		})
+	}
+
+	return history, nil
+}
+
+func diffFields(before, after map[string]string) []*FieldDiff {
+	fields := []string{}
+	for key := range after {
+		if before[key] != after[key] {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []*FieldDiff{}
+	for _, field := range fields {
+		changes = append(changes, &FieldDiff{
+			Field:  field,
+			Before: before[field],
+			After:  after[field],
+			Diff:   models.DiffWords(before[field], after[field]),
+		})
+	}
+	return changes
+}
+
+// RevertMovie restores the fields of a movie to the given revision.  The
+// revert is saved as a new revision, so it can be undone in the same way.
+func (b *backend) RevertMovie(admin *models.User, mid int, revisionId int) error {
+	revisions, err := b.data.GetMovieRevisions(mid)
+	if err != nil {
+		return err
+	}
+
+	var rev *models.MovieRevision
+	for _, r := range revisions {
+		if r.Id == revisionId {
+			rev = r
+			break
+		}
+	}
+
+	if rev == nil {
+		return fmt.Errorf("Revision %d not found for movie %d", revisionId, mid)
+	}
+
+	movie, err := b.data.GetMovie(mid)
+	if err != nil {
+		return err
+	}
+
+	movie.Name = rev.Name
+	movie.Description = rev.Description
+	movie.Remarks = rev.Remarks
+	movie.Duration = rev.Duration
+	movie.Rating = rev.Rating
+
+	// Posters deleted before revisions kept them around can't be restored.
+	if rev.Poster == defaultPosterPath || models.FileExists(posterPath(rev.Poster)) {
+		movie.Poster = rev.Poster
+	} else if rev.Poster != movie.Poster {
+		b.l.Info("Poster %q of revision %d is gone, keeping %q", rev.Poster, rev.Id, movie.Poster)
+	}
+
+	// Links the movie still has are kept, only the others are stored again.
+	existing := map[string]*models.Link{}
+	for _, link := range movie.Links {
+		existing[strings.ToLower(link.Url)] = link
+	}
+
+	links := []*models.Link{}
+	for i, url := range rev.Links {
+		if link, ok := existing[strings.ToLower(url)]; ok {
+			links = append(links, link)
+			continue
+		}
+
+		link, err := models.NewLink(url, i)
+		if err != nil {
+			b.l.Info("Skipping link %q of revision %d: %v", url, rev.Id, err)
+			continue
+		}
+
+		link.Id, err = b.data.AddLink(link)
+		if err != nil {
+			b.l.Error("Skipping link %q of revision %d, unable to store it: %v", url, rev.Id, err)
+			continue
+		}
+		links = append(links, link)
+	}
+	movie.Links = links
+
+	return b.adminUpdateMovie(admin, movie, models.AUDIT_MOVIE_REVERT, fmt.Sprintf("Reverted to revision %d", rev.Id))
+}
+
+// posterPath converts an old style poster name without the directory to a
+// path.
+func posterPath(poster string) string {
+	if filepath.Dir(poster) == "." {
+		return filepath.Join(posterDir, poster)
+	}
+	return poster
+}
@@ -0,0 +1,96 @@
+package logic
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/database"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// linkCountingDatabase counts the stored links and fails to store one URL.
+type linkCountingDatabase struct {
+	database.Database
+	failUrl string
+	added   []string
+}
+
+func (db *linkCountingDatabase) AddLink(link *models.Link) (int, error) {
+	if link.Url == db.failUrl {
+		return 0, errors.New("disk full")
+	}
+	db.added = append(db.added, link.Url)
+	return db.Database.AddLink(link)
+}
+
+func Test_RevertMovieLinks(t *testing.T) {
+	b := newConfigBackend(t)
+	admin := &models.User{Id: 1, Name: "admin"}
+
+	kept, err := models.NewLink("https://www.imdb.com/title/tt0094625/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept.Id, err = b.data.AddLink(kept); err != nil {
+		t.Fatal(err)
+	}
+
+	mid, err := b.data.AddMovie(&models.Movie{Name: "Akira", Links: []*models.Link{kept}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revId, err := b.data.AddMovieRevision(&models.MovieRevision{
+		MovieId: mid,
+		Name:    "AKIRA",
+		Poster:  defaultPosterPath,
+		Links: []string{
+			"https://www.imdb.com/title/tt0094625/",
+			"https://myanimelist.net/anime/47",
+			"https://anilist.co/anime/47",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &linkCountingDatabase{Database: b.data, failUrl: "https://anilist.co/anime/47"}
+	b.data = db
+
+	if err = b.RevertMovie(admin, mid, revId); err != nil {
+		t.Fatal(err)
+	}
+
+	// The link the movie still has is reused, and the one that can't be
+	// stored is left out.
+	if !reflect.DeepEqual(db.added, []string{"https://myanimelist.net/anime/47"}) {
+		t.Errorf("Unexpected links stored: %q", db.added)
+	}
+
+	movie, err := b.data.GetMovie(mid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if movie.Name != "AKIRA" {
+		t.Errorf("Expected the name to be reverted, got %q", movie.Name)
+	}
+
+	urls := []string{}
+	for _, link := range movie.Links {
+		if link.Id == 0 {
+			t.Errorf("Link %q has no ID", link.Url)
+		}
+		urls = append(urls, link.Url)
+	}
+
+	expected := []string{"https://www.imdb.com/title/tt0094625/", "https://myanimelist.net/anime/47"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Expected links %q, got %q", expected, urls)
+	}
+
+	if movie.Links[0].Id != kept.Id {
+		t.Errorf("Expected the link ID %d to be kept, got %d", kept.Id, movie.Links[0].Id)
+	}
+}
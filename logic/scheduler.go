@@ -0,0 +1,56 @@
+package logic
+
+import (
+	"time"
+)
+
+// How often the scheduled jobs check if they are due.
+var scheduleCheckDelay = time.Minute
+
+// scheduledJob runs every interval hours.  The interval is read from the
+// config on every check so it can be changed without a restart.  An interval
+// of zero disables the job.
+type scheduledJob struct {
+	name     string
+	interval func() (int, error)
+	run      func(quit chan struct{})
+}
+
+// RunScheduledJobs runs the background jobs until quit is closed.
+func (b *backend) RunScheduledJobs(quit chan struct{}) {
+	jobs := []scheduledJob{
+		{name: "refresh", interval: b.GetMetadataRefreshInterval, run: b.refreshActiveMovies},
+		{name: "posters", interval: b.GetPosterSweepInterval, run: b.sweepPosters},
+	}
+
+	for _, job := range jobs {
+		go b.runScheduled(job, quit)
+	}
+
+	<-quit
+}
+
+func (b *backend) runScheduled(job scheduledJob, quit chan struct{}) {
+	last := time.Now()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-time.After(scheduleCheckDelay):
+		}
+
+		interval, err := job.interval()
+		if err != nil {
+			b.l.Error("[%s] Unable to get interval: %v", job.name, err)
+			continue
+		}
+
+		if interval <= 0 || time.Since(last) < time.Duration(interval)*time.Hour {
+			continue
+		}
+		last = time.Now()
+
+		job.run(quit)
+	}
+}
@@ -0,0 +1,164 @@
+package logic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/database"
+)
+
+// Secret keys are 32 bytes for AES-256, base64 encoded when written down.
+const SecretKeySize int = 32
+
+// GenerateSecretKey returns a new random secret key, base64 encoded.
+func GenerateSecretKey() (string, error) {
+	key := make([]byte, SecretKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseSecretKey decodes a base64 encoded secret key.
+func ParseSecretKey(str string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(str))
+	if err != nil {
+		return nil, fmt.Errorf("Secret key is not valid base64: %v", err)
+	}
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("Secret key must be %d bytes, not %d", SecretKeySize, len(key))
+	}
+	return key, nil
+}
+
+// ReadSecretKeyFile reads a base64 encoded secret key from a file.
+func ReadSecretKeyFile(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read secret key file: %v", err)
+	}
+	return ParseSecretKey(string(raw))
+}
+
+// secretBox encrypts secrets with AES-256-GCM.  Sealed values look like
+// "enc:<key id>:<base64 nonce and ciphertext>".  The key ID is the start of
+// the SHA-256 of the key, so a value sealed with another key gives a useful
+// error instead of a failed decryption.
+type secretBox struct {
+	aead cipher.AEAD
+	id   string
+}
+
+func newSecretBox(key []byte) (*secretBox, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(key)
+	return &secretBox{aead: aead, id: hex.EncodeToString(sum[:4])}, nil
+}
+
+func (s *secretBox) Seal(plain string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, []byte(plain), []byte(s.id))
+	return database.SealedPrefix + s.id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *secretBox) Open(val string) (string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(val, database.SealedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errors.New("Malformed encrypted value")
+	}
+
+	if parts[0] != s.id {
+		return "", fmt.Errorf("The value was encrypted with a different secret key (%s, not %s)", parts[0], s.id)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", errors.New("Malformed encrypted value")
+	}
+
+	nonce, sealed := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, sealed, []byte(s.id))
+	if err != nil {
+		return "", fmt.Errorf("Unable to decrypt value: %v", err)
+	}
+	return string(plain), nil
+}
+
+// secretConfigKeys returns the settings that are stored encrypted.
+func (b *backend) secretConfigKeys() []string {
+	keys := []string{}
+	for _, setting := range b.config.ordered {
+		if setting.Type == ConfigStringPriv {
+			keys = append(keys, setting.Key)
+		}
+	}
+	return keys
+}
+
+// setupSecrets has the database encrypt the private settings and auth
+// tokens if a secret key was given, and encrypts the ones that are still in
+// plain text.
+func (b *backend) setupSecrets(key []byte) error {
+	var box database.SecretBox
+	if key != nil {
+		sb, err := newSecretBox(key)
+		if err != nil {
+			return fmt.Errorf("Invalid secret key: %v", err)
+		}
+		box = sb
+	}
+
+	keys := b.secretConfigKeys()
+	count, err := b.data.SetSecretBox(box, keys)
+	if err != nil {
+		return err
+	}
+
+	if box == nil {
+		b.l.Info("No secret key given, OAuth secrets and tokens are stored in plain text")
+	} else if count > 0 {
+		b.l.Info("Encrypted %d secrets that were stored in plain text", count)
+	}
+
+	// Catch a wrong or missing key at startup instead of at the first login
+	for _, key := range keys {
+		_, err := b.data.GetCfgString(key, "")
+		if err != nil && !errors.Is(err, database.ErrNoValue) {
+			b.l.Error("Unable to read %s: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// RotateSecretKey encrypts every secret with a new key.  The new key has to
+// be used from the next start on.
+func (b *backend) RotateSecretKey(newKey []byte) (int, error) {
+	box, err := newSecretBox(newKey)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid secret key: %v", err)
+	}
+	return b.data.RotateSecretBox(box)
+}
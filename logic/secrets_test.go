@@ -0,0 +1,75 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/database"
+)
+
+func testSecretBox(t *testing.T) *secretBox {
+	str, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParseSecretKey(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box, err := newSecretBox(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func Test_SecretBox(t *testing.T) {
+	box := testSecretBox(t)
+
+	sealed, err := box.Seal("client secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !database.IsSealed(sealed) || strings.Contains(sealed, "client secret") {
+		t.Errorf("Expected an encrypted value, got %q", sealed)
+	}
+
+	again, _ := box.Seal("client secret")
+	if again == sealed {
+		t.Errorf("Expected a new nonce for every value")
+	}
+
+	plain, err := box.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain != "client secret" {
+		t.Errorf("Expected %q, got %q", "client secret", plain)
+	}
+
+	if _, err := testSecretBox(t).Open(sealed); err == nil {
+		t.Errorf("Expected an error opening a value sealed with another key")
+	}
+
+	// Flip a character of the ciphertext
+	mid := len(sealed) - 10
+	flipped := byte('A')
+	if sealed[mid] == 'A' {
+		flipped = 'B'
+	}
+	tampered := sealed[:mid] + string(flipped) + sealed[mid+1:]
+	if _, err := box.Open(tampered); err == nil {
+		t.Errorf("Expected an error opening a tampered value")
+	}
+}
+
+func Test_ParseSecretKey(t *testing.T) {
+	for _, bad := range []string{"", "not base64!", "c2hvcnQ="} {
+		if _, err := ParseSecretKey(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
@@ -81,7 +81,13 @@ func NewAdminAuth() (*models.UrlKey, error) {
 	}, nil
 }
 
-func (b *backend) NewPasswordResetKey(userId int) (*models.UrlKey, error) {
+// NewPasswordResetKey creates a link for admin to give to user to set a new
+// password.  Only admins can reset the password of moderators and admins.
+func (b *backend) NewPasswordResetKey(admin *models.User, user *models.User) (*models.UrlKey, error) {
+	if err := checkCanManageUser(admin, user); err != nil {
+		return nil, err
+	}
+
 	url, err := generatePass()
 	if err != nil {
 		return nil, fmt.Errorf("Error generating UrlKey token URL: %v", err)
@@ -96,7 +102,7 @@ func (b *backend) NewPasswordResetKey(userId int) (*models.UrlKey, error) {
 		Url:    url,
 		Key:    key,
 		Type:   models.UKT_PasswordReset,
-		UserId: userId,
+		UserId: user.Id,
 	}, nil
 }
 
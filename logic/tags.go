@@ -0,0 +1,223 @@
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// TagCount is a tag and the number of movies that have it.
+type TagCount struct {
+	Tag    *models.Tag
+	Movies int
+}
+
+// cleanTagName trims a tag and collapses runs of whitespace.
+func cleanTagName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// cleanTagNames splits comma separated genre strings from the metadata
+// providers into single tags and drops empty and duplicate names.
+func cleanTagNames(names []string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+
+	for _, name := range names {
+		for _, tag := range strings.Split(name, ",") {
+			tag = cleanTagName(tag)
+			if tag == "" || seen[strings.ToLower(tag)] {
+				continue
+			}
+			seen[strings.ToLower(tag)] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// GetTagCounts returns all tags sorted by name.  With activeOnly set, only
+// movies in the current cycle are counted and unused tags are left out.
+func (b *backend) GetTagCounts(activeOnly bool) ([]*TagCount, error) {
+	tags, err := b.data.GetTags()
+	if err != nil {
+		return nil, err
+	}
+
+	var movies []*models.Movie
+	if activeOnly {
+		movies, err = b.data.GetActiveMovies()
+	} else {
+		movies, err = b.data.GetAllMovies()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[int]int{}
+	for _, movie := range movies {
+		if movie.Removed {
+			continue
+		}
+		for _, tag := range movie.Tags {
+			counts[tag.Id]++
+		}
+	}
+
+	list := []*TagCount{}
+	for _, tag := range tags {
+		if activeOnly && counts[tag.Id] == 0 {
+			continue
+		}
+		list = append(list, &TagCount{Tag: tag, Movies: counts[tag.Id]})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return strings.ToLower(list[i].Tag.Name) < strings.ToLower(list[j].Tag.Name)
+	})
+
+	return list, nil
+}
+
+// GetMoviesByTags returns the active movies that have all of the given tags,
+// or one of their aliases.
+func (b *backend) GetMoviesByTags(tags []string) ([]*models.Movie, error) {
+	movies, err := b.data.GetActiveMovies()
+	if err != nil {
+		return nil, err
+	}
+
+	return models.FilterMoviesByTags(movies, tags)
+}
+
+func (b *backend) getTag(id int) (*models.Tag, error) {
+	tag := b.data.GetTag(id)
+	if tag == nil {
+		return nil, fmt.Errorf("Tag with ID %d not found", id)
+	}
+
+	t := *tag
+	t.Aliases = append([]string{}, tag.Aliases...)
+	return &t, nil
+}
+
+func (b *backend) RenameTag(admin *models.User, id int, name string) error {
+	tag, err := b.getTag(id)
+	if err != nil {
+		return err
+	}
+
+	name = cleanTagName(name)
+	if name == "" {
+		return fmt.Errorf("A name is required")
+	}
+
+	before := tagAuditFields(tag)
+
+	// Keep the old name around so searches for it still work.
+	if !strings.EqualFold(tag.Name, name) {
+		tag.Aliases = append(tag.Aliases, tag.Name)
+	}
+
+	aliases := []string{}
+	for _, alias := range tag.Aliases {
+		if !strings.EqualFold(alias, name) {
+			aliases = append(aliases, alias)
+		}
+	}
+	tag.Aliases = aliases
+	tag.Name = name
+
+	err = b.data.UpdateTag(tag)
+	if err != nil {
+		return err
+	}
+
+	b.Audit(admin, models.AUDIT_TAG_RENAME, tagTarget(tag), before, tagAuditFields(tag))
+	return nil
+}
+
+// MergeTags moves every movie from one tag to another and deletes the first.
+func (b *backend) MergeTags(admin *models.User, fromId, intoId int) error {
+	from, err := b.getTag(fromId)
+	if err != nil {
+		return err
+	}
+
+	into, err := b.getTag(intoId)
+	if err != nil {
+		return err
+	}
+
+	err = b.data.MergeTags(fromId, intoId)
+	if err != nil {
+		return err
+	}
+
+	merged, err := b.getTag(intoId)
+	if err != nil {
+		return err
+	}
+
+	b.Audit(admin, models.AUDIT_TAG_MERGE, fmt.Sprintf("%s into %s", tagTarget(from), tagTarget(into)),
+		tagAuditFields(into), tagAuditFields(merged))
+	return nil
+}
+
+func (b *backend) AddTagAlias(admin *models.User, id int, alias string) error {
+	tag, err := b.getTag(id)
+	if err != nil {
+		return err
+	}
+
+	alias = cleanTagName(alias)
+	if alias == "" {
+		return fmt.Errorf("An alias is required")
+	}
+
+	if tag.Matches(alias) {
+		return fmt.Errorf("%q is already a name of %q", alias, tag.Name)
+	}
+
+	before := tagAuditFields(tag)
+	tag.Aliases = append(tag.Aliases, alias)
+
+	err = b.data.UpdateTag(tag)
+	if err != nil {
+		return err
+	}
+
+	b.Audit(admin, models.AUDIT_TAG_ALIAS, tagTarget(tag), before, tagAuditFields(tag))
+	return nil
+}
+
+func (b *backend) RemoveTagAlias(admin *models.User, id int, alias string) error {
+	tag, err := b.getTag(id)
+	if err != nil {
+		return err
+	}
+
+	before := tagAuditFields(tag)
+
+	aliases := []string{}
+	for _, a := range tag.Aliases {
+		if a != alias {
+			aliases = append(aliases, a)
+		}
+	}
+
+	if len(aliases) == len(tag.Aliases) {
+		return fmt.Errorf("%q is not an alias of %q", alias, tag.Name)
+	}
+	tag.Aliases = aliases
+
+	err = b.data.UpdateTag(tag)
+	if err != nil {
+		return err
+	}
+
+	b.Audit(admin, models.AUDIT_TAG_ALIAS, tagTarget(tag), before, tagAuditFields(tag))
+	return nil
+}
@@ -0,0 +1,21 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_CleanTagNames(t *testing.T) {
+	tags := cleanTagNames([]string{
+		"Action, Adventure",
+		" Science  Fiction",
+		"action",
+		"",
+		"Drama,,",
+	})
+
+	expected := []string{"Action", "Adventure", "Science Fiction", "Drama"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Expected %q, got %q", expected, tags)
+	}
+}
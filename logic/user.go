@@ -2,6 +2,7 @@ package logic
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/zorchenhimer/MoviePolls/models"
 )
@@ -101,3 +102,155 @@ func (b *backend) GetUserMovies(userId int) ([]*models.Movie, error) {
 func (b *backend) UpdateAuthMethod(auth *models.AuthMethod) error {
 	return b.data.UpdateAuthMethod(auth)
 }
+
+// UserDataExport is everything stored about a user, for the "download my
+// data" link on the account page.  Passwords and OAuth tokens are left out.
+type UserDataExport struct {
+	Exported time.Time
+
+	Id                  int
+	Name                string
+	Email               string
+	Role                string
+	NotifyCycleEnd      bool
+	NotifyVoteSelection bool
+
+	AuthMethods []UserDataAuthMethod
+	Votes       []UserDataMovie
+	Movies      []UserDataMovie
+}
+
+type UserDataAuthMethod struct {
+	Type  models.AuthType
+	Added time.Time
+}
+
+type UserDataMovie struct {
+	Id           int
+	Name         string
+	Links        []string `json:",omitempty"`
+	Description  string   `json:",omitempty"`
+	Remarks      string   `json:",omitempty"`
+	CycleAdded   int      `json:",omitempty"`
+	CycleWatched int      `json:",omitempty"`
+	Removed      bool
+	Pending      bool
+	RejectReason string `json:",omitempty"`
+}
+
+func userDataMovie(movie *models.Movie, details bool) UserDataMovie {
+	m := UserDataMovie{
+		Id:           movie.Id,
+		Name:         movie.Name,
+		Removed:      movie.Removed,
+		Pending:      movie.Pending,
+		RejectReason: movie.RejectReason,
+	}
+
+	if movie.CycleAdded != nil {
+		m.CycleAdded = movie.CycleAdded.Id
+	}
+
+	if movie.CycleWatched != nil {
+		m.CycleWatched = movie.CycleWatched.Id
+	}
+
+	if details {
+		m.Description = movie.Description
+		m.Remarks = movie.Remarks
+		m.Links = []string{}
+		for _, link := range movie.Links {
+			m.Links = append(m.Links, link.Url)
+		}
+	}
+
+	return m
+}
+
+// ExportUserData collects the user's profile, login methods, votes from all
+// cycles and the movies they submitted.
+func (b *backend) ExportUserData(user *models.User) (*UserDataExport, error) {
+	export := &UserDataExport{
+		Exported: time.Now(),
+
+		Id:                  user.Id,
+		Name:                user.Name,
+		Email:               user.Email,
+		Role:                user.Privilege.String(),
+		NotifyCycleEnd:      user.NotifyCycleEnd,
+		NotifyVoteSelection: user.NotifyVoteSelection,
+
+		AuthMethods: []UserDataAuthMethod{},
+		Votes:       []UserDataMovie{},
+		Movies:      []UserDataMovie{},
+	}
+
+	for _, auth := range user.AuthMethods {
+		export.AuthMethods = append(export.AuthMethods, UserDataAuthMethod{
+			Type:  auth.Type,
+			Added: auth.Date,
+		})
+	}
+
+	voted, err := b.data.GetUserVotes(user.Id)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get votes for user %d: %v", user.Id, err)
+	}
+
+	for _, movie := range voted {
+		export.Votes = append(export.Votes, userDataMovie(movie, false))
+	}
+
+	added, err := b.data.GetUserMovies(user.Id)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get movies added by user %d: %v", user.Id, err)
+	}
+
+	for _, movie := range models.SortMoviesByName(added) {
+		export.Movies = append(export.Movies, userDataMovie(movie, true))
+	}
+
+	return export, nil
+}
+
+// DeleteOwnAccount is the self-service version of AdminDeleteUser() and
+// AdminPurgeUser().  With purge set the account and its votes are removed
+// entirely, otherwise the account is anonymized and the votes are kept.
+func (b *backend) DeleteOwnAccount(user *models.User, purge bool) error {
+	if user.IsAdmin() {
+		admins := 0
+		start := 0
+		for {
+			users, err := b.data.GetUsers(start, 20)
+			if err != nil {
+				return fmt.Errorf("Error looking for admins: %v", err)
+			}
+
+			if len(users) == 0 {
+				break
+			}
+
+			// start is an ID, not an offset
+			for _, u := range users {
+				if u.IsAdmin() {
+					admins++
+				}
+				if u.Id >= start {
+					start = u.Id + 1
+				}
+			}
+		}
+
+		if admins < 2 {
+			return fmt.Errorf("You are the only admin and cannot delete your account")
+		}
+	}
+
+	// Keep the name for the audit log; deleting changes it.
+	actor := *user
+
+	if purge {
+		return b.AdminPurgeUser(&actor, user)
+	}
+	return b.AdminDeleteUser(&actor, user)
+}
@@ -2,17 +2,65 @@ package logic
 
 import (
 	"errors"
-	"fmt"
 
-	"github.com/zorchenhimer/MoviePolls/database"
 	"github.com/zorchenhimer/MoviePolls/models"
 )
 
+var (
+	ErrVotingDisabled = errors.New("Voting is not enabled")
+	ErrAlreadyVoted   = errors.New("You already voted for that movie")
+	ErrNoVotesLeft    = errors.New("You don't have any more available votes")
+)
+
+// AddVote casts a vote for the given movie.  All the voting limits are
+// enforced here so every frontend (web, chat bot) plays by the same rules.
 func (b *backend) AddVote(userid int, movieid int) error {
-	return b.data.AddVote(userid, movieid)
+	enabled, err := b.GetVotingEnabled()
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		return ErrVotingDisabled
+	}
+
+	voted, err := b.data.UserVotedForMovie(userid, movieid)
+	if err != nil {
+		return err
+	}
+
+	if voted {
+		return ErrAlreadyVoted
+	}
+
+	user, err := b.data.GetUser(userid)
+	if err != nil {
+		return err
+	}
+
+	available, err := b.GetAvailableVotes(user)
+	if err != nil {
+		return err
+	}
+
+	if available <= 0 {
+		b.l.Debug("User %d has no votes left for movie %d", userid, movieid)
+		return ErrNoVotesLeft
+	}
+
+	if err = b.data.AddVote(userid, movieid); err != nil {
+		return err
+	}
+
+	b.l.Debug("User %d voted for movie %d (%d votes left)", userid, movieid, available-1)
+	metricVotesCast.Inc()
+	return nil
 }
 
+// DeleteVote removes a vote.  Unlike AddVote it's allowed while voting is
+// disabled, so users can always take their votes back.
 func (b *backend) DeleteVote(userid int, movieid int) error {
+	b.l.Debug("User %d removed their vote for movie %d", userid, movieid)
 	return b.data.DeleteVote(userid, movieid)
 }
 
@@ -21,57 +69,15 @@ func (b *backend) UserVotedForMovie(userid int, movieid int) (bool, error) {
 }
 
 func (b *backend) GetMaxUserVotes() (int, error) {
-	key := ConfigMaxUserVotes
-	config, ok := ConfigValues[key]
-	if !ok {
-		return 0, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgInt(key, config.Default.(int))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgInt(key, config.Default.(int))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[int](b, ConfigMaxUserVotes)
 }
 
 func (b *backend) GetVotingEnabled() (bool, error) {
-	key := ConfigVotingEnabled
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[bool](b, ConfigVotingEnabled)
 }
 
 func (b *backend) GetUnlimitedVotes() (bool, error) {
-	key := ConfigUnlimitedVotes
-	config, ok := ConfigValues[key]
-	if !ok {
-		return false, fmt.Errorf("Could not find ConfigValue named %s", key)
-	}
-	val, err := b.data.GetCfgBool(key, config.Default.(bool))
-	if errors.Is(err, database.ErrNoValue) {
-		err = b.data.SetCfgBool(key, config.Default.(bool))
-		if err != nil {
-			b.l.Error("Unable to set default value for %s: %v", key, err)
-		}
-		return val, nil
-	}
-
-	return val, err
+	return getConfig[bool](b, ConfigUnlimitedVotes)
 }
 
 func (b *backend) GetAvailableVotes(user *models.User) (int, error) {
@@ -92,11 +98,19 @@ func (b *backend) GetAvailableVotes(user *models.User) (int, error) {
 		return 0, err
 	}
 
-	active, _, err := b.GetUserVotes(user)
+	voted, _, err := b.GetUserVotes(user)
 	if err != nil {
 		return 0, err
 	}
-	return maxVotes - len(active), nil
+
+	// Only votes on active movies count
+	count := 0
+	for _, movie := range voted {
+		if movie.CycleWatched == nil && !movie.Removed {
+			count++
+		}
+	}
+	return maxVotes - count, nil
 }
 
 func (b *backend) EnableVoting() error {
@@ -0,0 +1,75 @@
+package logic
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+func Test_AvailableVotes(t *testing.T) {
+	b := newConfigBackend(t)
+
+	if _, err := b.data.AddCycle(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	userId, err := b.data.AddUser(&models.User{Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := b.data.GetUser(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movies := []int{}
+	for _, name := range []string{"First", "Second", "Third"} {
+		id, err := b.data.AddMovie(&models.Movie{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		movies = append(movies, id)
+	}
+
+	for key, value := range map[string]string{ConfigMaxUserVotes: "2", ConfigVotingEnabled: "true"} {
+		if err := b.SetConfigValue(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range movies[:2] {
+		if err := b.AddVote(userId, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.AddVote(userId, movies[2]); !errors.Is(err, ErrNoVotesLeft) {
+		t.Fatalf("Expected ErrNoVotesLeft, got %v", err)
+	}
+
+	// Votes on removed movies are given back
+	removed, err := b.data.GetMovie(movies[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed.Removed = true
+	if err := b.data.UpdateMovie(removed); err != nil {
+		t.Fatal(err)
+	}
+
+	if available, err := b.GetAvailableVotes(user); err != nil || available != 1 {
+		t.Fatalf("Expected 1 available vote, got %d (%v)", available, err)
+	}
+
+	// Votes can be taken back while voting is disabled
+	if err := b.SetConfigValue(ConfigVotingEnabled, "false"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DeleteVote(userId, movies[1]); err != nil {
+		t.Fatalf("Unable to remove a vote with voting disabled: %v", err)
+	}
+	if err := b.AddVote(userId, movies[2]); !errors.Is(err, ErrVotingDisabled) {
+		t.Errorf("Expected ErrVotingDisabled, got %v", err)
+	}
+}
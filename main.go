@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/zorchenhimer/MoviePolls/chatbot"
 	"github.com/zorchenhimer/MoviePolls/database"
 	"github.com/zorchenhimer/MoviePolls/logger"
 	"github.com/zorchenhimer/MoviePolls/logic"
@@ -17,26 +19,74 @@ var ReleaseVersion string
 func main() {
 	var logFile string
 	var logLevel string
+	var logFormat string
+	var logMaxSize int
+	var logMaxAge time.Duration
+	var logBackups int
+	var logCompress bool
+	var configFile string
+	var rotateKeyFile string
 	var addr string
+	var readTimeout time.Duration
+	var writeTimeout time.Duration
+	var idleTimeout time.Duration
+	var maxBodySize int64
 	var debug bool
 	var version bool
+	var genKey bool
 
 	flag.StringVar(&addr, "addr", ":8090", "Server address")
+	flag.DurationVar(&readTimeout, "readtimeout", 30*time.Second, "Time allowed to read a request")
+	flag.DurationVar(&writeTimeout, "writetimeout", 60*time.Second, "Time allowed to write a response")
+	flag.DurationVar(&idleTimeout, "idletimeout", 120*time.Second, "Time to keep idle connections open")
+	flag.Int64Var(&maxBodySize, "maxbody", 1<<20, "Largest request body in bytes, not counting uploaded posters")
 	flag.StringVar(&logFile, "logfile", "logs/server.log", "File to write logs")
 	flag.StringVar(&logLevel, "loglevel", "debug", "Log verbosity")
+	flag.StringVar(&logFormat, "logformat", "text", "Log format, text or json")
+	flag.IntVar(&logMaxSize, "logmaxsize", 10, "Rotate the log file after this many megabytes, 0 for no limit")
+	flag.DurationVar(&logMaxAge, "logmaxage", 0, "Rotate the log file after this long, eg 24h, 0 for no limit")
+	flag.IntVar(&logBackups, "logbackups", 5, "Number of rotated log files to keep, 0 to keep all of them")
+	flag.BoolVar(&logCompress, "logcompress", true, "Compress rotated log files")
+	flag.StringVar(&configFile, "config", os.Getenv("MOVIEPOLLS_CONFIG"), "Config file (.toml or .yaml) with settings to seed or lock")
 	flag.BoolVar(&debug, "debug", false, "Enable debug code")
 	flag.BoolVar(&version, "version", true, "Show the version of the binary file")
+	flag.BoolVar(&genKey, "genkey", false, "Print a new secret key for MOVIEPOLLS_SECRET_KEY and exit")
+	flag.StringVar(&rotateKeyFile, "rotatekey", "", "Encrypt all secrets with the key in this file and exit")
 	flag.Parse()
 
-	log, err := logger.NewLogger(logger.LogLevel(logLevel), logFile)
+	if genKey {
+		key, err := logic.GenerateSecretKey()
+		if err != nil {
+			fmt.Printf("Unable to generate key: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	log, err := logger.New(logger.Options{
+		Level:  logger.LogLevel(logLevel),
+		Format: logger.LogFormat(logFormat),
+		File:   logFile,
+		Rotation: logger.Rotation{
+			MaxSize:    int64(logMaxSize) * 1024 * 1024,
+			MaxAge:     logMaxAge,
+			MaxBackups: logBackups,
+			Compress:   logCompress,
+		},
+	})
 	if err != nil {
 		fmt.Printf("Unable to load logger: %v\n", err)
 		os.Exit(1)
 	}
 
 	config := web.Options{
-		Debug:  debug,
-		Listen: addr,
+		Debug:        debug,
+		Listen:       addr,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+		IdleTimeout:  idleTimeout,
+		MaxBodySize:  maxBodySize,
 	}
 
 	if version {
@@ -47,21 +97,55 @@ func main() {
 	}
 
 	// init database
-	data, err := database.GetDatabase("json", "db/data.json", log)
+	data, err := database.GetDatabase("json", "db/data.json", log.Package("database"))
 	if err != nil {
 		fmt.Printf("Unable to load json data: %v\n", err)
 		os.Exit(1)
 	}
 
+	// settings from the config file and MOVIEPOLLS_* environment variables
+	boot, err := logic.LoadBootstrapConfig(configFile, os.Environ())
+	if err != nil {
+		fmt.Printf("Unable to load config: %v\n", err)
+		os.Exit(1)
+	}
+
 	// init logic
-	backend, err := logic.New(data, log)
+	backend, err := logic.New(data, log.Package("logic"), boot)
 	if err != nil {
 		fmt.Printf("Unable to load backend: %v\n", err)
 		os.Exit(1)
 	}
 
+	if rotateKeyFile != "" {
+		newKey, err := logic.ReadSecretKeyFile(rotateKeyFile)
+		if err != nil {
+			fmt.Printf("Unable to load new key: %v\n", err)
+			os.Exit(1)
+		}
+
+		count, err := backend.RotateSecretKey(newKey)
+		if err != nil {
+			fmt.Printf("Unable to rotate key: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Encrypted %d secrets with the new key.  Use it from now on.\n", count)
+		return
+	}
+
+	// init chat bot.  It stays idle until it's enabled in the config.
+	bot := chatbot.New(backend, log.Package("chatbot"))
+	go bot.Run()
+	defer bot.Close()
+
+	// background jobs like the metadata refresh
+	jobsQuit := make(chan struct{})
+	go backend.RunScheduledJobs(jobsQuit)
+	defer close(jobsQuit)
+
 	// init frontend
-	frontend, err := web.New(config, backend, log)
+	frontend, err := web.New(config, backend, log.Package("web"))
 	if err != nil {
 		fmt.Printf("Unable to load frontend: %v\n", err)
 		os.Exit(1)
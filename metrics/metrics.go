@@ -0,0 +1,256 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buckets for durations in seconds, from 5ms to 10s.
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds metrics and writes them in the Prometheus text format.
+type Registry struct {
+	lock    sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+// Default is the registry the New* functions add metrics to.
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.names[name] {
+		panic(fmt.Sprintf("Duplicate metric %s", name))
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes every metric in the Prometheus text format, in the order they
+// were added.
+func (r *Registry) Write(w io.Writer) {
+	r.lock.Lock()
+	metrics := r.metrics
+	r.lock.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// ContentType of the output of Registry.Write()
+const ContentType string = "text/plain; version=0.0.4; charset=utf-8"
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d desc) header(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.ReplaceAll(d.help, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, kind)
+}
+
+// key joins label values so they can be used as a map key
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("Metric %s has %d labels, got %d values", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelString formats the labels for a sample, with an optional extra label
+// for histogram buckets.
+func (d desc) labelString(key string, extra ...string) string {
+	pairs := []string{}
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+"="+quoteLabel(value))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+quoteLabel(extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter is a value that only goes up, eg the number of votes cast.
+type Counter struct {
+	desc
+	lock   sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter adds a counter to the default registry.  Each combination of
+// label values is counted separately.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name, help, labels}, values: map[string]float64{}}
+	Default.register(name, c)
+	return c
+}
+
+// Inc adds one for the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+
+	c.lock.Lock()
+	c.values[key] += v
+	c.lock.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.header(w, "counter")
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Counters without labels are always there, even if they're zero
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+	}
+
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(key), formatFloat(c.values[key]))
+	}
+}
+
+// Histogram counts observations, eg durations, in buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+
+	lock   sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram adds a histogram to the default registry.  buckets are the
+// upper bounds, in increasing order.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name, help, labels},
+		buckets: buckets,
+		values:  map[string]*histogramValue{},
+	}
+	Default.register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	val, ok := h.values[key]
+	if !ok {
+		val = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = val
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			val.counts[i]++
+			break
+		}
+	}
+	val.sum += v
+	val.count++
+}
+
+// ObserveSince observes the time since start in seconds.
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.header(w, "histogram")
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, key := range sortedKeys(h.values) {
+		val := h.values[key]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += val.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", "+Inf"), val.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(key), formatFloat(val.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(key), val.count)
+	}
+}
+
+// GaugeFunc is a value that can go up and down, read when the metrics are
+// written.
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc adds a gauge to the default registry.
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help}, fn: fn}
+	Default.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	g.header(w, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
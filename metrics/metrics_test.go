@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+// newTestRegistry swaps the default registry for an empty one
+func newTestRegistry(t *testing.T) *Registry {
+	old := Default
+	Default = NewRegistry()
+	t.Cleanup(func() { Default = old })
+	return Default
+}
+
+func Test_Write(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	votes := NewCounter("test_votes_total", "Votes cast.")
+	requests := NewCounter("test_requests_total", "Requests.", "handler", "code")
+	duration := NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1}, "handler")
+	NewGaugeFunc("test_sessions", "Sessions.", func() float64 { return 3 })
+
+	requests.Inc("/vote/", "302")
+	requests.Inc("/vote/", "302")
+	requests.Inc(`/a"b\`, "200")
+	duration.Observe(0.05, "/")
+	duration.Observe(0.5, "/")
+	duration.Observe(5, "/")
+
+	var sb strings.Builder
+	reg.Write(&sb)
+
+	expected := `# HELP test_votes_total Votes cast.
+# TYPE test_votes_total counter
+test_votes_total 0
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{handler="/a\"b\\",code="200"} 1
+test_requests_total{handler="/vote/",code="302"} 2
+# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{handler="/",le="0.1"} 1
+test_duration_seconds_bucket{handler="/",le="1"} 2
+test_duration_seconds_bucket{handler="/",le="+Inf"} 3
+test_duration_seconds_sum{handler="/"} 5.55
+test_duration_seconds_count{handler="/"} 3
+# HELP test_sessions Sessions.
+# TYPE test_sessions gauge
+test_sessions 3
+`
+
+	if sb.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nExpected:\n%s", sb.String(), expected)
+	}
+
+	votes.Inc()
+	sb.Reset()
+	reg.Write(&sb)
+	if !strings.Contains(sb.String(), "\ntest_votes_total 1\n") {
+		t.Errorf("Expected the vote to be counted:\n%s", sb.String())
+	}
+}
+
+func Test_Duplicate(t *testing.T) {
+	newTestRegistry(t)
+	NewCounter("test_total", "Test.")
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic for a duplicate metric")
+		}
+	}()
+	NewCounter("test_total", "Test.")
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AUDIT_USER_DELETE    AuditAction = "user.delete"
+	AUDIT_USER_PURGE     AuditAction = "user.purge"
+	AUDIT_USER_ROLE      AuditAction = "user.role"
+	AUDIT_MOVIE_EDIT     AuditAction = "movie.edit"
+	AUDIT_MOVIE_REMOVE   AuditAction = "movie.remove"
+	AUDIT_MOVIE_APPROVE  AuditAction = "movie.approve"
+	AUDIT_MOVIE_REJECT   AuditAction = "movie.reject"
+	AUDIT_MOVIE_REFRESH  AuditAction = "movie.refresh"
+	AUDIT_MOVIE_REVERT   AuditAction = "movie.revert"
+	AUDIT_CONFIG_UPDATE  AuditAction = "config.update"
+	AUDIT_CONFIG_IMPORT  AuditAction = "config.import"
+	AUDIT_CONFIG_REVERT  AuditAction = "config.revert"
+	AUDIT_CYCLE_END      AuditAction = "cycle.end"
+	AUDIT_ROLE_UPDATE    AuditAction = "role.update"
+	AUDIT_POSTER_DELETE  AuditAction = "poster.delete"
+	AUDIT_TAG_RENAME     AuditAction = "tag.rename"
+	AUDIT_TAG_MERGE      AuditAction = "tag.merge"
+	AUDIT_TAG_ALIAS      AuditAction = "tag.alias"
+	AUDIT_LOG_LEVEL      AuditAction = "log.level"
+	AUDIT_THROTTLE_CLEAR AuditAction = "throttle.clear"
+)
+
+// All audit actions, in the order they are displayed.
+var AuditActions = []AuditAction{
+	AUDIT_USER_DELETE,
+	AUDIT_USER_PURGE,
+	AUDIT_USER_ROLE,
+	AUDIT_MOVIE_EDIT,
+	AUDIT_MOVIE_REMOVE,
+	AUDIT_MOVIE_APPROVE,
+	AUDIT_MOVIE_REJECT,
+	AUDIT_MOVIE_REFRESH,
+	AUDIT_MOVIE_REVERT,
+	AUDIT_CONFIG_UPDATE,
+	AUDIT_CONFIG_IMPORT,
+	AUDIT_CONFIG_REVERT,
+	AUDIT_CYCLE_END,
+	AUDIT_ROLE_UPDATE,
+	AUDIT_POSTER_DELETE,
+	AUDIT_TAG_RENAME,
+	AUDIT_TAG_MERGE,
+	AUDIT_TAG_ALIAS,
+	AUDIT_LOG_LEVEL,
+	AUDIT_THROTTLE_CLEAR,
+}
+
+// AuditEntry records a single administrative or moderation action.  Entries
+// are never changed or removed once they are added.
+type AuditEntry struct {
+	Id        int
+	Timestamp time.Time
+
+	// The actor's name is copied so it survives the account being deleted
+	// or purged.
+	ActorId   int
+	ActorName string
+
+	Action  AuditAction
+	Target  string
+	Changes []AuditChange
+}
+
+// AuditChange is a single changed field of the target.
+type AuditChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+func (c AuditChange) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Field, c.Before, c.After)
+}
+
+func (e AuditEntry) String() string {
+	return fmt.Sprintf("AuditEntry{Id:%d Timestamp:%s Actor:%q Action:%s Target:%q}",
+		e.Id,
+		e.Timestamp.Format(time.RFC3339),
+		e.ActorName,
+		e.Action,
+		e.Target,
+	)
+}
+
+// AuditFilter selects audit entries.  Empty fields match everything.
+type AuditFilter struct {
+	Actor  string // case insensitive actor name
+	Action AuditAction
+	Target string // case insensitive substring of the target
+	Since  *time.Time
+	Until  *time.Time
+}
+
+func (f AuditFilter) Match(e *AuditEntry) bool {
+	if f.Actor != "" && !strings.EqualFold(f.Actor, e.ActorName) {
+		return false
+	}
+
+	if f.Action != "" && f.Action != e.Action {
+		return false
+	}
+
+	if f.Target != "" && !strings.Contains(strings.ToLower(e.Target), strings.ToLower(f.Target)) {
+		return false
+	}
+
+	if f.Since != nil && e.Timestamp.Before(*f.Since) {
+		return false
+	}
+
+	if f.Until != nil && !e.Timestamp.Before(*f.Until) {
+		return false
+	}
+
+	return true
+}
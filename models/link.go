@@ -43,6 +43,27 @@ func (l Link) String() string {
 	return fmt.Sprintf("Link{Id: %v Url: %s Type: %s IsSource: %v}", l.Id, l.Url, l.Type, l.IsSource)
 }
 
+// Patterns for the ID of an entry at a site, keyed by the same site names
+// used for external IDs in the metadata results.
+var externalIdPatterns = map[string]*regexp.Regexp{
+	"imdb":        regexp.MustCompile(`imdb\.com/title/(tt[0-9]+)`),
+	"myanimelist": regexp.MustCompile(`myanimelist\.net/anime/([0-9]+)`),
+	"anilist":     regexp.MustCompile(`anilist\.co/anime/([0-9]+)`),
+	"tmdb":        regexp.MustCompile(`themoviedb\.org/movie/([0-9]+)`),
+	"tmdb-tv":     regexp.MustCompile(`themoviedb\.org/tv/([0-9]+)`),
+}
+
+// ExternalId returns the site and the ID of the entry the link points to, eg
+// "imdb" and "tt0084787".  Both are empty for links to other sites.
+func (l Link) ExternalId() (string, string) {
+	for site, re := range externalIdPatterns {
+		if match := re.FindStringSubmatch(l.Url); len(match) == 2 {
+			return site, match[1]
+		}
+	}
+	return "", ""
+}
+
 var re_validLink = *regexp.MustCompile(`[a-zA-Z0-9:._\+]{1,256}\.[a-zA-Z0-9()]{1,6}[a-zA-Z0-9%_:\+.\/]*`)
 
 func (l *Link) validateLink() error {
@@ -84,14 +105,32 @@ func cleanupLink(link string) string {
 	return link
 }
 
-func (l *Link) determineLinkType() error {
-	if strings.Contains(l.Url, "imdb") {
-		l.Type = "IMDb"
-		return nil
+type linkType struct {
+	name  string
+	match func(url string) bool
+}
+
+var linkTypes = []linkType{}
+
+// RegisterLinkType adds a type that links can be detected as.  Types are
+// checked in the order they were registered and links that don't match any
+// of them get the "Misc" type.
+func RegisterLinkType(name string, match func(url string) bool) {
+	for i, lt := range linkTypes {
+		if lt.name == name {
+			linkTypes[i].match = match
+			return
+		}
 	}
-	if strings.Contains(l.Url, "myanimelist") {
-		l.Type = "MyAnimeList"
-		return nil
+	linkTypes = append(linkTypes, linkType{name: name, match: match})
+}
+
+func (l *Link) determineLinkType() error {
+	for _, lt := range linkTypes {
+		if lt.match(l.Url) {
+			l.Type = lt.name
+			return nil
+		}
 	}
 
 	l.Type = "Misc"
@@ -21,11 +21,20 @@ type Movie struct {
 	Removed  bool // Removed by a mod or admin
 	Approved bool // Approved by a mod or admin (if required by config)
 
+	// Waiting in the approval queue.  Pending movies are hidden from the
+	// active list and cannot be voted on.
+	Pending      bool
+	RejectReason string // Set when a mod or admin rejects a pending movie
+
 	Votes []*Vote
 	Tags  []*Tag
 
 	Poster  string // TODO: make this procedural
 	AddedBy *User
+
+	// Fields changed by a mod or admin, eg "Description".  The metadata
+	// refresh leaves these alone.
+	EditedFields []string
 }
 
 func (m Movie) UserVoted(userId int) bool {
@@ -40,6 +49,22 @@ func (m Movie) UserVoted(userId int) bool {
 	return false
 }
 
+// FieldEdited returns true if the field was changed by a mod or admin.
+func (m Movie) FieldEdited(field string) bool {
+	for _, f := range m.EditedFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Rejected returns true if the movie was removed from the approval queue
+// instead of being approved.
+func (m Movie) Rejected() bool {
+	return m.Removed && m.RejectReason != ""
+}
+
 func (m Movie) String() string {
 	votes := []string{}
 	for _, v := range m.Votes {
@@ -0,0 +1,81 @@
+package models
+
+// Capability is a single permission that can be given to a role.
+type Capability string
+
+const (
+	CAP_APPROVE_MOVIES Capability = "ApproveMovies"
+	CAP_EDIT_MOVIES    Capability = "EditMovies"
+	CAP_MANAGE_CYCLES  Capability = "ManageCycles"
+	CAP_MANAGE_USERS   Capability = "ManageUsers"
+	CAP_EDIT_CONFIG    Capability = "EditConfig"
+	CAP_VIEW_AUDIT_LOG Capability = "ViewAuditLog"
+)
+
+// All known capabilities, in the order they are displayed.
+var Capabilities = []Capability{
+	CAP_APPROVE_MOVIES,
+	CAP_EDIT_MOVIES,
+	CAP_MANAGE_CYCLES,
+	CAP_MANAGE_USERS,
+	CAP_EDIT_CONFIG,
+	CAP_VIEW_AUDIT_LOG,
+}
+
+// All roles, in the order they are displayed.
+var Roles = []PrivilegeLevel{
+	PRIV_USER,
+	PRIV_MOD,
+	PRIV_ADMIN,
+}
+
+func (c Capability) Description() string {
+	switch c {
+	case CAP_APPROVE_MOVIES:
+		return "Approve or reject movies in the approval queue"
+	case CAP_EDIT_MOVIES:
+		return "Edit and remove movies"
+	case CAP_MANAGE_CYCLES:
+		return "Start and end cycles"
+	case CAP_MANAGE_USERS:
+		return "Edit, delete, and purge users"
+	case CAP_EDIT_CONFIG:
+		return "Edit the server configuration, including OAuth secrets"
+	case CAP_VIEW_AUDIT_LOG:
+		return "View and export the audit log"
+	}
+	return string(c)
+}
+
+func (c Capability) Valid() bool {
+	for _, cp := range Capabilities {
+		if cp == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (p PrivilegeLevel) String() string {
+	switch p {
+	case PRIV_USER:
+		return "User"
+	case PRIV_MOD:
+		return "Moderator"
+	case PRIV_ADMIN:
+		return "Admin"
+	}
+	return "Unknown"
+}
+
+// DefaultCapabilities returns the capabilities a role has if they haven't
+// been changed by an admin.  Admins always have every capability.
+func DefaultCapabilities(role PrivilegeLevel) []Capability {
+	switch role {
+	case PRIV_ADMIN:
+		return Capabilities
+	case PRIV_MOD:
+		return []Capability{CAP_APPROVE_MOVIES, CAP_EDIT_MOVIES}
+	}
+	return []Capability{}
+}
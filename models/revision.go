@@ -0,0 +1,168 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MovieRevision is a snapshot of the editable fields of a movie, taken every
+// time a mod or admin changes it.  Like audit entries, revisions are never
+// changed or removed once they are added.
+type MovieRevision struct {
+	Id        int
+	MovieId   int
+	Timestamp time.Time
+
+	// The editor's name is copied so it survives the account being deleted.
+	// Both are empty for the scheduled metadata refresh.
+	EditorId   int
+	EditorName string
+
+	// What made the change, eg "Edited" or "Reverted to revision 3".
+	Comment string
+
+	Name        string
+	Description string
+	Remarks     string
+	Duration    string
+	Rating      float32
+	Poster      string
+	Links       []string // Link URLs, source link first
+}
+
+// NewMovieRevision takes a snapshot of the current state of movie.
+func NewMovieRevision(movie *Movie, editor *User, comment string) *MovieRevision {
+	rev := &MovieRevision{
+		MovieId:     movie.Id,
+		Timestamp:   time.Now(),
+		Comment:     comment,
+		Name:        movie.Name,
+		Description: movie.Description,
+		Remarks:     movie.Remarks,
+		Duration:    movie.Duration,
+		Rating:      movie.Rating,
+		Poster:      movie.Poster,
+		Links:       []string{},
+	}
+
+	for _, link := range movie.Links {
+		rev.Links = append(rev.Links, link.Url)
+	}
+
+	if editor != nil {
+		rev.EditorId = editor.Id
+		rev.EditorName = editor.Name
+	}
+
+	return rev
+}
+
+// Fields returns the snapshot as strings, keyed by field name.
+func (r MovieRevision) Fields() map[string]string {
+	return map[string]string{
+		"Name":        r.Name,
+		"Description": r.Description,
+		"Remarks":     r.Remarks,
+		"Duration":    r.Duration,
+		"Rating":      fmt.Sprintf("%.1f", r.Rating),
+		"Poster":      r.Poster,
+		"Links":       strings.Join(r.Links, " "),
+	}
+}
+
+func (r MovieRevision) String() string {
+	return fmt.Sprintf("MovieRevision{Id:%d MovieId:%d Timestamp:%s Editor:%q Comment:%q}",
+		r.Id,
+		r.MovieId,
+		r.Timestamp.Format(time.RFC3339),
+		r.EditorName,
+		r.Comment,
+	)
+}
+
+type DiffOp string
+
+const (
+	DIFF_SAME   DiffOp = ""
+	DIFF_DELETE DiffOp = "del"
+	DIFF_INSERT DiffOp = "ins"
+)
+
+// DiffSegment is a run of words that are the same in both texts, or only in
+// one of them.
+type DiffSegment struct {
+	Op   DiffOp
+	Text string
+}
+
+// Word diffs are quadratic.  Texts longer than this are shown as deleted and
+// inserted as a whole instead.
+const maxDiffWords int = 2000
+
+// DiffWords compares two texts word by word.
+func DiffWords(before, after string) []DiffSegment {
+	a, b := strings.Fields(before), strings.Fields(after)
+	if len(a) > maxDiffWords || len(b) > maxDiffWords {
+		return joinSegments([]DiffSegment{
+			{Op: DIFF_DELETE, Text: before},
+			{Op: DIFF_INSERT, Text: after},
+		})
+	}
+
+	// Length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	segments := []DiffSegment{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			segments = append(segments, DiffSegment{Op: DIFF_SAME, Text: a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			segments = append(segments, DiffSegment{Op: DIFF_DELETE, Text: a[i]})
+			i++
+		default:
+			segments = append(segments, DiffSegment{Op: DIFF_INSERT, Text: b[j]})
+			j++
+		}
+	}
+
+	return joinSegments(segments)
+}
+
+// joinSegments merges neighbouring segments with the same op and drops empty
+// ones.
+func joinSegments(segments []DiffSegment) []DiffSegment {
+	joined := []DiffSegment{}
+	for _, seg := range segments {
+		if seg.Text == "" {
+			continue
+		}
+
+		last := len(joined) - 1
+		if last >= 0 && joined[last].Op == seg.Op {
+			joined[last].Text += " " + seg.Text
+		} else {
+			joined = append(joined, seg)
+		}
+	}
+	return joined
+}
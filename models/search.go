@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type SearchStatus string
+
+const (
+	SEARCH_ANY     SearchStatus = "" // Active and watched, but not removed
+	SEARCH_ACTIVE  SearchStatus = "active"
+	SEARCH_WATCHED SearchStatus = "watched"
+	SEARCH_REMOVED SearchStatus = "removed"
+)
+
+// SearchQuery is a full-text search over movies.  Movies awaiting approval
+// are never returned.  Empty fields don't filter anything.
+type SearchQuery struct {
+	Text string
+
+	Status  SearchStatus
+	CycleId int      // Added or watched in this cycle
+	Tags    []string // Must have all of these tags, or their aliases
+
+	// Runtime in minutes.  Movies with an unknown runtime are left out when
+	// either is set.
+	MinRuntime int
+	MaxRuntime int
+
+	MinRating float32
+}
+
+// SearchResult is a movie matching a search.  Results are sorted by score,
+// highest first.  The score is zero when the query has no text.
+type SearchResult struct {
+	Movie *Movie
+	Score float64
+}
+
+func (q SearchQuery) String() string {
+	return fmt.Sprintf("SearchQuery{Text:%q Status:%q CycleId:%d Tags:%q Runtime:%d-%d MinRating:%.1f}",
+		q.Text, q.Status, q.CycleId, q.Tags, q.MinRuntime, q.MaxRuntime, q.MinRating)
+}
+
+// Match checks the filters of the query against a movie, ignoring the text.
+// Database connectors without a native way to filter can use this.
+func (q SearchQuery) Match(movie *Movie) bool {
+	if movie.Pending {
+		return false
+	}
+
+	switch q.Status {
+	case SEARCH_ANY:
+		if movie.Removed {
+			return false
+		}
+	case SEARCH_ACTIVE:
+		if movie.Removed || movie.CycleWatched != nil {
+			return false
+		}
+	case SEARCH_WATCHED:
+		if movie.Removed || movie.CycleWatched == nil {
+			return false
+		}
+	case SEARCH_REMOVED:
+		if !movie.Removed {
+			return false
+		}
+	}
+
+	if q.CycleId != 0 {
+		added := movie.CycleAdded != nil && movie.CycleAdded.Id == q.CycleId
+		watched := movie.CycleWatched != nil && movie.CycleWatched.Id == q.CycleId
+		if !added && !watched {
+			return false
+		}
+	}
+
+	for _, tag := range q.Tags {
+		if !movieContainsTag(movie, tag) {
+			return false
+		}
+	}
+
+	if q.MinRuntime > 0 || q.MaxRuntime > 0 {
+		runtime := movie.RuntimeMinutes()
+		if runtime == 0 || runtime < q.MinRuntime || (q.MaxRuntime > 0 && runtime > q.MaxRuntime) {
+			return false
+		}
+	}
+
+	if q.MinRating > 0 && movie.Rating < q.MinRating {
+		return false
+	}
+
+	return true
+}
+
+// Tokenize splits text into lower case words for the search index.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+var (
+	re_runtimeEpisodes = regexp.MustCompile(`([0-9]+)\s*eps?\s*x\s*([0-9]+)\s*min`)
+	re_runtimeHours    = regexp.MustCompile(`([0-9]+)\s*(?:hr|h)`)
+	re_runtimeMinutes  = regexp.MustCompile(`([0-9]+)\s*(?:min|m\b)`)
+)
+
+// RuntimeMinutes parses the Duration of the movie, eg "1 hr 57 min" or
+// "6 eps x 24 min".  Returns zero if the duration can't be parsed.
+func (m Movie) RuntimeMinutes() int {
+	duration := strings.ToLower(m.Duration)
+
+	if match := re_runtimeEpisodes.FindStringSubmatch(duration); match != nil {
+		episodes, _ := strconv.Atoi(match[1])
+		minutes, _ := strconv.Atoi(match[2])
+		return episodes * minutes
+	}
+
+	total := 0
+	if match := re_runtimeHours.FindStringSubmatch(duration); match != nil {
+		hours, _ := strconv.Atoi(match[1])
+		total += hours * 60
+	}
+
+	if match := re_runtimeMinutes.FindStringSubmatch(duration); match != nil {
+		minutes, _ := strconv.Atoi(match[1])
+		total += minutes
+	}
+
+	return total
+}
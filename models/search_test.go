@@ -0,0 +1,104 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_SearchQueryMatch(t *testing.T) {
+	cycle1 := &Cycle{Id: 1}
+	cycle2 := &Cycle{Id: 2}
+	scifi := &Tag{Id: 1, Name: "Sci-Fi", Aliases: []string{"Science Fiction"}}
+	anime := &Tag{Id: 2, Name: "Anime"}
+
+	active := &Movie{Id: 1, Duration: "2 hr 4 min", Rating: 8.0, CycleAdded: cycle2, Tags: []*Tag{scifi, anime}}
+	watched := &Movie{Id: 2, Duration: "1 hr 30 min", Rating: 6.5, CycleAdded: cycle1, CycleWatched: cycle2, Tags: []*Tag{scifi}}
+	removed := &Movie{Id: 3, Duration: "90 min", Rating: 5.0, CycleAdded: cycle1, Removed: true}
+	pending := &Movie{Id: 4, Duration: "90 min", CycleAdded: cycle2, Pending: true}
+	unknown := &Movie{Id: 5, Duration: "Unknown", Rating: 7.0, CycleAdded: cycle1}
+
+	movies := []*Movie{active, watched, removed, pending, unknown}
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []int
+	}{
+		{"any", SearchQuery{}, []int{1, 2, 5}},
+		{"active", SearchQuery{Status: SEARCH_ACTIVE}, []int{1, 5}},
+		{"watched", SearchQuery{Status: SEARCH_WATCHED}, []int{2}},
+		{"removed", SearchQuery{Status: SEARCH_REMOVED}, []int{3}},
+		{"added in cycle", SearchQuery{CycleId: 1}, []int{2, 5}},
+		{"watched in cycle", SearchQuery{CycleId: 2}, []int{1, 2}},
+		{"tag", SearchQuery{Tags: []string{"sci-fi"}}, []int{1, 2}},
+		{"tag alias", SearchQuery{Tags: []string{"science fiction"}}, []int{1, 2}},
+		{"all tags", SearchQuery{Tags: []string{"Sci-Fi", "Anime"}}, []int{1}},
+		{"unknown tag", SearchQuery{Tags: []string{"Horror"}}, []int{}},
+		{"min runtime", SearchQuery{MinRuntime: 100}, []int{1}},
+		{"max runtime", SearchQuery{MaxRuntime: 100}, []int{2}},
+		{"runtime range", SearchQuery{MinRuntime: 90, MaxRuntime: 124}, []int{1, 2}},
+		{"min rating", SearchQuery{MinRating: 7.0}, []int{1, 5}},
+		{"combined", SearchQuery{Status: SEARCH_ACTIVE, Tags: []string{"Anime"}, MinRating: 7.5, MaxRuntime: 130}, []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []int{}
+			for _, movie := range movies {
+				if tt.query.Match(movie) {
+					got = append(got, movie.Id)
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: expected %v, got %v", tt.query, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_Tokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Terminator 2: Judgment Day", []string{"terminator", "2", "judgment", "day"}},
+		{"Sci-Fi", []string{"sci", "fi"}},
+		{"  Amélie  ", []string{"amélie"}},
+		{"!?", []string{}},
+	}
+
+	for _, tt := range tests {
+		got := Tokenize(tt.text)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.text, tt.want, got)
+		}
+	}
+}
+
+func Test_RuntimeMinutes(t *testing.T) {
+	tests := []struct {
+		duration string
+		want     int
+	}{
+		{"1 hr 57 min", 117},
+		{"2 hr", 120},
+		{"124 min", 124},
+		{"6 eps x 24 min", 144},
+		{"1 ep x 90 min", 90},
+		{"2h 4m", 124},
+		{"24 min per ep", 24},
+		{"Unknown", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := (Movie{Duration: tt.duration}).RuntimeMinutes(); got != tt.want {
+			t.Errorf("%q: expected %d, got %d", tt.duration, tt.want, got)
+		}
+	}
+}
@@ -1,6 +1,31 @@
 package models
 
+import (
+	"strings"
+)
+
 type Tag struct {
 	Id   int
 	Name string
+
+	// Other names for the same tag, eg "Science Fiction" for "Sci-Fi".
+	// Provider genres and tag searches that match an alias use this tag.
+	Aliases []string
+}
+
+// Matches returns true if name is the name or one of the aliases of the tag,
+// ignoring case and surrounding whitespace.  Older tags were stored without
+// trimming the provider genres.
+func (t Tag) Matches(name string) bool {
+	name = strings.TrimSpace(name)
+	if strings.EqualFold(strings.TrimSpace(t.Name), name) {
+		return true
+	}
+
+	for _, alias := range t.Aliases {
+		if strings.EqualFold(strings.TrimSpace(alias), name) {
+			return true
+		}
+	}
+	return false
 }
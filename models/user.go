@@ -40,7 +40,7 @@ func (u User) IsAdmin() bool {
 }
 
 func (u User) IsMod() bool {
-	return u.Privilege >= PRIV_ADMIN
+	return u.Privilege >= PRIV_MOD
 }
 
 func (u User) GetAuthMethod(method AuthType) (*AuthMethod, error) {
@@ -31,6 +31,93 @@ func CleanMovieName(input string) string {
 	return re_cleanName.ReplaceAllString(input, " ")
 }
 
+var re_titleYear = regexp.MustCompile(`[\(\[]\s*(19|20)[0-9]{2}\s*[\)\]]`)
+var re_titleParens = regexp.MustCompile(`\(([^\)]*)\)`)
+var re_titlePunct = regexp.MustCompile(`[^\pL\pN]+`)
+
+// Articles that are moved to the end of sorted titles, eg "Thing, The".
+var titleArticles = []string{"the", "a", "an", "l", "le", "la", "les", "el", "los", "las", "der", "die", "das", "il"}
+
+var re_titleTrailingArticle = regexp.MustCompile(`,\s*(` + strings.Join(titleArticles, "|") + `)'?\s*$`)
+
+// NormalizeTitle reduces a title to the words that matter when looking for
+// duplicates.  Case, punctuation and years in brackets are dropped, and an
+// article after a comma at the end is moved back to the front, so
+// "The Thing (1982)" and "Thing, The" both become "the thing".  Articles are
+// kept otherwise, "Die Hard" and "Plan A" are titles of their own.
+func NormalizeTitle(title string) string {
+	title = strings.ToLower(title)
+	title = re_titleYear.ReplaceAllString(title, " ")
+
+	// "Thing, The"
+	if match := re_titleTrailingArticle.FindStringSubmatchIndex(title); match != nil {
+		title = title[match[2]:match[3]] + " " + title[:match[0]]
+	}
+
+	// l'homme, d'artagnan
+	title = strings.ReplaceAll(title, "'", " ")
+	words := strings.Fields(re_titlePunct.ReplaceAllString(title, " "))
+
+	return strings.Join(words, " ")
+}
+
+// TitleVariants returns the normalized title along with the normalized parts
+// inside and outside of parentheses.  Autofilled anime titles have the
+// English title in parentheses, eg "Sen to Chihiro no Kamikakushi (Spirited
+// Away)", so either one can match another movie.
+func TitleVariants(title string) []string {
+	title = re_titleYear.ReplaceAllString(title, " ")
+
+	candidates := []string{title, re_titleParens.ReplaceAllString(title, " ")}
+	for _, match := range re_titleParens.FindAllStringSubmatch(title, -1) {
+		candidates = append(candidates, match[1])
+	}
+
+	variants := []string{}
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		n := NormalizeTitle(c)
+		if n != "" && !seen[n] {
+			seen[n] = true
+			variants = append(variants, n)
+		}
+	}
+	return variants
+}
+
+// EditDistance returns the Levenshtein distance between two strings,
+// counted in runes.
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
 func IntSliceContains(needle int, haystack []int) bool {
 	for _, i := range haystack {
 		if i == needle {
@@ -76,7 +163,7 @@ func FilterMoviesByTags(movies []*Movie, tags []string) ([]*Movie, error) {
 func movieContainsTag(movie *Movie, tag string) bool {
 
 	for _, mTag := range movie.Tags {
-		if strings.EqualFold(tag, mTag.Name) {
+		if mTag.Matches(tag) {
 			return true
 		}
 	}
@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+func Test_NormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"The Thing (1982)", "the thing"},
+		{"Thing, The", "the thing"},
+		{"Thing, The [1982]", "the thing"},
+		{"Homme, L'", "l homme"},
+		{"Terminator 2: Judgment Day", "terminator 2 judgment day"},
+		{"  AKIRA  ", "akira"},
+		{"Die Hard", "die hard"},
+		{"Plan A", "plan a"},
+		{"A", "a"},
+		{"(1999)", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeTitle(tt.title); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.title, tt.want, got)
+		}
+	}
+}
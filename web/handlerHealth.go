@@ -0,0 +1,200 @@
+package web
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zorchenhimer/MoviePolls/logic"
+	"github.com/zorchenhimer/MoviePolls/metrics"
+)
+
+var (
+	metricRequests = metrics.NewCounter("moviepolls_http_requests_total",
+		"Number of HTTP requests, by route and status code.", "handler", "code")
+	metricRequestDuration = metrics.NewHistogram("moviepolls_http_request_duration_seconds",
+		"Time taken to handle HTTP requests, by route.", metrics.DurationBuckets, "handler")
+	_ = metrics.NewGaugeFunc("moviepolls_active_sessions",
+		"Number of users with a session that were seen in the last 15 minutes.", activeSessions.count)
+)
+
+// How long a user counts as active after their last request
+const activeSessionWindow = 15 * time.Minute
+
+var activeSessions = &sessionTracker{lastSeen: map[int]time.Time{}}
+
+// sessionTracker remembers when users with a session were last seen.  The
+// sessions themselves are only stored in the cookies.
+type sessionTracker struct {
+	lock     sync.Mutex
+	lastSeen map[int]time.Time
+}
+
+func (st *sessionTracker) seen(userId int) {
+	st.lock.Lock()
+	st.lastSeen[userId] = time.Now()
+	st.lock.Unlock()
+}
+
+// count returns the number of users seen recently and forgets the others.
+func (st *sessionTracker) count() float64 {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	for id, t := range st.lastSeen {
+		if time.Since(t) > activeSessionWindow {
+			delete(st.lastSeen, id)
+		}
+	}
+	return float64(len(st.lastSeen))
+}
+
+// statusRecorder keeps the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.status == 0 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// instrument counts the requests to a route and how long they take.  The
+// route is used as the label instead of the path so IDs in the path don't
+// add a new series for every movie.  Handlers that panic are counted as a
+// 500, recoverPanic further out handles the panic itself.
+func (s *webServer) instrument(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			err := recover()
+			if err != nil {
+				rec.status = http.StatusInternalServerError
+			} else if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			metricRequests.Inc(route, strconv.Itoa(rec.status))
+			metricRequestDuration.ObserveSince(start, route)
+
+			if err != nil {
+				panic(err)
+			}
+		}()
+
+		handler(rec, r)
+	}
+}
+
+// handlerHealthz reports that the process is up.
+func (s *webServer) handlerHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handlerReadyz reports whether the server can handle requests: the
+// database can be reached and the templates are loaded.
+func (s *webServer) handlerReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := []string{}
+	ready := true
+
+	if err := s.backend.Ping(); err != nil {
+		s.l.Error("Readiness check: database unavailable: %v", err)
+		checks = append(checks, "database: unavailable")
+		ready = false
+	} else {
+		checks = append(checks, "database: ok")
+	}
+
+	if len(s.templates) != len(templateDefs) {
+		checks = append(checks, fmt.Sprintf("templates: %d of %d loaded", len(s.templates), len(templateDefs)))
+		ready = false
+	} else {
+		checks = append(checks, "templates: ok")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, strings.Join(checks, "\n"))
+}
+
+// handlerMetrics writes the metrics in the Prometheus text format for
+// clients with the metrics token or from an allowed address.
+func (s *webServer) handlerMetrics(w http.ResponseWriter, r *http.Request) {
+	if !s.metricsAllowed(r) {
+		s.l.Info("Refused /metrics to %s", r.RemoteAddr)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	metrics.Default.Write(w)
+}
+
+func (s *webServer) metricsAllowed(r *http.Request) bool {
+	token, err := s.backend.GetMetricsToken()
+	if err != nil {
+		s.l.Error("Unable to get metrics token: %v", err)
+	} else if token != "" {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	allowed, err := s.backend.GetMetricsAllowedIPs()
+	if err != nil {
+		s.l.Error("Unable to get allowed metrics IPs: %v", err)
+		return false
+	}
+
+	// The address of the connection, not X-Forwarded-For, which can be set
+	// by anyone.
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, entry := range allowed {
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				s.l.Error("Invalid CIDR range %q in %s", entry, logic.ConfigMetricsAllowedIPs)
+				continue
+			}
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowedIp := net.ParseIP(entry); allowedIp == nil {
+			s.l.Error("Invalid address %q in %s", entry, logic.ConfigMetricsAllowedIPs)
+		} else if allowedIp.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
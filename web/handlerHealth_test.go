@@ -0,0 +1,39 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/metrics"
+)
+
+// A handler that panics is counted as a 500, even though recoverPanic is
+// further out.
+func Test_InstrumentPanic(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.recoverPanic(s.instrument("/test-panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test-panic", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rec.Code)
+	}
+
+	var sb strings.Builder
+	metrics.Default.Write(&sb)
+	output := sb.String()
+
+	for _, line := range []string{
+		`moviepolls_http_requests_total{handler="/test-panic",code="500"} 1`,
+		`moviepolls_http_request_duration_seconds_count{handler="/test-panic"} 1`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected %q in the metrics", line)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/zorchenhimer/MoviePolls/logic"
 	"github.com/zorchenhimer/MoviePolls/models"
 )
 
@@ -24,11 +25,29 @@ func (s *webServer) handlerPosters(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Dirty but might work out fine
-	if file != "/posters" {
-		http.ServeFile(w, r, file)
-	} else {
+	if file == "posters" || file == "/posters" {
 		http.Error(w, "Nothing to see here. Go away!", http.StatusForbidden)
+		return
+	}
+
+	// ?size=thumb serves the thumbnail.  Posters from before there were
+	// thumbnails don't have one, so fall back to the full size.
+	if r.URL.Query().Get("size") == "thumb" {
+		thumb := logic.PosterThumbnail(file)
+		if models.FileExists(thumb) {
+			file = thumb
+		}
+	}
+
+	// Hashed names change when the content changes, so they never need to
+	// be checked again.
+	if logic.IsHashedPoster(file) {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
 	}
+
+	http.ServeFile(w, r, file)
 }
 
 func (s *webServer) handlerFavicon(w http.ResponseWriter, r *http.Request) {
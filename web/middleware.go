@@ -0,0 +1,169 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// A middleware wraps a handler to do something before or after it.
+type middleware func(http.Handler) http.Handler
+
+// chain wraps handler in the middlewares.  The first one is the outermost,
+// so it sees the request first and the response last.
+func chain(handler http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Defaults for the server options that aren't set.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 60 * time.Second // autofill can take a while
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxBodySize       = 1 << 20
+	defaultMaxHeaderBytes    = 64 << 10
+)
+
+// The pages use inline scripts and styles, Font Awesome, the Material Icons
+// on the vote buttons from Google Fonts, and the posters of search results
+// straight from the metadata providers.
+const contentSecurityPolicy string = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline'; " +
+	"style-src 'self' 'unsafe-inline' https://use.fontawesome.com https://fonts.googleapis.com; " +
+	"font-src 'self' https://use.fontawesome.com https://fonts.gstatic.com; " +
+	"img-src 'self' data: https:; " +
+	"object-src 'none'; " +
+	"base-uri 'self'; " +
+	"frame-ancestors 'none'"
+
+// responseRecorder keeps the status code and size of a response for the
+// access log.
+type responseRecorder struct {
+	statusRecorder
+	size int
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	n, err := rr.statusRecorder.Write(b)
+	rr.size += n
+	return n, err
+}
+
+// accessLog logs every request after it's been handled.
+func (s *webServer) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		s.requestLog(r).With(
+			"status", rec.status,
+			"bytes", rec.size,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote", r.RemoteAddr,
+		).Info("%s %s", r.Method, r.URL.RequestURI())
+	})
+}
+
+// recoverPanic logs panics in handlers and shows the error page instead of
+// dropping the connection.
+func (s *webServer) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+
+			// Used by net/http to abort a response on purpose
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			s.requestLog(r).Error("Panic handling %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+
+			// Too late for an error page if the response has started
+			if rec.status != 0 {
+				return
+			}
+			s.panicPage(rec, r)
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// panicPage renders the 500 page.  It falls back to plain text if that
+// panics too, eg because the backend is what's broken.
+func (s *webServer) panicPage(w *statusRecorder, r *http.Request) {
+	defer func() {
+		if err := recover(); err != nil {
+			s.requestLog(r).Error("Panic rendering the error page: %v", err)
+			if w.status == 0 {
+				http.Error(w, "Something went wrong :C", http.StatusInternalServerError)
+			}
+		}
+	}()
+
+	s.doError(http.StatusInternalServerError, "Something went wrong :C", w, r)
+}
+
+// securityHeaders adds headers that tell browsers to be strict with the
+// pages.
+func (s *webServer) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy)
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "same-origin")
+
+		// Only over HTTPS, or browsers would be stuck if it goes away.  A
+		// proxy terminating TLS says so in X-Forwarded-Proto.
+		if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitBody limits the size of request bodies.  Forms with files can be as
+// big as the largest allowed poster on top of that.
+func (s *webServer) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := s.maxBodySize
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			posterSize, err := s.backend.GetMaxUploadlimit()
+			if err != nil {
+				s.requestLog(r).Error("Unable to get the upload limit: %v", err)
+			} else {
+				limit += int64(posterSize)
+			}
+		}
+
+		if r.ContentLength > limit {
+			s.doError(
+				http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("The request is too big, the limit is %d bytes", limit),
+				w, r)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,220 @@
+package web
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/zorchenhimer/MoviePolls/database"
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/logic"
+)
+
+// The template paths are relative to the root of the repository.
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestServer sets up a server with a backend on an empty database, but
+// without any of the handlers.
+func newTestServer(t *testing.T) *webServer {
+	s, _ := newTestServerData(t)
+	return s
+}
+
+// newTestServerData is newTestServer that also returns the database, to add
+// things the backend can't.
+func newTestServerData(t *testing.T) (*webServer, database.Database) {
+	log := logger.NewSilent()
+
+	db, err := database.GetDatabase("json", filepath.Join(t.TempDir(), "data.json"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := logic.New(db, log, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authKey, encryptKey, _, err := backend.GetKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &webServer{
+		backend:     backend,
+		cookies:     sessions.NewCookieStore([]byte(authKey), []byte(encryptKey)),
+		l:           log,
+		maxBodySize: 1024,
+	}
+
+	if err = s.registerTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	return s, db
+}
+
+func Test_RecoverPanic(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rec.Code)
+	}
+
+	// The error page, not the plain text fallback
+	body := rec.Body.String()
+	if !strings.Contains(body, `<div id="errWrapper">`) || !strings.Contains(body, "Something went wrong :C") {
+		t.Errorf("Expected the error page, got %q", body)
+	}
+}
+
+func Test_RecoverPanicAfterWrite(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("half a page"))
+		panic("oops")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "half a page" {
+		t.Errorf("Expected the started response to be left alone, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func Test_SecurityHeaders(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+		hsts bool
+	}{
+		{
+			name: "http",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/", nil)
+			},
+			hsts: false,
+		},
+		{
+			name: "tls",
+			req: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.TLS = &tls.ConnectionState{}
+				return r
+			},
+			hsts: true,
+		},
+		{
+			name: "proxy",
+			req: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("X-Forwarded-Proto", "HTTPS")
+				return r
+			},
+			hsts: true,
+		},
+		{
+			name: "proxy without tls",
+			req: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("X-Forwarded-Proto", "http")
+				return r
+			},
+			hsts: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.req())
+			h := rec.Header()
+
+			expected := map[string]string{
+				"Content-Security-Policy": contentSecurityPolicy,
+				"X-Frame-Options":         "DENY",
+				"X-Content-Type-Options":  "nosniff",
+				"Referrer-Policy":         "same-origin",
+			}
+			for key, val := range expected {
+				if h.Get(key) != val {
+					t.Errorf("Expected %s %q, got %q", key, val, h.Get(key))
+				}
+			}
+
+			if hsts := h.Get("Strict-Transport-Security") != ""; hsts != tt.hsts {
+				t.Errorf("Expected Strict-Transport-Security to be sent: %t, got %q", tt.hsts, h.Get("Strict-Transport-Security"))
+			}
+		})
+	}
+}
+
+// The vote buttons use Material Icons from Google Fonts.
+func Test_ContentSecurityPolicyFonts(t *testing.T) {
+	for _, src := range []string{
+		"style-src 'self' 'unsafe-inline' https://use.fontawesome.com https://fonts.googleapis.com;",
+		"font-src 'self' https://use.fontawesome.com https://fonts.gstatic.com;",
+	} {
+		if !strings.Contains(contentSecurityPolicy, src) {
+			t.Errorf("Expected %q in the policy", src)
+		}
+	}
+}
+
+func Test_LimitBody(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.limitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	posterSize, err := s.backend.GetMaxUploadlimit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		size        int
+		contentType string
+		status      int
+	}{
+		{"small form", 100, "application/x-www-form-urlencoded", http.StatusNoContent},
+		{"big form", 2048, "application/x-www-form-urlencoded", http.StatusRequestEntityTooLarge},
+		{"form with a poster", 2048, "multipart/form-data; boundary=x", http.StatusNoContent},
+		{"poster too big", 1024 + posterSize + 1, "multipart/form-data; boundary=x", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader(strings.Repeat("a", tt.size)))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+}
@@ -1,13 +1,18 @@
 package web
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/zorchenhimer/MoviePolls/logic"
 )
 
 func (s *webServer) handlerPageAddMovie(w http.ResponseWriter, r *http.Request) {
+	log := s.requestLog(r)
+	backend := s.requestBackend(r)
 
 	// Get the user which adds a movie
 	user := s.getSessionUser(w, r)
@@ -17,14 +22,14 @@ func (s *webServer) handlerPageAddMovie(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Get the current cycle to see if we can add a movie
-	currentCycle, err := s.backend.GetCurrentCycle()
+	currentCycle, err := backend.GetCurrentCycle()
 	if err != nil {
 		s.doError(
 			http.StatusInternalServerError,
 			"Something went wrong :C",
 			w, r)
 
-		s.l.Error("Unable to get current cycle: %v", err)
+		log.Error("Unable to get current cycle: %v", err)
 		return
 	}
 
@@ -36,69 +41,69 @@ func (s *webServer) handlerPageAddMovie(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	formfillEnabled, err := s.backend.GetFormFillEnabled()
+	formfillEnabled, err := backend.GetFormFillEnabled()
 	if err != nil {
 		s.doError(
 			http.StatusInternalServerError,
 			"Something went wrong :C",
 			w, r)
 
-		s.l.Error("Unable to get config value %s: %v", logic.ConfigFormfillEnabled, err)
+		log.Error("Unable to get config value %s: %v", logic.ConfigFormfillEnabled, err)
 		return
 	}
 
-	autofillEnabled, err := s.backend.GetAutofillEnabled()
+	autofillEnabled, err := backend.GetAutofillEnabled()
 	if err != nil {
 		s.doError(
 			http.StatusInternalServerError,
 			"Something went wrong :C",
 			w, r)
 
-		s.l.Error("Unable to determine if autofill is enabled")
+		log.Error("Unable to determine if autofill is enabled")
 		return
 	}
 
-	maxTitleLen, err := s.backend.GetMaxTitleLength()
+	maxTitleLen, err := backend.GetMaxTitleLength()
 	if err != nil {
 		s.doError(
 			http.StatusInternalServerError,
 			"Something went wrong :C",
 			w, r)
 
-		s.l.Error("Unable to get config value %s: %v", logic.ConfigMaxTitleLength, err)
+		log.Error("Unable to get config value %s: %v", logic.ConfigMaxTitleLength, err)
 		return
 	}
 
-	maxDescriptionLen, err := s.backend.GetMaxDescriptionLength()
+	maxDescriptionLen, err := backend.GetMaxDescriptionLength()
 	if err != nil {
 		s.doError(
 			http.StatusInternalServerError,
 			"Something went wrong :C",
 			w, r)
 
-		s.l.Error("Unable to get config value %s: %v", logic.ConfigMaxDescriptionLength, err)
+		log.Error("Unable to get config value %s: %v", logic.ConfigMaxDescriptionLength, err)
 		return
 	}
 
-	maxLinkLen, err := s.backend.GetMaxLinkLength()
+	maxLinkLen, err := backend.GetMaxLinkLength()
 	if err != nil {
 		s.doError(
 			http.StatusInternalServerError,
 			"Something went wrong :C",
 			w, r)
 
-		s.l.Error("Unable to get config value %s: %v", logic.ConfigMaxLinkLength, err)
+		log.Error("Unable to get config value %s: %v", logic.ConfigMaxLinkLength, err)
 		return
 	}
 
-	maxRemLen, err := s.backend.GetMaxRemarksLength()
+	maxRemLen, err := backend.GetMaxRemarksLength()
 	if err != nil {
 		s.doError(
 			http.StatusInternalServerError,
 			"Something went wrong :C",
 			w, r)
 
-		s.l.Error("Unable to get config value %s: %v", logic.ConfigMaxRemarksLength, err)
+		log.Error("Unable to get config value %s: %v", logic.ConfigMaxRemarksLength, err)
 		return
 	}
 
@@ -117,6 +122,16 @@ func (s *webServer) handlerPageAddMovie(w http.ResponseWriter, r *http.Request)
 		MaxRemarksLength     int
 
 		FileError error
+
+		// Likely duplicates of the submitted movie
+		Duplicates *logic.DuplicateError
+
+		// Title search for autofill
+		SearchTitle   string
+		SearchYear    string
+		SearchResults []*logic.MetadataCandidate
+		SearchError   error
+		PickError     error
 	}{
 		dataPageBase: s.newPageBase("Add Movie", w, r),
 
@@ -129,10 +144,49 @@ func (s *webServer) handlerPageAddMovie(w http.ResponseWriter, r *http.Request)
 		MaxRemarksLength:     maxRemLen,
 	}
 
+	if r.Method == http.MethodGet && autofillEnabled {
+		query := r.URL.Query()
+
+		// Both ask the metadata providers
+		if query.Get("Search") != "" || query.Get("Pick") != "" {
+			if s.rateLimited(logic.RateLimitSearch, user, w, r) {
+				return
+			}
+		}
+
+		data.SearchTitle = strings.TrimSpace(query.Get("Search"))
+		data.SearchYear = strings.TrimSpace(query.Get("Year"))
+
+		if data.SearchTitle != "" {
+			year := 0
+			if data.SearchYear != "" {
+				year, err = strconv.Atoi(data.SearchYear)
+				if err != nil || year < 1800 || year > 3000 {
+					data.SearchError = fmt.Errorf("Invalid year %q", data.SearchYear)
+				}
+			}
+
+			if data.SearchError == nil {
+				data.SearchResults, data.SearchError = backend.SearchMetadata(data.SearchTitle, year)
+				if data.SearchError == nil && len(data.SearchResults) == 0 {
+					data.SearchError = fmt.Errorf("Nothing found for %q", data.SearchTitle)
+				}
+			}
+		}
+
+		if pick := query.Get("Pick"); pick != "" {
+			data.Fields, data.PickError = backend.PrefillFromMetadata(pick)
+		}
+	}
+
 	if r.Method == http.MethodPost {
+		if s.rateLimited(logic.RateLimitAdd, user, w, r) {
+			return
+		}
+
 		err = r.ParseMultipartForm(4096)
 		if err != nil {
-			s.l.Error("Error parsing movie form: %v", err)
+			log.Error("Error parsing movie form: %v", err)
 		}
 
 		input := make(map[string]*logic.InputField)
@@ -146,7 +200,7 @@ func (s *webServer) handlerPageAddMovie(w http.ResponseWriter, r *http.Request)
 		file, fileHeader, _ := r.FormFile("PosterFile")
 
 		// if err is not nil, fields is not nil
-		movieId, fields := s.backend.AddMovie(input, user, file, fileHeader)
+		movieId, fields := backend.AddMovie(input, user, file, fileHeader)
 		hasError := false
 		for _, field := range fields {
 			if field.Error != nil {
@@ -159,9 +213,12 @@ func (s *webServer) handlerPageAddMovie(w http.ResponseWriter, r *http.Request)
 			return
 		} else {
 			data.Fields = fields
+			if dup, ok := fields["Duplicates"]; ok && dup.Error != nil {
+				errors.As(dup.Error, &data.Duplicates)
+			}
 		}
 	}
 	if err := s.executeTemplate(w, "addmovie", data); err != nil {
-		s.l.Error("Error rendering template: %v", err)
+		log.Error("Error rendering template: %v", err)
 	}
 }
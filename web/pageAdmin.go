@@ -1,13 +1,17 @@
 package web
 
 import (
+	"encoding/csv"
 	"fmt"
+	"io"
 	"net/http"
-	"path/filepath"
+	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/zorchenhimer/MoviePolls/logger"
 	"github.com/zorchenhimer/MoviePolls/logic"
 	"github.com/zorchenhimer/MoviePolls/models"
 )
@@ -41,7 +45,7 @@ func (s *webServer) handlerAdminHome(w http.ResponseWriter, r *http.Request) {
 
 func (s *webServer) handlerAdminUsers(w http.ResponseWriter, r *http.Request) {
 	user := s.getSessionUser(w, r)
-	if !s.backend.CheckAdminRights(user) {
+	if !s.backend.HasCapability(user, models.CAP_MANAGE_USERS) {
 		if s.debug {
 			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
 		}
@@ -74,7 +78,7 @@ func (s *webServer) handlerAdminUsers(w http.ResponseWriter, r *http.Request) {
 
 func (s *webServer) handlerAdminUserEdit(w http.ResponseWriter, r *http.Request) {
 	user := s.getSessionUser(w, r)
-	if !s.backend.CheckAdminRights(user) {
+	if !s.backend.HasCapability(user, models.CAP_MANAGE_USERS) {
 		if s.debug {
 			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
 		}
@@ -92,6 +96,7 @@ func (s *webServer) handlerAdminUserEdit(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	admin := user
 	user, err = s.backend.GetUser(uid)
 	if err != nil {
 		s.doError(
@@ -102,6 +107,29 @@ func (s *webServer) handlerAdminUserEdit(w http.ResponseWriter, r *http.Request)
 	}
 
 	action := r.URL.Query().Get("action")
+
+	// Only admins can do anything to other moderators and admins.
+	if user.IsMod() && !admin.IsAdmin() && (action != "" || r.Method == http.MethodPost) {
+		s.doError(
+			http.StatusForbidden,
+			fmt.Sprintf("You are not allowed to manage a %s", user.Privilege),
+			w, r)
+		return
+	}
+
+	roleError := []string{}
+	if r.Method == http.MethodPost && r.PostFormValue("Form") == "Role" {
+		role, err := strconv.Atoi(r.PostFormValue("Role"))
+		if err == nil {
+			err = s.backend.AdminSetUserRole(admin, user, models.PrivilegeLevel(role))
+		}
+
+		if err != nil {
+			s.l.Error("Unable to change role of user %d: %v", user.Id, err)
+			roleError = append(roleError, err.Error())
+		}
+	}
+
 	var urlKey *models.UrlKey
 	switch action {
 	//case "edit":
@@ -112,7 +140,7 @@ func (s *webServer) handlerAdminUserEdit(w http.ResponseWriter, r *http.Request)
 		if confirm == "yes" {
 
 			origName := user.Name
-			err = s.backend.AdminDeleteUser(user)
+			err = s.backend.AdminDeleteUser(admin, user)
 			if err != nil {
 				s.doError(
 					http.StatusBadRequest,
@@ -178,7 +206,7 @@ func (s *webServer) handlerAdminUserEdit(w http.ResponseWriter, r *http.Request)
 		confirm := r.URL.Query().Get("confirm")
 		if confirm == "yes" {
 			origName := user.Name
-			err := s.backend.AdminPurgeUser(user)
+			err := s.backend.AdminPurgeUser(admin, user)
 			if err != nil {
 				s.doError(
 					http.StatusBadRequest,
@@ -229,7 +257,7 @@ func (s *webServer) handlerAdminUserEdit(w http.ResponseWriter, r *http.Request)
 
 		return
 	case "password":
-		urlKey, err = s.backend.NewPasswordResetKey(user.Id)
+		urlKey, err = s.backend.NewPasswordResetKey(admin, user)
 		if err != nil {
 			s.l.Error("Unable to generate UrlKey pair for user password reset: %v", err)
 			s.doError(
@@ -272,8 +300,12 @@ func (s *webServer) handlerAdminUserEdit(w http.ResponseWriter, r *http.Request)
 
 		PassError   []string
 		NotifyError []string
+		RoleError   []string
 		UrlKey      *models.UrlKey
 		Host        string
+
+		Roles         []models.PrivilegeLevel
+		CanChangeRole bool
 	}{
 		dataPageBase: s.newPageBase("Admin - User Edit", w, r),
 
@@ -281,8 +313,12 @@ func (s *webServer) handlerAdminUserEdit(w http.ResponseWriter, r *http.Request)
 		CurrentVotes: activeVotes,
 		//PastVotes:      watchedVotes,
 		AvailableVotes: totalVotes - len(activeVotes),
+		RoleError:      roleError,
 		UrlKey:         urlKey,
 		Host:           host,
+
+		Roles:         models.Roles,
+		CanChangeRole: admin.IsAdmin() && admin.Id != user.Id,
 	}
 
 	// TODO: handle post requests
@@ -292,9 +328,26 @@ func (s *webServer) handlerAdminUserEdit(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// configItem is a setting on the config page with its current value.  If a
+// submitted value was rejected, Value is what was submitted instead.
+type configItem struct {
+	*logic.ConfigSetting
+	Value interface{}
+	Error string
+
+	// Where the value comes from if it's set by the config file or the
+	// environment and can't be changed here.
+	Locked string
+}
+
+type configSection struct {
+	Name  string
+	Items []*configItem
+}
+
 func (s *webServer) handlerAdminConfig(w http.ResponseWriter, r *http.Request) {
 	user := s.getSessionUser(w, r)
-	if !s.backend.CheckAdminRights(user) {
+	if !s.backend.HasCapability(user, models.CAP_EDIT_CONFIG) {
 		if s.debug {
 			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
 		}
@@ -306,8 +359,7 @@ func (s *webServer) handlerAdminConfig(w http.ResponseWriter, r *http.Request) {
 		dataPageBase
 
 		ErrorMessage []string
-		Values       map[string]logic.ConfigValue
-		Sections     []string
+		Sections     []*configSection
 
 		TypeString     logic.ConfigValueType
 		TypeStringPriv logic.ConfigValueType
@@ -315,8 +367,7 @@ func (s *webServer) handlerAdminConfig(w http.ResponseWriter, r *http.Request) {
 		TypeInt        logic.ConfigValueType
 	}{
 		ErrorMessage: []string{},
-		Values:       logic.ConfigValues,
-		Sections:     logic.ConfigSections,
+		Sections:     []*configSection{},
 
 		TypeString:     logic.ConfigString,
 		TypeStringPriv: logic.ConfigStringPriv,
@@ -324,6 +375,13 @@ func (s *webServer) handlerAdminConfig(w http.ResponseWriter, r *http.Request) {
 		TypeInt:        logic.ConfigInt,
 	}
 
+	settings := s.backend.GetConfigSettings()
+	locks := s.backend.GetConfigLocks()
+
+	// Submitted values that didn't validate, and why
+	rejected := map[string]string{}
+	fieldErrors := map[string]string{}
+
 	var err error
 
 	if r.Method == http.MethodPost {
@@ -336,51 +394,31 @@ func (s *webServer) handlerAdminConfig(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		for key, val := range data.Values {
-			str := r.PostFormValue(key)
-			switch val.Type {
-			case logic.ConfigString, logic.ConfigStringPriv:
-				err = s.backend.SetCfgString(key, str)
-				if err != nil {
-					data.ErrorMessage = append(
-						data.ErrorMessage,
-						fmt.Sprintf("Unable to save string value for %s: %v", key, err))
-				}
+		before := s.backend.GetConfigSnapshot()
 
-			case logic.ConfigInt:
-				intVal, err := strconv.ParseInt(str, 10, 32)
-				if err != nil {
-					data.ErrorMessage = append(
-						data.ErrorMessage,
-						fmt.Sprintf("Value for %q is invalid: %v", key, err))
-				} else {
-					err = s.backend.SetCfgInt(key, int(intVal))
-					if err != nil {
-						data.ErrorMessage = append(
-							data.ErrorMessage,
-							fmt.Sprintf("Unable to save int value for %s: %v", key, err))
-					}
-				}
+		for _, setting := range settings {
+			// Locked inputs are disabled and not submitted
+			if _, locked := locks[setting.Key]; locked {
+				continue
+			}
 
-			case logic.ConfigBool:
-				boolVal := false
-				if str != "" {
-					boolVal = true
-				}
-				err = s.backend.SetCfgBool(key, boolVal)
-				if err != nil {
-					data.ErrorMessage = append(
-						data.ErrorMessage,
-						fmt.Sprintf("Unable to save bool value for %s: %v", key, err))
-				}
+			str := r.PostFormValue(setting.Key)
+			if setting.Type == logic.ConfigBool {
+				str = strconv.FormatBool(str != "")
+			}
 
-			default:
-				data.ErrorMessage = append(
-					data.ErrorMessage,
-					fmt.Sprintf("Unknown config value type for %s: %v", key, val.Type))
+			if err = s.backend.SetConfigValue(setting.Key, str); err != nil {
+				rejected[setting.Key] = str
+				fieldErrors[setting.Key] = err.Error()
 			}
 		}
 
+		s.backend.AuditConfigChange(user, before)
+
+		if len(fieldErrors) > 0 {
+			data.ErrorMessage = append(data.ErrorMessage, "Some values were not saved, see below.")
+		}
+
 		// Don't enable this stuff for now
 		//if clearPassSalt := r.PostFormValue("ClearPassSalt"); clearPassSalt != "" {
 		//	s.data.DeleteCfgKey("PassSalt")
@@ -392,30 +430,36 @@ func (s *webServer) handlerAdminConfig(w http.ResponseWriter, r *http.Request) {
 		//}
 	}
 
-	newValues := map[string]logic.ConfigValue{}
-	for key, val := range data.Values {
-		var v interface{}
-
-		switch val.Type {
-		case logic.ConfigString, logic.ConfigStringPriv:
-			v, err = s.backend.GetCfgString(key, val.Default.(string))
-		case logic.ConfigBool:
-			v, err = s.backend.GetCfgBool(key, val.Default.(bool))
-		case logic.ConfigInt:
-			v, err = s.backend.GetCfgInt(key, val.Default.(int))
-		}
+	sections := map[string]*configSection{}
+	for _, name := range s.backend.GetConfigSections() {
+		sections[name] = &configSection{Name: name, Items: []*configItem{}}
+		data.Sections = append(data.Sections, sections[name])
+	}
 
+	values := map[string]interface{}{}
+	for _, setting := range settings {
+		val, err := s.backend.GetConfigValue(setting.Key)
 		if err != nil {
 			data.ErrorMessage = append(
 				data.ErrorMessage,
-				fmt.Sprintf("Unable to get config value for %s: %v", key, err))
-		} else {
-			val.Value = v
+				fmt.Sprintf("Unable to get config value for %s: %v", setting.Key, err))
+			val = setting.Default
+		}
+		values[setting.Key] = val
+
+		item := &configItem{ConfigSetting: setting, Value: val, Locked: locks[setting.Key]}
+		if msg, ok := fieldErrors[setting.Key]; ok {
+			item.Value = rejected[setting.Key]
+			item.Error = msg
+		} else if err := setting.Validate(val); err != nil {
+			// Stored before the setting had validation
+			item.Error = err.Error()
 		}
 
-		newValues[key] = val
+		if section, ok := sections[setting.Section]; ok {
+			section.Items = append(section.Items, item)
+		}
 	}
-	data.Values = newValues
 
 	// Set this down here so the Notice Banner is updated
 	data.dataPageBase = s.newPageBase("Admin - Config", w, r)
@@ -428,32 +472,19 @@ func (s *webServer) handlerAdminConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// getting ALL the booleans
-	var localSignup, twitchSignup, patreonSignup, discordSignup, twitchOauth, patreonOauth, discordOauth bool
-
-	for key, val := range data.Values {
-		bval, ok := val.Value.(bool)
-		if !ok && val.Type == logic.ConfigBool {
-			data.ErrorMessage = append(data.ErrorMessage, "Could not parse field %s as boolean", key)
-			break
-		}
-		switch key {
-		case logic.ConfigLocalSignupEnabled:
-			localSignup = bval
-		case logic.ConfigTwitchOauthSignupEnabled:
-			twitchSignup = bval
-		case logic.ConfigTwitchOauthEnabled:
-			twitchOauth = bval
-		case logic.ConfigDiscordOauthSignupEnabled:
-			discordSignup = bval
-		case logic.ConfigDiscordOauthEnabled:
-			discordOauth = bval
-		case logic.ConfigPatreonOauthSignupEnabled:
-			patreonSignup = bval
-		case logic.ConfigPatreonOauthEnabled:
-			patreonOauth = bval
-		}
+	enabled := func(key string) bool {
+		val, _ := values[key].(bool)
+		return val
 	}
 
+	localSignup := enabled(logic.ConfigLocalSignupEnabled)
+	twitchSignup := enabled(logic.ConfigTwitchOauthSignupEnabled)
+	twitchOauth := enabled(logic.ConfigTwitchOauthEnabled)
+	discordSignup := enabled(logic.ConfigDiscordOauthSignupEnabled)
+	discordOauth := enabled(logic.ConfigDiscordOauthEnabled)
+	patreonSignup := enabled(logic.ConfigPatreonOauthSignupEnabled)
+	patreonOauth := enabled(logic.ConfigPatreonOauthEnabled)
+
 	// Check that we have atleast ONE signup method enabled
 	if !(localSignup || twitchSignup || discordSignup || patreonSignup) {
 		data.ErrorMessage = append(data.ErrorMessage, "No Signup method is currently enabled, please ensure to enable atleast one method")
@@ -498,9 +529,181 @@ func (s *webServer) handlerAdminConfig(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *webServer) handlerAdminConfigExport(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_EDIT_CONFIG) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	raw, err := s.backend.ExportConfig()
+	if err != nil {
+		s.l.Error("Unable to export config: %v", err)
+		s.doError(
+			http.StatusInternalServerError,
+			"Something went wrong :C",
+			w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"moviepolls-config.json\"")
+	w.Write(raw)
+}
+
+func (s *webServer) handlerAdminConfigImport(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_EDIT_CONFIG) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	data := struct {
+		dataPageBase
+
+		ErrorMessage []string
+		Config       string
+		Changes      []*logic.ConfigImportChange
+		Preview      bool
+		CanApply     bool
+	}{
+		ErrorMessage: []string{},
+	}
+
+	if r.Method == http.MethodPost {
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			s.l.Error("Unable to parse form: %v", err)
+			s.doError(
+				http.StatusInternalServerError,
+				fmt.Sprintf("Unable to parse form: %v", err),
+				w, r)
+			return
+		}
+
+		data.Config = r.PostFormValue("Config")
+
+		// An uploaded file wins over the text box
+		file, _, err := r.FormFile("ConfigFile")
+		if err == nil {
+			raw, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				data.ErrorMessage = append(data.ErrorMessage, fmt.Sprintf("Unable to read file: %v", err))
+			} else {
+				data.Config = string(raw)
+			}
+		}
+
+		if strings.TrimSpace(data.Config) == "" {
+			data.ErrorMessage = append(data.ErrorMessage, "Upload an exported config or paste it below.")
+		} else if r.PostFormValue("Apply") != "" {
+			data.Changes, err = s.backend.ImportConfig(user, []byte(data.Config))
+			if err == nil {
+				// Enabled providers might have changed
+				if err = s.initOauth(); err != nil {
+					s.l.Error("Unable to reload OAuth: %v", err)
+				}
+
+				http.Redirect(w, r, "/admin/config/history", http.StatusSeeOther)
+				return
+			}
+
+			data.ErrorMessage = append(data.ErrorMessage, fmt.Sprintf("Nothing was imported: %v", err))
+		} else {
+			data.Changes, err = s.backend.PreviewConfigImport([]byte(data.Config))
+			if err != nil {
+				data.ErrorMessage = append(data.ErrorMessage, err.Error())
+			}
+		}
+
+		if data.Changes != nil {
+			data.Preview = true
+			data.CanApply = true
+			for _, change := range data.Changes {
+				if change.Error != "" {
+					data.CanApply = false
+				}
+			}
+		}
+	}
+
+	data.dataPageBase = s.newPageBase("Admin - Import Config", w, r)
+
+	if err := s.executeTemplate(w, "adminConfigImport", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
+func (s *webServer) handlerAdminConfigHistory(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_EDIT_CONFIG) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	errorMessage := []string{}
+
+	if r.Method == http.MethodPost {
+		key := r.PostFormValue("Field")
+		entryId, err := strconv.Atoi(r.PostFormValue("Entry"))
+		if err != nil {
+			errorMessage = append(errorMessage, "Invalid audit entry")
+		} else if err = s.backend.RevertConfigChange(user, entryId, key); err != nil {
+			s.l.Info("Unable to revert change to %s from audit entry %d: %v", key, entryId, err)
+			errorMessage = append(errorMessage, fmt.Sprintf("Unable to revert: %v", err))
+		} else {
+			if err = s.initOauth(); err != nil {
+				s.l.Error("Unable to reload OAuth: %v", err)
+			}
+
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+	}
+
+	history, err := s.backend.GetConfigHistory()
+	if err != nil {
+		s.l.Error("Unable to get config history: %v", err)
+		s.doError(
+			http.StatusInternalServerError,
+			"Something went wrong :C",
+			w, r)
+		return
+	}
+
+	data := struct {
+		dataPageBase
+		History      []*logic.ConfigHistoryChange
+		ErrorMessage []string
+	}{
+		dataPageBase: s.newPageBase("Admin - Config History", w, r),
+		History:      history,
+		ErrorMessage: errorMessage,
+	}
+
+	if err := s.executeTemplate(w, "adminConfigHistory", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
 func (s *webServer) handlerAdminMovieEdit(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/history") {
+		s.handlerAdminMovieHistory(w, r)
+		return
+	}
+
 	user := s.getSessionUser(w, r)
-	if !s.backend.CheckAdminRights(user) {
+	if !s.backend.HasCapability(user, models.CAP_EDIT_MOVIES) {
 		if s.debug {
 			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
 		}
@@ -519,12 +722,29 @@ func (s *webServer) handlerAdminMovieEdit(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Set when the "refresh now" button was used
+	var refreshChanges []models.AuditChange
+	var refreshErr error
+	refreshed := false
+
 	// TODO: Approve and Deny actions
 	action := r.URL.Query().Get("action")
 	switch action {
+	case "refresh":
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, fmt.Sprintf("/admin/movie/%d", mid), http.StatusSeeOther)
+			return
+		}
+
+		refreshChanges, refreshErr = s.backend.RefreshMovieMetadata(user, mid)
+		if refreshErr != nil {
+			s.l.Info("Unable to refresh movie with ID %d: %v", mid, refreshErr)
+		}
+		refreshed = true
+
 	case "remove":
 		// TODO: Confirmation before removing
-		err = s.backend.DeleteMovie(mid)
+		err = s.backend.DeleteMovie(user, mid)
 		if err != nil {
 			s.l.Error("Unable to remove movie with ID %d: %v", mid, err)
 			s.doError(
@@ -538,7 +758,7 @@ func (s *webServer) handlerAdminMovieEdit(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if r.Method == http.MethodPost {
+	if r.Method == http.MethodPost && !refreshed {
 		err = r.ParseMultipartForm(4095)
 		if err != nil {
 			s.l.Error("Unable to parse form: %v", err)
@@ -549,6 +769,17 @@ func (s *webServer) handlerAdminMovieEdit(w http.ResponseWriter, r *http.Request
 			return
 		}
 
+		// Edit before approve from the queue.  Nothing is saved if the
+		// approval isn't allowed.
+		approve := r.PostFormValue("Approve") != ""
+		if approve && !s.backend.HasCapability(user, models.CAP_APPROVE_MOVIES) {
+			s.doError(
+				http.StatusForbidden,
+				"You are not allowed to approve movies",
+				w, r)
+			return
+		}
+
 		movie := s.backend.GetMovie(mid)
 
 		movie.Name = r.PostFormValue("MovieName")
@@ -583,24 +814,35 @@ func (s *webServer) handlerAdminMovieEdit(w http.ResponseWriter, r *http.Request
 		}
 		movie.Links = linkstructs
 
-		posterFileName := strings.TrimSpace(r.FormValue("MovieName"))
 		file, header, _ := r.FormFile("PosterFile")
 
 		if header != nil && file != nil {
-			file, err := s.backend.UploadFile(file, header, posterFileName)
+			path, err := s.backend.UploadFile(file, header)
 
 			if err != nil {
 				//data.ErrPoster = true
 				//errText = append(errText, err.Error())
 				s.l.Error("Unable to upload file: %v", err)
 			} else {
-				movie.Poster = filepath.Base(file)
+				movie.Poster = path
 			}
 		}
 
-		err = s.backend.UpdateMovie(movie)
+		err = s.backend.AdminUpdateMovie(user, movie)
 		if err != nil {
 			s.l.Error("Unable to update movie: %v", err)
+		} else if approve {
+			err = s.backend.ApproveMovie(user, mid)
+			if err != nil {
+				s.doError(
+					http.StatusBadRequest,
+					fmt.Sprintf("Unable to approve movie with ID %d: %v", mid, err),
+					w, r)
+				return
+			}
+
+			http.Redirect(w, r, "/admin/queue", http.StatusSeeOther)
+			return
 		}
 	}
 
@@ -615,10 +857,18 @@ func (s *webServer) handlerAdminMovieEdit(w http.ResponseWriter, r *http.Request
 		dataPageBase
 		Movie    *models.Movie
 		LinkText string
+
+		Refreshed      bool
+		RefreshChanges []models.AuditChange
+		RefreshError   error
 	}{
 		dataPageBase: s.newPageBase("Admin - Movies", w, r),
 		Movie:        movie,
 		LinkText:     linktext,
+
+		Refreshed:      refreshed,
+		RefreshChanges: refreshChanges,
+		RefreshError:   refreshErr,
 	}
 
 	if err := s.executeTemplate(w, "adminMovieEdit", data); err != nil {
@@ -626,9 +876,77 @@ func (s *webServer) handlerAdminMovieEdit(w http.ResponseWriter, r *http.Request
 	}
 }
 
+func (s *webServer) handlerAdminMovieHistory(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_EDIT_MOVIES) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	var mid int
+	_, err := fmt.Sscanf(r.URL.Path, "/admin/movie/%d/history", &mid)
+	if err != nil {
+		s.doError(
+			http.StatusBadRequest,
+			fmt.Sprintf("Unable to parse movie ID: %v", err),
+			w, r)
+		return
+	}
+
+	movie := s.backend.GetMovie(mid)
+	if movie == nil {
+		s.doError(http.StatusNotFound, fmt.Sprintf("Movie with ID %d not found", mid), w, r)
+		return
+	}
+
+	errorMessage := []string{}
+
+	if r.Method == http.MethodPost {
+		revisionId, err := strconv.Atoi(r.PostFormValue("Revert"))
+		if err != nil {
+			errorMessage = append(errorMessage, "Invalid revision")
+		} else if err = s.backend.RevertMovie(user, mid, revisionId); err != nil {
+			s.l.Info("Unable to revert movie %d to revision %d: %v", mid, revisionId, err)
+			errorMessage = append(errorMessage, fmt.Sprintf("Unable to revert: %v", err))
+		} else {
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+	}
+
+	history, err := s.backend.GetMovieHistory(mid)
+	if err != nil {
+		s.l.Error("Unable to get history of movie %d: %v", mid, err)
+		s.doError(
+			http.StatusInternalServerError,
+			"Something went wrong :C",
+			w, r)
+		return
+	}
+
+	data := struct {
+		dataPageBase
+		Movie        *models.Movie
+		History      []*logic.MovieRevisionDiff
+		ErrorMessage []string
+	}{
+		dataPageBase: s.newPageBase("Admin - Movie History", w, r),
+		Movie:        movie,
+		History:      history,
+		ErrorMessage: errorMessage,
+	}
+
+	if err := s.executeTemplate(w, "adminMovieHistory", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
 func (s *webServer) handlerAdminMovies(w http.ResponseWriter, r *http.Request) {
 	user := s.getSessionUser(w, r)
-	if !s.backend.CheckAdminRights(user) {
+	if !s.backend.HasCapability(user, models.CAP_EDIT_MOVIES) {
 		if s.debug {
 			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
 		}
@@ -654,6 +972,15 @@ func (s *webServer) handlerAdminMovies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pending, err := s.backend.GetPendingMovies()
+	if err != nil {
+		s.doError(
+			http.StatusInternalServerError,
+			fmt.Sprintf("Unable to get pending movies: %v", err),
+			w, r)
+		return
+	}
+
 	data := struct {
 		dataPageBase
 		Active  []*models.Movie
@@ -664,7 +991,7 @@ func (s *webServer) handlerAdminMovies(w http.ResponseWriter, r *http.Request) {
 	}{
 		dataPageBase: s.newPageBase("Admin - Movies", w, r),
 		Active:       models.SortMoviesByName(active),
-		//Pending:      common.SortMoviesByName(active),
+		Pending:      models.SortMoviesByName(pending),
 
 		RequireApproval: approval,
 	}
@@ -674,9 +1001,9 @@ func (s *webServer) handlerAdminMovies(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *webServer) handlerAdminCycles_Post(w http.ResponseWriter, r *http.Request) {
+func (s *webServer) handlerAdminRoles(w http.ResponseWriter, r *http.Request) {
 	user := s.getSessionUser(w, r)
-	if !s.backend.CheckAdminRights(user) {
+	if user == nil || !user.IsAdmin() {
 		if s.debug {
 			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
 		}
@@ -684,19 +1011,573 @@ func (s *webServer) handlerAdminCycles_Post(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if r.Method != http.MethodPost {
-		http.Redirect(w, r, "/admin/cycles", http.StatusSeeOther)
-		return
-	}
+	errorMessage := []string{}
 
-	s.l.Debug("Cycle post")
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			s.l.Error("Unable to parse form: %v", err)
+			s.doError(
+				http.StatusInternalServerError,
+				fmt.Sprintf("Unable to parse form: %v", err),
+				w, r)
+			return
+		}
 
-	err := r.ParseForm()
-	if err != nil {
-		s.l.Error("Unable to parse form: %v", err)
-		s.doError(http.StatusInternalServerError, fmt.Sprintf("Unable to parse form: %v", err), w, r)
-		return
-	}
+		// Checkboxes are named "<role>-<capability>"
+		for _, role := range models.Roles {
+			if role == models.PRIV_ADMIN {
+				continue
+			}
+
+			caps := []models.Capability{}
+			for _, c := range models.Capabilities {
+				if r.PostFormValue(fmt.Sprintf("%d-%s", role, c)) != "" {
+					caps = append(caps, c)
+				}
+			}
+
+			err = s.backend.SetRoleCapabilities(user, role, caps)
+			if err != nil {
+				s.l.Error("Unable to set capabilities of role %s: %v", role, err)
+				errorMessage = append(errorMessage, err.Error())
+			}
+		}
+	}
+
+	type roleCaps struct {
+		Role     models.PrivilegeLevel
+		Editable bool
+		Has      map[models.Capability]bool
+	}
+
+	roles := []roleCaps{}
+	for _, role := range models.Roles {
+		caps, err := s.backend.GetRoleCapabilities(role)
+		if err != nil {
+			s.doError(
+				http.StatusInternalServerError,
+				fmt.Sprintf("Unable to get capabilities of role %s: %v", role, err),
+				w, r)
+			return
+		}
+
+		rc := roleCaps{
+			Role:     role,
+			Editable: role != models.PRIV_ADMIN,
+			Has:      map[models.Capability]bool{},
+		}
+		for _, c := range caps {
+			rc.Has[c] = true
+		}
+		roles = append(roles, rc)
+	}
+
+	data := struct {
+		dataPageBase
+
+		ErrorMessage    []string
+		AllCapabilities []models.Capability
+		Roles           []roleCaps
+	}{
+		dataPageBase: s.newPageBase("Admin - Roles", w, r),
+
+		ErrorMessage:    errorMessage,
+		AllCapabilities: models.Capabilities,
+		Roles:           roles,
+	}
+
+	if err := s.executeTemplate(w, "adminRoles", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
+func (s *webServer) handlerAdminPosters(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_EDIT_CONFIG) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	errorMessage := []string{}
+	var deleted *logic.PosterSweep
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			s.doError(
+				http.StatusBadRequest,
+				fmt.Sprintf("Unable to parse form: %v", err),
+				w, r)
+			return
+		}
+
+		paths := r.PostForm["Path"]
+		if r.PostFormValue("Confirm") == "" {
+			errorMessage = append(errorMessage, "Check the confirmation box to delete the selected posters")
+		} else if len(paths) == 0 {
+			errorMessage = append(errorMessage, "No posters selected")
+		} else {
+			var err error
+			deleted, err = s.backend.DeleteOrphanedPosters(user, paths)
+			if err != nil {
+				s.l.Error("Unable to delete orphaned posters: %v", err)
+				errorMessage = append(errorMessage, fmt.Sprintf("Unable to delete orphaned posters: %v", err))
+			}
+		}
+	}
+
+	sweep, err := s.backend.FindOrphanedPosters()
+	if err != nil {
+		s.doError(
+			http.StatusInternalServerError,
+			fmt.Sprintf("Unable to look for orphaned posters: %v", err),
+			w, r)
+		return
+	}
+
+	data := struct {
+		dataPageBase
+
+		ErrorMessage []string
+		Sweep        *logic.PosterSweep
+		Deleted      *logic.PosterSweep
+		LastSweep    *logic.PosterSweep
+	}{
+		dataPageBase: s.newPageBase("Admin - Posters", w, r),
+
+		ErrorMessage: errorMessage,
+		Sweep:        sweep,
+		Deleted:      deleted,
+		LastSweep:    s.backend.GetLastPosterSweep(),
+	}
+
+	if err := s.executeTemplate(w, "adminPosters", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
+func (s *webServer) handlerAdminTags(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_EDIT_MOVIES) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	errorMessage := []string{}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			s.doError(
+				http.StatusBadRequest,
+				fmt.Sprintf("Unable to parse form: %v", err),
+				w, r)
+			return
+		}
+
+		tagId, err := strconv.Atoi(r.PostFormValue("Tag"))
+		if err != nil {
+			errorMessage = append(errorMessage, "Invalid tag")
+		} else {
+			switch r.PostFormValue("Action") {
+			case "rename":
+				err = s.backend.RenameTag(user, tagId, r.PostFormValue("Name"))
+			case "alias":
+				err = s.backend.AddTagAlias(user, tagId, r.PostFormValue("Alias"))
+			case "unalias":
+				err = s.backend.RemoveTagAlias(user, tagId, r.PostFormValue("Alias"))
+			case "merge":
+				var intoId int
+				intoId, err = strconv.Atoi(r.PostFormValue("Into"))
+				if err != nil {
+					err = fmt.Errorf("Select a tag to merge into")
+				} else {
+					err = s.backend.MergeTags(user, tagId, intoId)
+				}
+			default:
+				err = fmt.Errorf("Unknown action %q", r.PostFormValue("Action"))
+			}
+
+			if err != nil {
+				errorMessage = append(errorMessage, err.Error())
+			} else {
+				http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+				return
+			}
+		}
+	}
+
+	tags, err := s.backend.GetTagCounts(false)
+	if err != nil {
+		s.doError(
+			http.StatusInternalServerError,
+			fmt.Sprintf("Unable to get tags: %v", err),
+			w, r)
+		return
+	}
+
+	data := struct {
+		dataPageBase
+
+		ErrorMessage []string
+		Tags         []*logic.TagCount
+	}{
+		dataPageBase: s.newPageBase("Admin - Tags", w, r),
+
+		ErrorMessage: errorMessage,
+		Tags:         tags,
+	}
+
+	if err := s.executeTemplate(w, "adminTags", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
+// csvCell keeps a spreadsheet from reading a user supplied value, eg a movie
+// name, as a formula.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (s *webServer) handlerAdminAudit(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_VIEW_AUDIT_LOG) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		Actor:  strings.TrimSpace(query.Get("actor")),
+		Action: models.AuditAction(query.Get("action")),
+		Target: strings.TrimSpace(query.Get("target")),
+	}
+
+	errorMessage := []string{}
+
+	if since := query.Get("since"); since != "" {
+		t, err := time.ParseInLocation("2006-01-02", since, time.Local)
+		if err != nil {
+			errorMessage = append(errorMessage, fmt.Sprintf("Invalid start date %q", since))
+		} else {
+			filter.Since = &t
+		}
+	}
+
+	if until := query.Get("until"); until != "" {
+		t, err := time.ParseInLocation("2006-01-02", until, time.Local)
+		if err != nil {
+			errorMessage = append(errorMessage, fmt.Sprintf("Invalid end date %q", until))
+		} else {
+			// Include the whole day
+			t = t.AddDate(0, 0, 1)
+			filter.Until = &t
+		}
+	}
+
+	entries, err := s.backend.GetAuditEntries(filter)
+	if err != nil {
+		s.doError(
+			http.StatusInternalServerError,
+			fmt.Sprintf("Unable to get audit log: %v", err),
+			w, r)
+		return
+	}
+
+	if query.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"audit.csv\"")
+
+		out := csv.NewWriter(w)
+		out.Write([]string{"Id", "Timestamp", "ActorId", "Actor", "Action", "Target", "Field", "Before", "After"})
+		for _, e := range entries {
+			row := []string{
+				strconv.Itoa(e.Id),
+				e.Timestamp.Format(time.RFC3339),
+				strconv.Itoa(e.ActorId),
+				csvCell(e.ActorName),
+				string(e.Action),
+				csvCell(e.Target),
+			}
+
+			// One row per changed field
+			if len(e.Changes) == 0 {
+				out.Write(append(row, "", "", ""))
+			}
+			for _, c := range e.Changes {
+				out.Write(append(row, csvCell(c.Field), csvCell(c.Before), csvCell(c.After)))
+			}
+		}
+
+		out.Flush()
+		if err := out.Error(); err != nil {
+			s.l.Error("Unable to write audit CSV: %v", err)
+		}
+		return
+	}
+
+	csvQuery := query
+	csvQuery.Set("format", "csv")
+
+	data := struct {
+		dataPageBase
+
+		ErrorMessage []string
+		Entries      []*models.AuditEntry
+		Actions      []models.AuditAction
+		Filter       url.Values
+		CsvLink      string
+	}{
+		dataPageBase: s.newPageBase("Admin - Audit Log", w, r),
+
+		ErrorMessage: errorMessage,
+		Entries:      entries,
+		Actions:      models.AuditActions,
+		Filter:       r.URL.Query(),
+		CsvLink:      "/admin/audit?" + csvQuery.Encode(),
+	}
+
+	if err := s.executeTemplate(w, "adminAudit", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
+func (s *webServer) handlerAdminLogs(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_EDIT_CONFIG) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	// The default level is stored under an empty package name
+	packages := append([]string{""}, logger.Packages...)
+
+	levels := func() map[string]string {
+		current := map[string]string{}
+		for _, pkg := range packages {
+			if level, set := s.l.Level(pkg); set || pkg == "" {
+				current[pkg] = string(level)
+			}
+		}
+		return current
+	}
+
+	errorMessage := []string{}
+
+	if r.Method == http.MethodPost {
+		before := levels()
+
+		for _, pkg := range packages {
+			level := logger.LogLevel(r.PostFormValue("Level-" + pkg))
+			if err := s.l.SetLevel(pkg, level); err != nil {
+				errorMessage = append(errorMessage, err.Error())
+			}
+		}
+
+		after := levels()
+
+		if !reflect.DeepEqual(before, after) {
+			// Audit with readable names
+			for _, levels := range []map[string]string{before, after} {
+				levels["default"] = levels[""]
+				delete(levels, "")
+			}
+			s.backend.Audit(user, models.AUDIT_LOG_LEVEL, "logging", before, after)
+		}
+
+		if len(errorMessage) == 0 {
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+	}
+
+	type logPackage struct {
+		Name  string
+		Level logger.LogLevel
+		Set   bool
+	}
+
+	data := struct {
+		dataPageBase
+		ErrorMessage []string
+		Default      logger.LogLevel
+		Packages     []logPackage
+		Levels       []logger.LogLevel
+		LogFile      string
+	}{
+		dataPageBase: s.newPageBase("Admin - Logging", w, r),
+		ErrorMessage: errorMessage,
+		Levels:       logger.LogLevels,
+		LogFile:      s.l.LogFile(),
+	}
+
+	data.Default, _ = s.l.Level("")
+	for _, pkg := range logger.Packages {
+		level, set := s.l.Level(pkg)
+		data.Packages = append(data.Packages, logPackage{Name: pkg, Level: level, Set: set})
+	}
+
+	if err := s.executeTemplate(w, "adminLogs", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
+// handlerAdminThrottled lists the clients that are over a rate limit or
+// locked out after failed logins, and lets them in again.
+func (s *webServer) handlerAdminThrottled(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_MANAGE_USERS) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	errorMessage := []string{}
+
+	if r.Method == http.MethodPost {
+		client := s.backend.ClearThrottle(r.PostFormValue("Key"))
+		if client == nil {
+			errorMessage = append(errorMessage, "That client isn't throttled anymore")
+		} else {
+			s.backend.Audit(user, models.AUDIT_THROTTLE_CLEAR, client.Client,
+				map[string]string{client.Action: fmt.Sprintf("%d refused", client.Refused)},
+				map[string]string{client.Action: "cleared"},
+			)
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+	}
+
+	data := struct {
+		dataPageBase
+		ErrorMessage []string
+		Clients      []*logic.ThrottledClient
+	}{
+		dataPageBase: s.newPageBase("Admin - Throttled", w, r),
+		ErrorMessage: errorMessage,
+		Clients:      s.backend.GetThrottledClients(),
+	}
+
+	if err := s.executeTemplate(w, "adminThrottled", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
+func (s *webServer) handlerAdminQueue(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_APPROVE_MOVIES) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	errorMessage := []string{}
+
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			s.l.Error("Unable to parse form: %v", err)
+			s.doError(
+				http.StatusInternalServerError,
+				fmt.Sprintf("Unable to parse form: %v", err),
+				w, r)
+			return
+		}
+
+		mid, err := strconv.Atoi(r.PostFormValue("MovieId"))
+		if err != nil {
+			s.doError(
+				http.StatusBadRequest,
+				fmt.Sprintf("Unable to parse movie ID: %v", err),
+				w, r)
+			return
+		}
+
+		switch r.PostFormValue("action") {
+		case "approve":
+			err = s.backend.ApproveMovie(user, mid)
+		case "reject":
+			err = s.backend.RejectMovie(user, mid, r.PostFormValue("Reason"))
+		default:
+			err = fmt.Errorf("Unknown action %q", r.PostFormValue("action"))
+		}
+
+		if err != nil {
+			s.l.Error("Unable to update movie with ID %d in queue: %v", mid, err)
+			errorMessage = append(errorMessage, err.Error())
+		} else {
+			http.Redirect(w, r, "/admin/queue", http.StatusSeeOther)
+			return
+		}
+	}
+
+	pending, err := s.backend.GetPendingMovies()
+	if err != nil {
+		s.doError(
+			http.StatusInternalServerError,
+			fmt.Sprintf("Unable to get pending movies: %v", err),
+			w, r)
+		return
+	}
+
+	data := struct {
+		dataPageBase
+
+		ErrorMessage []string
+		Pending      []*models.Movie
+	}{
+		dataPageBase: s.newPageBase("Admin - Approval Queue", w, r),
+
+		ErrorMessage: errorMessage,
+		Pending:      models.SortMoviesByName(pending),
+	}
+
+	if err := s.executeTemplate(w, "adminQueue", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
+func (s *webServer) handlerAdminCycles_Post(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if !s.backend.HasCapability(user, models.CAP_MANAGE_CYCLES) {
+		if s.debug {
+			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
+		}
+		s.doError(http.StatusNotFound, fmt.Sprintf("%q not found", r.URL.Path), w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/cycles", http.StatusSeeOther)
+		return
+	}
+
+	s.l.Debug("Cycle post")
+
+	err := r.ParseForm()
+	if err != nil {
+		s.l.Error("Unable to parse form: %v", err)
+		s.doError(http.StatusInternalServerError, fmt.Sprintf("Unable to parse form: %v", err), w, r)
+		return
+	}
 
 	var plannedEnd *time.Time
 	action := r.PostFormValue("actionType")
@@ -762,7 +1643,7 @@ func (s *webServer) handlerAdminCycles_Post(w http.ResponseWriter, r *http.Reque
 
 func (s *webServer) handlerAdminCycles(w http.ResponseWriter, r *http.Request) {
 	user := s.getSessionUser(w, r)
-	if !s.backend.CheckAdminRights(user) {
+	if !s.backend.HasCapability(user, models.CAP_MANAGE_CYCLES) {
 		if s.debug {
 			s.doError(http.StatusUnauthorized, "You are not an admin.", w, r)
 		}
@@ -982,6 +1863,19 @@ func (s *webServer) cycleStage2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	names := []string{}
+	for _, movie := range movies {
+		names = append(names, movie.Name)
+	}
+
+	s.backend.Audit(s.getSessionUser(w, r), models.AUDIT_CYCLE_END,
+		fmt.Sprintf("cycle %d", cycle.Id),
+		nil,
+		map[string]string{
+			"Ended":   watched.Format("2006-01-02"),
+			"Watched": strings.Join(names, ", "),
+		})
+
 	// Clear status
 	//err = s.data.SetCfgString("CycleStage", "")
 	//if err != nil {
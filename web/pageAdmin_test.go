@@ -0,0 +1,205 @@
+package web
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// addTestUser adds a user that can log in with a password.
+func addTestUser(t *testing.T, s *webServer, name string, role models.PrivilegeLevel) *models.User {
+	id, err := s.backend.AddUser(&models.User{Name: name, Privilege: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := s.backend.GetUser(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := &models.AuthMethod{Type: models.AUTH_LOCAL, Password: "x", Date: time.Now()}
+	if user, err = s.backend.AddAuthMethodToUser(auth, user); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.backend.UpdateUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stored date is the one the session is checked against
+	if user, err = s.backend.GetUser(id); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// sessionCookie logs in as the user.
+func sessionCookie(t *testing.T, s *webServer, user *models.User) *http.Cookie {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	if err := s.login(user, models.AUTH_LOCAL, rec, r); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Result().Cookies()[0]
+}
+
+func Test_AdminUserEditModerator(t *testing.T) {
+	s := newTestServer(t)
+
+	users := map[string]*models.User{
+		"admin": addTestUser(t, s, "admin", models.PRIV_ADMIN),
+		"mod":   addTestUser(t, s, "mod", models.PRIV_MOD),
+		"bob":   addTestUser(t, s, "bob", models.PRIV_USER),
+	}
+
+	// Moderators can't manage users by default
+	err := s.backend.SetRoleCapabilities(users["admin"], models.PRIV_MOD, []models.Capability{models.CAP_MANAGE_USERS})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		actor  string
+		target string
+		method string
+		query  string
+		status int
+	}{
+		{"mod resets admin password", "mod", "admin", http.MethodGet, "action=password", http.StatusForbidden},
+		{"mod deletes admin", "mod", "admin", http.MethodGet, "action=delete&confirm=yes", http.StatusForbidden},
+		{"mod changes admin role", "mod", "admin", http.MethodPost, "", http.StatusForbidden},
+		{"mod views admin", "mod", "admin", http.MethodGet, "", http.StatusOK},
+		{"mod resets user password", "mod", "bob", http.MethodGet, "action=password", http.StatusOK},
+		{"admin resets mod password", "admin", "mod", http.MethodGet, "action=password", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := len(s.backend.GetUrlKeys())
+
+			var r *http.Request
+			path := fmt.Sprintf("/admin/user/%d?%s", users[tt.target].Id, tt.query)
+			if tt.method == http.MethodPost {
+				form := url.Values{"Form": {"Role"}, "Role": {fmt.Sprint(int(models.PRIV_USER))}}
+				r = httptest.NewRequest(tt.method, path, strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				r = httptest.NewRequest(tt.method, path, nil)
+			}
+			r.AddCookie(sessionCookie(t, s, users[tt.actor]))
+
+			rec := httptest.NewRecorder()
+			s.handlerAdminUserEdit(rec, r)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			if tt.status == http.StatusForbidden && len(s.backend.GetUrlKeys()) != keys {
+				t.Errorf("Expected no password reset key to be made")
+			}
+		})
+	}
+
+	admin, err := s.backend.GetUser(users["admin"].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.Name != "admin" || admin.Privilege != models.PRIV_ADMIN {
+		t.Errorf("Expected the admin to be left alone, got %v", admin)
+	}
+}
+
+// Saving and approving from the queue needs both capabilities.  The edit
+// isn't saved without the approval.
+func Test_AdminMovieEditApprove(t *testing.T) {
+	s, db := newTestServerData(t)
+	admin := addTestUser(t, s, "admin", models.PRIV_ADMIN)
+	mod := addTestUser(t, s, "mod", models.PRIV_MOD)
+
+	err := s.backend.SetRoleCapabilities(admin, models.PRIV_MOD, []models.Capability{models.CAP_EDIT_MOVIES})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mid, err := db.AddMovie(&models.Movie{Name: "Akira", Pending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	form.WriteField("MovieName", "AKIRA")
+	form.WriteField("MovieDescr", "Neo-Tokyo")
+	form.WriteField("MovieLinks", "")
+	form.WriteField("Approve", "Save and approve")
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/movie/%d", mid), body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.AddCookie(sessionCookie(t, s, mod))
+
+	rec := httptest.NewRecorder()
+	s.handlerAdminMovieEdit(rec, r)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", rec.Code)
+	}
+
+	movie := s.backend.GetMovie(mid)
+	if movie.Name != "Akira" || !movie.Pending {
+		t.Errorf("Expected the movie to be left alone, got %q, pending %t", movie.Name, movie.Pending)
+	}
+}
+
+func Test_AdminAuditCsv(t *testing.T) {
+	s := newTestServer(t)
+	admin := addTestUser(t, s, "admin", models.PRIV_ADMIN)
+
+	s.backend.Audit(admin, models.AUDIT_MOVIE_EDIT, "=HYPERLINK(\"http://example.com\")",
+		map[string]string{"Name": "Akira"},
+		map[string]string{"Name": "+1 Akira", "Description": "-2", "Remarks": "@SUM(A1)"})
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/audit?format=csv", nil)
+	r.AddCookie(sessionCookie(t, s, admin))
+	rec := httptest.NewRecorder()
+	s.handlerAdminAudit(rec, r)
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 4 {
+		t.Fatalf("Expected a header and three rows, got %q", rows)
+	}
+
+	expected := [][]string{
+		{"Description", "", "'-2"},
+		{"Name", "Akira", "'+1 Akira"},
+		{"Remarks", "", "'@SUM(A1)"},
+	}
+
+	for i, row := range rows[1:] {
+		if row[5] != "'=HYPERLINK(\"http://example.com\")" {
+			t.Errorf("Expected the target to be escaped, got %q", row[5])
+		}
+
+		// Values that are not formulas are left alone
+		if !reflect.DeepEqual(row[6:], expected[i]) {
+			t.Errorf("Expected %q, got %q", expected[i], row[6:])
+		}
+	}
+}
@@ -3,7 +3,11 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
+	"github.com/zorchenhimer/MoviePolls/logic"
 	"github.com/zorchenhimer/MoviePolls/models"
 )
 
@@ -22,20 +26,38 @@ func (s *webServer) handlerPageMain(w http.ResponseWriter, r *http.Request) {
 		AvailableVotes int
 		LastCycle      *models.Cycle
 		Cycle          *models.Cycle
+
+		// Search form
+		Searching     bool
+		Search        url.Values
+		SearchErrors  []string
+		SearchCycles  []*models.Cycle
+		SearchTags    []*logic.TagCount
+		CanSeeRemoved bool
 	}{
 		dataPageBase: s.newPageBase("Current Cycle", w, r),
 	}
 
-	if r.Body != http.NoBody {
-		err := r.ParseForm()
-		if err != nil {
-			s.l.Error(err.Error())
-		}
-		searchVal := r.FormValue("search")
+	data.CanSeeRemoved = s.backend.HasCapability(data.User, models.CAP_EDIT_MOVIES)
+
+	// The search used to be a POST form, so keep accepting that.
+	if err := r.ParseForm(); err != nil {
+		s.l.Error(err.Error())
+	}
+	data.Search = r.Form
+
+	query, searching, searchErrors := parseSearchQuery(r.Form)
+	if query.Status == models.SEARCH_REMOVED && !data.CanSeeRemoved {
+		query.Status = models.SEARCH_ANY
+	}
+	data.Searching = searching
+	data.SearchErrors = searchErrors
 
-		movieList, err = s.backend.SearchMovieTitles(searchVal)
+	if searching {
+		var err error
+		movieList, err = s.backend.SearchMovies(query)
 		if err != nil {
-			s.l.Error(err.Error())
+			s.l.Error("Search for %s failed: %v", query, err)
 		}
 	} else {
 		var err error = nil //nolint:ineffassign
@@ -50,6 +72,17 @@ func (s *webServer) handlerPageMain(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	past, err := s.backend.GetPastCycles(0, 100)
+	if err != nil {
+		s.l.Error("Unable to get past cycles: %v", err)
+	}
+	data.SearchCycles = past
+
+	data.SearchTags, err = s.backend.GetTagCounts(false)
+	if err != nil {
+		s.l.Error("Unable to get tags: %v", err)
+	}
+
 	if data.User != nil {
 		val, err := s.backend.GetAvailableVotes(data.User)
 		if err != nil {
@@ -64,7 +97,13 @@ func (s *webServer) handlerPageMain(w http.ResponseWriter, r *http.Request) {
 		data.AvailableVotes = val
 	}
 
-	data.Movies = models.SortMoviesByVotes(movieList)
+	// Search results are already sorted by relevance
+	if searching {
+		data.Movies = movieList
+	} else {
+		data.Movies = models.SortMoviesByVotes(movieList)
+	}
+
 	votingEnabled, err := s.backend.GetVotingEnabled()
 	if err != nil {
 		s.l.Error("Error getting VotingEnabled: %v", err)
@@ -84,3 +123,63 @@ func (s *webServer) handlerPageMain(w http.ResponseWriter, r *http.Request) {
 		s.l.Error("Error rendering template: %v", err)
 	}
 }
+
+// parseSearchQuery reads the search form.  searching is false when none of
+// the search fields are filled in.
+func parseSearchQuery(form url.Values) (models.SearchQuery, bool, []string) {
+	query := models.SearchQuery{
+		Text:   strings.TrimSpace(form.Get("search")),
+		Status: models.SearchStatus(form.Get("status")),
+	}
+	searching := query.Text != "" || query.Status != models.SEARCH_ANY
+	errors := []string{}
+
+	switch query.Status {
+	case models.SEARCH_ANY, models.SEARCH_ACTIVE, models.SEARCH_WATCHED, models.SEARCH_REMOVED:
+	default:
+		errors = append(errors, fmt.Sprintf("Invalid status %q", query.Status))
+		query.Status = models.SEARCH_ANY
+	}
+
+	if tag := strings.TrimSpace(form.Get("tag")); tag != "" {
+		query.Tags = []string{tag}
+		searching = true
+	}
+
+	ints := []struct {
+		key   string
+		name  string
+		value *int
+	}{
+		{"cycle", "cycle", &query.CycleId},
+		{"minRuntime", "minimum runtime", &query.MinRuntime},
+		{"maxRuntime", "maximum runtime", &query.MaxRuntime},
+	}
+
+	for _, field := range ints {
+		val := strings.TrimSpace(form.Get(field.key))
+		if val == "" {
+			continue
+		}
+
+		num, err := strconv.Atoi(val)
+		if err != nil || num < 0 {
+			errors = append(errors, fmt.Sprintf("Invalid %s %q", field.name, val))
+			continue
+		}
+		*field.value = num
+		searching = true
+	}
+
+	if val := strings.TrimSpace(form.Get("minRating")); val != "" {
+		rating, err := strconv.ParseFloat(val, 32)
+		if err != nil || rating < 0 || rating > 10 {
+			errors = append(errors, fmt.Sprintf("Invalid minimum rating %q", val))
+		} else {
+			query.MinRating = float32(rating)
+			searching = true
+		}
+	}
+
+	return query, searching, errors
+}
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// tagLink is a tag in the tag browser.  Url toggles the tag in the current
+// selection.
+type tagLink struct {
+	Name     string
+	Movies   int
+	Selected bool
+	Url      string
+}
+
+// Browse the active movies by tag.  Selecting more than one tag shows the
+// movies that have all of them.
+func (s *webServer) handlerPageTags(w http.ResponseWriter, r *http.Request) {
+	selected := []string{}
+	for _, t := range r.URL.Query()["t"] {
+		if t = strings.TrimSpace(t); t != "" {
+			selected = append(selected, t)
+		}
+	}
+
+	counts, err := s.backend.GetTagCounts(true)
+	if err != nil {
+		s.doError(
+			http.StatusInternalServerError,
+			"Something went wrong :C",
+			w, r)
+		s.l.Error("Unable to get tags: %v", err)
+		return
+	}
+
+	tags := []*tagLink{}
+	for _, count := range counts {
+		link := &tagLink{
+			Name:   count.Tag.Name,
+			Movies: count.Movies,
+		}
+
+		// Aliases in the query select the tag as well
+		toggled := []string{}
+		for _, name := range selected {
+			if count.Tag.Matches(name) {
+				link.Selected = true
+			} else {
+				toggled = append(toggled, name)
+			}
+		}
+
+		if !link.Selected {
+			toggled = append(toggled, count.Tag.Name)
+		}
+		link.Url = "/tags?" + url.Values{"t": toggled}.Encode()
+
+		tags = append(tags, link)
+	}
+
+	movies := []*models.Movie{}
+	if len(selected) > 0 {
+		movies, err = s.backend.GetMoviesByTags(selected)
+		if err != nil {
+			s.doError(
+				http.StatusInternalServerError,
+				"Something went wrong :C",
+				w, r)
+			s.l.Error("Unable to filter movies by tags %q: %v", selected, err)
+			return
+		}
+	}
+
+	data := struct {
+		dataPageBase
+		Tags     []*tagLink
+		Selected []string
+		Movies   []*models.Movie
+	}{
+		dataPageBase: s.newPageBase("Tags", w, r),
+		Tags:         tags,
+		Selected:     selected,
+		Movies:       models.SortMoviesByName(movies),
+	}
+
+	if err := s.executeTemplate(w, "tags", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
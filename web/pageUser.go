@@ -1,11 +1,13 @@
 package web
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/zorchenhimer/MoviePolls/logic"
 	"github.com/zorchenhimer/MoviePolls/models"
 )
 
@@ -292,6 +294,9 @@ func (s *webServer) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == http.MethodPost {
 		// do login
+		if s.rateLimited(logic.RateLimitLogin, nil, w, r) {
+			return
+		}
 
 		un := r.PostFormValue("Username")
 		pw := r.PostFormValue("Password")
@@ -339,6 +344,93 @@ func (s *webServer) handlerUserLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+// /user/export
+
+func (s *webServer) handlerUserExport(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if user == nil {
+		http.Redirect(w, r, "/user/login", http.StatusFound)
+		return
+	}
+
+	export, err := s.backend.ExportUserData(user)
+	if err != nil {
+		s.l.Error("Unable to export data for user %d: %v", user.Id, err)
+		s.doError(http.StatusInternalServerError, "Unable to export your data", w, r)
+		return
+	}
+
+	raw, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		s.l.Error("Unable to marshal data export for user %d: %v", user.Id, err)
+		s.doError(http.StatusInternalServerError, "Unable to export your data", w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"moviepolls-user-%d.json\"", user.Id))
+	w.Write(raw)
+}
+
+// /user/delete
+
+func (s *webServer) handlerUserDelete(w http.ResponseWriter, r *http.Request) {
+	user := s.getSessionUser(w, r)
+	if user == nil {
+		http.Redirect(w, r, "/user/login", http.StatusFound)
+		return
+	}
+
+	data := struct {
+		dataPageBase
+
+		ErrorMessage []string
+		Deleted      bool
+		Purged       bool
+	}{
+		dataPageBase: s.newPageBase("Delete Account", w, r),
+	}
+
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			s.l.Error("ParseForm() error: %v", err)
+			s.doError(http.StatusInternalServerError, "Form error", w, r)
+			return
+		}
+
+		mode := r.PostFormValue("Mode")
+		if mode != "anonymize" && mode != "purge" {
+			data.ErrorMessage = append(data.ErrorMessage, "Choose what to do with your votes")
+		}
+
+		if r.PostFormValue("Confirm") != user.Name {
+			data.ErrorMessage = append(data.ErrorMessage, "Type your username to confirm")
+		}
+
+		if len(data.ErrorMessage) == 0 {
+			err = s.backend.DeleteOwnAccount(user, mode == "purge")
+			if err != nil {
+				s.l.Error("Unable to delete account of user %d: %v", user.Id, err)
+				data.ErrorMessage = append(data.ErrorMessage, err.Error())
+			} else {
+				if err = s.logout(w, r); err != nil {
+					s.l.Error("Error logging out: %v", err)
+				}
+
+				data.Deleted = true
+				data.Purged = mode == "purge"
+				data.dataPageBase = s.newPageBase("Delete Account", w, r)
+				data.User = nil
+			}
+		}
+	}
+
+	if err := s.executeTemplate(w, "accountDelete", data); err != nil {
+		s.l.Error("Error rendering template: %v", err)
+	}
+}
+
 // /user/new
 
 func (s *webServer) handlerUserNew(w http.ResponseWriter, r *http.Request) {
@@ -434,6 +526,10 @@ func (s *webServer) handlerUserNew(w http.ResponseWriter, r *http.Request) {
 	data.OAuth = twitchAuth || discordAuth || patreonAuth
 
 	if r.Method == http.MethodPost {
+		if s.rateLimited(logic.RateLimitSignup, nil, w, r) {
+			return
+		}
+
 		err := r.ParseForm()
 		if err != nil {
 			s.l.Error("Error parsing login form: %v", err)
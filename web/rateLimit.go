@@ -0,0 +1,53 @@
+package web
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zorchenhimer/MoviePolls/logic"
+	"github.com/zorchenhimer/MoviePolls/models"
+)
+
+// clientIp returns the address requests are limited by.  Behind a proxy
+// that's the last address in X-Forwarded-For, the one the proxy added.
+func (s *webServer) clientIp(r *http.Request) string {
+	trust, err := s.backend.GetTrustForwardedFor()
+	if err != nil {
+		s.requestLog(r).Error("Unable to get %s: %v", logic.ConfigTrustForwardedFor, err)
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); trust && len(forwarded) > 0 {
+		addrs := strings.Split(forwarded[len(forwarded)-1], ",")
+		if ip := net.ParseIP(strings.TrimSpace(addrs[len(addrs)-1])); ip != nil {
+			return ip.String()
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimited checks the limit of action for the client and, if there is
+// one, the user.  Over the limit it shows the error page and returns true.
+func (s *webServer) rateLimited(action logic.RateLimitAction, user *models.User, w http.ResponseWriter, r *http.Request) bool {
+	wait := s.requestBackend(r).RateLimit(action, s.clientIp(r), user)
+	if wait <= 0 {
+		return false
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	s.doError(
+		http.StatusTooManyRequests,
+		fmt.Sprintf("Too many requests, try again in %s", time.Duration(seconds)*time.Second),
+		w, r)
+	return true
+}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/logic"
+)
+
+const RequestIdHeader string = "X-Request-Id"
+
+type requestIdKey struct{}
+
+// IDs given by a proxy in front of the server are used as is if they look
+// sane, so its logs can be matched up with ours.
+var reRequestId = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+func newRequestId() string {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(raw)
+}
+
+// withRequestId gives every request an ID, sends it back in the
+// X-Request-Id header, and stores the ID in the request's context.  Use
+// requestLog() and requestBackend() to log with it.
+func (s *webServer) withRequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIdHeader)
+		if !reRequestId.MatchString(id) {
+			id = newRequestId()
+		}
+
+		w.Header().Set(RequestIdHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIdKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestLog returns the logger for the given request.  Its messages carry
+// the request ID.
+func (s *webServer) requestLog(r *http.Request) *logger.Logger {
+	if id, ok := r.Context().Value(requestIdKey{}).(string); ok {
+		return s.l.With("request_id", id)
+	}
+	return s.l
+}
+
+// requestBackend returns the backend for the given request, so the
+// backend's messages for the request can be found by its ID too.  They keep
+// the backend's own package and log level.
+func (s *webServer) requestBackend(r *http.Request) logic.Logic {
+	if id, ok := r.Context().Value(requestIdKey{}).(string); ok {
+		return s.backend.WithRequestId(id)
+	}
+	return s.backend
+}
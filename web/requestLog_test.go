@@ -0,0 +1,76 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zorchenhimer/MoviePolls/database"
+	"github.com/zorchenhimer/MoviePolls/logger"
+	"github.com/zorchenhimer/MoviePolls/logic"
+)
+
+// The backend's messages for a request carry the request ID, but keep the
+// package and log level of the backend.
+func Test_RequestBackendLog(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "moviepolls.log")
+	log, err := logger.New(logger.Options{Level: logger.LLInfo, Format: logger.LFJson, File: logFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = log.SetLevel("web", logger.LLSilent); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.GetDatabase("json", filepath.Join(t.TempDir(), "data.json"), log.Package("database"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := logic.New(db, log.Package("logic"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = backend.SetConfigValue(logic.ConfigRateLimitSearch, "1/1h"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &webServer{backend: backend, l: log.Package("web")}
+	r := httptest.NewRequest(http.MethodGet, "/add", nil)
+	r = r.WithContext(context.WithValue(r.Context(), requestIdKey{}, "abc123"))
+
+	// The second search is refused and logged by the backend
+	s.requestBackend(r).RateLimit(logic.RateLimitSearch, "127.0.0.1", nil)
+	s.requestBackend(r).RateLimit(logic.RateLimitSearch, "127.0.0.1", nil)
+
+	raw, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+
+		if msg, _ := entry["msg"].(string); strings.HasPrefix(msg, "Rate limited search") {
+			found = true
+			if entry["package"] != "logic" || entry["request_id"] != "abc123" {
+				t.Errorf("Expected package logic and the request ID, got %v", entry)
+			}
+		}
+	}
+
+	if !found {
+		t.Errorf("Expected the backend's message in the log, got %q", raw)
+	}
+}
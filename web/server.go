@@ -7,6 +7,7 @@ import (
 
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/sessions"
 
@@ -24,6 +25,12 @@ type Server interface {
 type Options struct {
 	Listen string // eg, "127.0.0.1:8080" or ":8080" (defaults to 0.0.0.0:8080)
 	Debug  bool   // debug logging to console
+
+	// Zero values use the defaults in middleware.go
+	ReadTimeout  time.Duration // reading a whole request
+	WriteTimeout time.Duration // from the end of the request headers to the end of the response
+	IdleTimeout  time.Duration // keep-alive connections between requests
+	MaxBodySize  int64         // in bytes, not counting uploaded posters
 }
 
 type callbackError struct {
@@ -42,6 +49,8 @@ type webServer struct {
 
 	callbackError callbackError
 	l             *logger.Logger
+
+	maxBodySize int64
 }
 
 func New(options Options, backend logic.Logic, log *logger.Logger) (*webServer, error) {
@@ -54,8 +63,26 @@ func New(options Options, backend logic.Logic, log *logger.Logger) (*webServer,
 		return nil, fmt.Errorf("Unable to create posters directory: %v", err)
 	}
 
+	if options.ReadTimeout == 0 {
+		options.ReadTimeout = defaultReadTimeout
+	}
+	if options.WriteTimeout == 0 {
+		options.WriteTimeout = defaultWriteTimeout
+	}
+	if options.IdleTimeout == 0 {
+		options.IdleTimeout = defaultIdleTimeout
+	}
+	if options.MaxBodySize == 0 {
+		options.MaxBodySize = defaultMaxBodySize
+	}
+
 	hs := &http.Server{
-		Addr: options.Listen,
+		Addr:              options.Listen,
+		ReadHeaderTimeout: min(defaultReadHeaderTimeout, options.ReadTimeout),
+		ReadTimeout:       options.ReadTimeout,
+		WriteTimeout:      options.WriteTimeout,
+		IdleTimeout:       options.IdleTimeout,
+		MaxHeaderBytes:    defaultMaxHeaderBytes,
 	}
 
 	authKey, encryptKey, passwordSalt, err := backend.GetKeys()
@@ -66,6 +93,7 @@ func New(options Options, backend logic.Logic, log *logger.Logger) (*webServer,
 	server := &webServer{
 		debug:        options.Debug,
 		passwordSalt: passwordSalt,
+		maxBodySize:  options.MaxBodySize,
 
 		cookies: sessions.NewCookieStore([]byte(authKey), []byte(encryptKey)),
 		l:       log,
@@ -85,11 +113,17 @@ func New(options Options, backend logic.Logic, log *logger.Logger) (*webServer,
 		"/posters/":    server.handlerPosters,
 		"/favicon.ico": server.handlerFavicon,
 
+		// Monitoring
+		"/healthz": server.handlerHealthz,
+		"/readyz":  server.handlerReadyz,
+		"/metrics": server.handlerMetrics,
+
 		// Main Page handlers
 		"/":        server.handlerPageMain,
 		"/add":     server.handlerPageAddMovie,
 		"/movie/":  server.handlerPageMovie,
 		"/history": server.handlerPageHistory,
+		"/tags":    server.handlerPageTags,
 		"/user":    server.handlerPageUser,
 
 		// User management
@@ -97,6 +131,8 @@ func New(options Options, backend logic.Logic, log *logger.Logger) (*webServer,
 		"/user/logout":       server.handlerUserLogout,
 		"/user/new":          server.handlerUserNew,
 		"/user/remove/local": server.handlerLocalAuthRemove,
+		"/user/export":       server.handlerUserExport,
+		"/user/delete":       server.handlerUserDelete,
 
 		// Functional endpoints (used for page functionality) - not having a page itself
 		"/vote/": server.handlerVote,
@@ -111,24 +147,40 @@ func New(options Options, backend logic.Logic, log *logger.Logger) (*webServer,
 		"/oauth/patreon/callback": server.handlerPatreonOAuthCallback,
 
 		// Admin pages
-		"/auth/":           server.handlerAuth,
-		"/admin/":          server.handlerAdminHome,
-		"/admin/config":    server.handlerAdminConfig,
-		"/admin/cycles":    server.handlerAdminCycles,
-		"/admin/cyclepost": server.handlerAdminCycles_Post,
-		"/admin/user/":     server.handlerAdminUserEdit,
-		"/admin/users":     server.handlerAdminUsers,
-		"/admin/movies":    server.handlerAdminMovies,
-		"/admin/movie/":    server.handlerAdminMovieEdit,
+		"/auth/":                server.handlerAuth,
+		"/admin/":               server.handlerAdminHome,
+		"/admin/config":         server.handlerAdminConfig,
+		"/admin/config/export":  server.handlerAdminConfigExport,
+		"/admin/config/import":  server.handlerAdminConfigImport,
+		"/admin/config/history": server.handlerAdminConfigHistory,
+		"/admin/cycles":         server.handlerAdminCycles,
+		"/admin/cyclepost":      server.handlerAdminCycles_Post,
+		"/admin/user/":          server.handlerAdminUserEdit,
+		"/admin/users":          server.handlerAdminUsers,
+		"/admin/movies":         server.handlerAdminMovies,
+		"/admin/movie/":         server.handlerAdminMovieEdit,
+		"/admin/queue":          server.handlerAdminQueue,
+		"/admin/roles":          server.handlerAdminRoles,
+		"/admin/audit":          server.handlerAdminAudit,
+		"/admin/logs":           server.handlerAdminLogs,
+		"/admin/posters":        server.handlerAdminPosters,
+		"/admin/tags":           server.handlerAdminTags,
+		"/admin/throttled":      server.handlerAdminThrottled,
 
 		// "/admin/nextcycle", server.handlerAdminNextCycle)
 	}
 
 	for path, handler := range handlers {
-		mux.HandleFunc(path, handler)
+		mux.HandleFunc(path, server.instrument(path, handler))
 	}
 
-	hs.Handler = mux
+	hs.Handler = chain(mux,
+		server.withRequestId,
+		server.accessLog,
+		server.recoverPanic,
+		server.securityHeaders,
+		server.limitBody,
+	)
 	server.s = hs
 
 	err = server.registerTemplates()
@@ -149,14 +201,14 @@ func (s *webServer) Shutdown(ctx context.Context) error {
 }
 
 func (s *webServer) doError(code int, message string, w http.ResponseWriter, r *http.Request) {
-	s.l.Debug("%d for %q", code, r.URL.Path)
+	s.requestLog(r).Debug("%d for %q", code, r.URL.Path)
 	dataErr := dataError{
 		dataPageBase: s.newPageBase("Error", w, r),
 		Message:      message,
 		Code:         code,
 	}
 
-	w.WriteHeader(http.StatusNotFound)
+	w.WriteHeader(code)
 	if err := s.executeTemplate(w, "error", dataErr); err != nil {
 		s.l.Error("Error rendering template: %v", err)
 	}
@@ -168,5 +168,6 @@ func (s *webServer) getSessionUser(w http.ResponseWriter, r *http.Request) *mode
 		return nil
 	}
 
+	activeSessions.seen(user.Id)
 	return user
 }
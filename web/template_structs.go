@@ -9,6 +9,7 @@ type dataPageBase struct {
 	Notice    string
 
 	User         *models.User
+	Capabilities map[string]bool // Admin capabilities of User, keyed by name
 	CurrentCycle *models.Cycle
 }
 
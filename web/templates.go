@@ -17,22 +17,34 @@ var templateDefs map[string][]string = map[string][]string{
 	"simplelogin":   []string{"plain-login.html"},
 	"addmovie":      []string{"add-movie.html"},
 	"account":       []string{"account.html"},
+	"accountDelete": []string{"account-delete.html"},
 	"newaccount":    []string{"newaccount.html"},
 	"error":         []string{"error.html"},
 	"history":       []string{"history.html"},
+	"tags":          []string{"tags.html"},
 	"auth":          []string{"auth.html"},
 	"passwordReset": []string{"password.html"},
 
-	"adminHome":      []string{"admin/base.html", "admin/home.html"},
-	"adminConfig":    []string{"admin/base.html", "admin/config.html"},
-	"adminUsers":     []string{"admin/base.html", "admin/users.html"},
-	"adminUserEdit":  []string{"admin/base.html", "admin/user-edit.html"},
-	"adminCycles":    []string{"admin/base.html", "admin/cycles.html"},
-	"adminEndCycle":  []string{"admin/base.html", "admin/endcycle.html"},
-	"adminMovies":    []string{"admin/base.html", "admin/movies.html"},
-	"adminMovieEdit": []string{"admin/base.html", "admin/movie-edit.html"},
-	"adminNotice":    []string{"admin/base.html", "admin/notice.html"},
-	"adminConfirm":   []string{"admin/base.html", "admin/confirmation.html"},
+	"adminHome":          []string{"admin/base.html", "admin/home.html"},
+	"adminConfig":        []string{"admin/base.html", "admin/config.html"},
+	"adminConfigImport":  []string{"admin/base.html", "admin/config-import.html"},
+	"adminConfigHistory": []string{"admin/base.html", "admin/config-history.html"},
+	"adminUsers":         []string{"admin/base.html", "admin/users.html"},
+	"adminUserEdit":      []string{"admin/base.html", "admin/user-edit.html"},
+	"adminCycles":        []string{"admin/base.html", "admin/cycles.html"},
+	"adminEndCycle":      []string{"admin/base.html", "admin/endcycle.html"},
+	"adminMovies":        []string{"admin/base.html", "admin/movies.html"},
+	"adminMovieEdit":     []string{"admin/base.html", "admin/movie-edit.html"},
+	"adminMovieHistory":  []string{"admin/base.html", "admin/movie-history.html"},
+	"adminQueue":         []string{"admin/base.html", "admin/queue.html"},
+	"adminRoles":         []string{"admin/base.html", "admin/roles.html"},
+	"adminLogs":          []string{"admin/base.html", "admin/logs.html"},
+	"adminAudit":         []string{"admin/base.html", "admin/audit.html"},
+	"adminPosters":       []string{"admin/base.html", "admin/posters.html"},
+	"adminTags":          []string{"admin/base.html", "admin/tags.html"},
+	"adminThrottled":     []string{"admin/base.html", "admin/throttled.html"},
+	"adminNotice":        []string{"admin/base.html", "admin/notice.html"},
+	"adminConfirm":       []string{"admin/base.html", "admin/confirmation.html"},
 }
 
 func (s *webServer) registerTemplates() error {
@@ -86,11 +98,18 @@ func (s *webServer) newPageBase(title string, w http.ResponseWriter, r *http.Req
 		s.l.Error("Unable to get notice message from database: %v", err)
 	}
 
+	user := s.getSessionUser(w, r)
+	caps := map[string]bool{}
+	for _, c := range s.backend.GetUserCapabilities(user) {
+		caps[string(c)] = true
+	}
+
 	return dataPageBase{
 		PageTitle: title,
 		Notice:    notice,
 
-		User:         s.getSessionUser(w, r),
+		User:         user,
+		Capabilities: caps,
 		CurrentCycle: cycle,
 	}
 }